@@ -1,25 +1,50 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"deploybot-agent/internal/api"
 	"deploybot-agent/internal/audit"
+	"deploybot-agent/internal/auth"
 	"deploybot-agent/internal/config"
 	"deploybot-agent/internal/controller"
 	"deploybot-agent/internal/dockerutil"
+	"deploybot-agent/internal/hooks"
 	"deploybot-agent/internal/jobs"
+	"deploybot-agent/internal/jobs/pool"
+	"deploybot-agent/internal/logshipper"
 	"deploybot-agent/internal/metrics"
+	"deploybot-agent/internal/pki"
 	"deploybot-agent/internal/setup"
 	"deploybot-agent/internal/state"
 
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+
+	gcpkms "cloud.google.com/go/kms/apiv1"
+
+	vaultapi "github.com/hashicorp/vault/api"
+
 	"golang.org/x/term"
 )
 
@@ -42,14 +67,20 @@ func main() {
 		}
 	}
 
-	statePath := filepath.Join(cfg.DataDir, "agent.json")
+	backend, err := state.NewBackend(cfg.StateBackend, cfg.DataDir, "")
+	if err != nil {
+		log.Fatalf("state backend setup failed: %v", err)
+	}
 	var cipher state.Cipher
+	var ring *state.KeyRing
 	storeOpts := []state.Option{}
-	if cfg.EncryptionKey != "" {
-		cipher, err = state.NewAESCipher(cfg.EncryptionKey)
+	usesKMSProvider := cfg.EncryptionKeyProvider != "" && cfg.EncryptionKeyProvider != "passphrase"
+	if cfg.EncryptionKey != "" || usesKMSProvider {
+		ring, err = buildKeyRing(cfg, backend)
 		if err != nil {
 			log.Fatalf("state encryption setup failed: %v", err)
 		}
+		cipher = state.NewEnvelopeCipher(ring, nil)
 		storeOpts = append(storeOpts, state.WithCipher(cipher))
 	} else if cfg.EnableStateEncryption && !cfg.SecurityBypass {
 		log.Fatalf("state encryption enabled but no AGENT_STATE_KEY provided")
@@ -57,32 +88,57 @@ func main() {
 	if cipher != nil {
 		storeOpts = append(storeOpts, state.WithTokenEncryption(cfg.EnableStateEncryption && !cfg.SecurityBypass))
 	}
-	store, err := state.Open(statePath, storeOpts...)
+	store, err := state.Open(backend, storeOpts...)
 	if err != nil {
 		log.Fatalf("state open error: %v", err)
 	}
+	if ring != nil {
+		if p, ok := ring.Active().(*state.PassphraseKeyProvider); ok && store.EncryptionSalt() == "" {
+			if err := store.SetEncryptionSalt(base64.StdEncoding.EncodeToString(p.Salt())); err != nil {
+				log.Fatalf("failed to persist encryption salt: %v", err)
+			}
+		}
+		if cfg.EncryptionRotateTo != "" {
+			if err := rotateEncryptionKey(context.Background(), cfg, ring, store); err != nil {
+				log.Fatalf("encryption key rotation failed: %v", err)
+			}
+		}
+	}
 
-	agentID, storedToken, err := store.AgentCredentials()
+	_, storedToken, err := store.AgentCredentials()
 	if err != nil {
 		log.Fatalf("state credential error: %v", err)
 	}
-	token := storedToken
-	if token == "" {
-		token = cfg.AgentToken
-	}
 
-	controllerOpts := []controller.Option{}
-	controllerOpts = append(controllerOpts, controller.WithTLSConfig(controller.TLSConfig{
+	// pkiManager is nil until enrolled further down (once the agent ID is
+	// known, after registration); the closure below only gets called on
+	// TLS handshakes that request a client certificate, and returns an
+	// error for any such handshake made before pkiManager is assigned.
+	var pkiManager *pki.Manager
+	tlsCfg := controller.TLSConfig{
 		AllowInsecure: cfg.AllowInsecureController || cfg.SecurityBypass,
 		CAFile:        cfg.ControllerCAFile,
 		CAPins:        cfg.ControllerCAPins,
 		ClientCert:    cfg.ClientCertFile,
 		ClientKey:     cfg.ClientKeyFile,
-	}))
+	}
+	if cfg.PKIDirectoryURL != "" {
+		// Client-cert-on-demand is safe to wire up before enrollment
+		// completes: crypto/tls only calls this if the controller's TLS
+		// config actually requests a client certificate, which a
+		// not-yet-enrolled agent won't be asked for during registration.
+		tlsCfg.GetClientCertificate = func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if pkiManager == nil {
+				return nil, errors.New("pki: certificate enrollment has not completed yet")
+			}
+			return pkiManager.GetClientCertificate(cri)
+		}
+	}
+	controllerOpts := []controller.Option{controller.WithTLSConfig(tlsCfg)}
 	if cfg.SecurityBypass {
 		controllerOpts = append(controllerOpts, controller.WithSecurityBypass())
 	}
-	client, err := controller.New(cfg.ControllerURL, token, controllerOpts...)
+	client, err := controller.New(cfg.ControllerURL, storedToken, controllerOpts...)
 	if err != nil {
 		log.Fatalf("controller client error: %v", err)
 	}
@@ -96,26 +152,127 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	metricsRegistry := metrics.NewRegistry()
+	var controllerReachable atomic.Bool
+	controllerReachable.Store(true)
+	if cfg.MetricsListenAddr != "" {
+		metricsSrv, err := metrics.NewServer(metricsRegistry, metrics.ServerConfig{
+			ListenAddr:     cfg.MetricsListenAddr,
+			AuthToken:      cfg.MetricsAuthToken,
+			ClientCertFile: cfg.ClientCertFile,
+			ClientKeyFile:  cfg.ClientKeyFile,
+			ClientCAFile:   cfg.ControllerCAFile,
+		}, controllerReachable.Load)
+		if err != nil {
+			log.Fatalf("metrics server setup failed: %v", err)
+		}
+		go func() {
+			if err := metrics.Serve(ctx, metricsSrv); err != nil {
+				log.Printf("metrics server error: %v", err)
+			}
+		}()
+		log.Printf("metrics server listening on %s", cfg.MetricsListenAddr)
+	}
+
 	hostname, _ := os.Hostname()
 
 	capabilities := buildCapabilities(cfg)
-	auditLogger, err := audit.NewLogger(cfg.AuditLogPath)
+
+	authMethod, err := buildAuthMethod(cfg)
 	if err != nil {
-		log.Fatalf("failed to initialise audit logger: %v", err)
+		log.Fatalf("auth method error: %v", err)
+	}
+	runner := &auth.Runner{
+		Method:      authMethod,
+		Client:      client,
+		Sinks:       buildAuthSinks(cfg, store, cipher),
+		RenewBefore: cfg.AuthRenewBefore,
+		BuildRequest: func(ctx context.Context) (controller.RegisterRequest, error) {
+			snap, err := metrics.Collect(ctx)
+			if err != nil {
+				return controller.RegisterRequest{}, err
+			}
+			dockerVersion, err := dockerManager.Version(ctx)
+			if err != nil {
+				return controller.RegisterRequest{}, err
+			}
+			return controller.RegisterRequest{
+				Metrics: controller.Metrics{
+					CPUPercent: snap.CPUPercent,
+					MemPercent: snap.MemPercent,
+					DiskFreeGB: snap.DiskFreeGB,
+				},
+				DockerVersion: dockerVersion,
+				Hostname:      hostname,
+				Capabilities:  capabilities,
+			}, nil
+		},
+	}
+	// Registration is idempotent on the controller side, so we always
+	// auth on start (Vault-agent style) rather than only when credentials
+	// are missing; Runner continues renewing in the background afterwards.
+	if _, err := runner.Start(ctx); err != nil {
+		log.Fatalf("registration failed: %v", err)
+	}
+	agentID, _, err := store.AgentCredentials()
+	if err != nil {
+		log.Fatalf("state credential error: %v", err)
 	}
 
-	if agentID == "" || storedToken == "" {
-		if err := bootstrapAgent(ctx, cfg, store, client, dockerManager, hostname, capabilities); err != nil {
-			log.Fatalf("registration failed: %v", err)
+	if cfg.PKIDirectoryURL != "" {
+		pkiManager = pki.New(pki.Config{
+			DataDir:              cfg.DataDir,
+			AgentID:              agentID,
+			Hostname:             hostname,
+			DirectoryURL:         cfg.PKIDirectoryURL,
+			EABKeyID:             cfg.PKIEABKeyID,
+			ChallengeListenAddr:  cfg.PKIChallengeAddr,
+			RenewalFraction:      cfg.PKIRenewalFraction,
+			Cipher:               cipher,
+			EABSecret: func(ctx context.Context) (string, error) {
+				_, token, err := store.AgentCredentials()
+				return token, err
+			},
+		})
+		if err := pkiManager.Start(ctx); err != nil {
+			log.Fatalf("mTLS certificate enrollment failed: %v", err)
 		}
-		agentID, token, err = store.AgentCredentials()
+		warnIfCAPinsStale(cfg.ControllerCAPins, pkiManager.IssuerCertificates())
+	}
+
+	auditLogger, err := buildAuditLogger(cfg, client, agentID, pkiManager, cipher)
+	if err != nil {
+		log.Fatalf("failed to initialise audit logger: %v", err)
+	}
+	defer auditLogger.Close()
+
+	shipper := &logshipper.Shipper{Client: client, AgentID: agentID, DataDir: cfg.DataDir}
+	handler := &jobs.Handler{Cfg: cfg, State: store, Docker: dockerManager, LogPublisher: shipper, Audit: auditLogger, Hooks: hooks.NewManager(cfg.HookDirs)}
+	for _, warning := range handler.Hooks.LoadWarnings() {
+		log.Printf("deploy hook load warning: %s", warning)
+	}
+	jobPool := pool.New(pool.Config{Workers: cfg.MaxConcurrentJobs, RetryLimit: cfg.JobRetryLimit, MaxPerType: parseJobTypeConcurrency(cfg.JobTypeConcurrency)}, handler.Handle)
+
+	if cfg.APISocketPath != "" {
+		apiSrv, err := api.NewServer(handler, dockerManager, api.Config{SocketPath: cfg.APISocketPath, SocketMode: 0o660})
 		if err != nil {
-			log.Fatalf("state credential error: %v", err)
+			log.Fatalf("docker-compatible api server setup failed: %v", err)
 		}
+		go func() {
+			if err := apiSrv.Serve(ctx); err != nil {
+				log.Printf("docker-compatible api server error: %v", err)
+			}
+		}()
+		log.Printf("docker-compatible api server listening on %s", cfg.APISocketPath)
 	}
 
-	publisher := &controllerLogPublisher{client: client, agentID: agentID}
-	handler := &jobs.Handler{Cfg: cfg, State: store, Docker: dockerManager, LogPublisher: publisher, Audit: auditLogger}
+	// A second agent sharing this agent_id (warm-standby, blue/green
+	// upgrade) may already hold the lease; this blocks, keeping state hot
+	// via Watch, until it wins or is cancelled.
+	lease, err := waitForLease(ctx, store, cfg.HeartbeatInterval*3)
+	if err != nil {
+		log.Fatalf("leadership lease error: %v", err)
+	}
 
 	ticker := time.NewTicker(cfg.HeartbeatInterval)
 	defer ticker.Stop()
@@ -126,47 +283,359 @@ func main() {
 		select {
 		case <-ctx.Done():
 			log.Printf("shutdown requested: %v", ctx.Err())
+			drainPool(jobPool)
 			return
+		case <-lease.Released():
+			log.Fatalf("lost leadership lease for agent %s; a standby should take over", agentID)
 		case <-ticker.C:
-			if err := sendHeartbeat(ctx, handler, client, dockerManager, agentID, capabilities); err != nil {
+			if err := sendHeartbeat(ctx, handler, jobPool, client, dockerManager, shipper, agentID, capabilities, metricsRegistry, &controllerReachable); err != nil {
 				log.Printf("heartbeat error: %v", err)
 			}
 		}
 	}
 }
 
-func bootstrapAgent(ctx context.Context, cfg config.Config, store *state.Store, client *controller.Client, dockerManager *dockerutil.Manager, hostname string, capabilities []string) error {
-	snap, err := metrics.Collect(ctx)
+// drainPool lets jobs already running finish naturally within the pool's
+// drain deadline before the process exits. Jobs that finish (or were only
+// queued behind a busy target and never got to run) are already acked to
+// the controller via their own onComplete callback by the time Drain
+// returns; what's logged here is Drain's list: the IDs of those jobs that
+// never got to run, plus one per-type placeholder for each job still
+// running when the deadline hit - those will ack on their own once they
+// finish, possibly after this process has already exited.
+func drainPool(jobPool *pool.Pool) {
+	unclaimed := jobPool.Drain()
+	if len(unclaimed) > 0 {
+		log.Printf("drained job pool with %d job(s) unclaimed: %v", len(unclaimed), unclaimed)
+	}
+}
+
+// parseJobTypeConcurrency turns cfg.JobTypeConcurrency's "type=limit"
+// entries (e.g. "build=1,exec=2") into pool.Config.MaxPerType, logging and
+// skipping any entry that isn't a positive integer rather than failing
+// startup over a typo in an advanced, rarely-used knob.
+func parseJobTypeConcurrency(entries []string) map[jobs.JobType]int {
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[jobs.JobType]int, len(entries))
+	for _, entry := range entries {
+		jt, limitStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Printf("ignoring malformed job-type-concurrency entry %q: want type=limit", entry)
+			continue
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+		if err != nil || limit <= 0 {
+			log.Printf("ignoring malformed job-type-concurrency entry %q: limit must be a positive integer", entry)
+			continue
+		}
+		out[jobs.JobType(strings.TrimSpace(jt))] = limit
+	}
+	return out
+}
+
+// jobTypeCounts re-keys a pool.Counters map by jobs.JobType's underlying
+// string so it can feed metrics.FlattenJobQueue, which stays independent
+// of the jobs package.
+func jobTypeCounts(m map[jobs.JobType]int) map[string]int {
+	out := make(map[string]int, len(m))
+	for jt, n := range m {
+		out[string(jt)] = n
+	}
+	return out
+}
+
+// observeManagedContainerStats samples CPU/memory/network/blkio usage for
+// every container carrying AgentLabelManagedKey and feeds it to registry.
+// Sampling errors for an individual container are logged and skipped rather
+// than failing the whole heartbeat, since a single container's stats
+// endpoint misbehaving shouldn't block host metrics or job dispatch.
+func observeManagedContainerStats(ctx context.Context, dockerManager *dockerutil.Manager, registry *metrics.Registry) {
+	managed, err := dockerManager.FindContainerByLabel(ctx, dockerutil.AgentLabelManagedKey, dockerutil.AgentLabelManagedValue)
 	if err != nil {
-		return err
+		log.Printf("container stats: list managed containers: %v", err)
+		return
+	}
+	registry.ResetContainerStats()
+	for _, c := range managed {
+		stats, err := dockerManager.ContainerStatsSnapshot(ctx, c.ID)
+		if err != nil {
+			log.Printf("container stats: sample %s: %v", c.ID, err)
+			continue
+		}
+		registry.ObserveContainerStats(containerDisplayName(c.Names), c.Image, stats.CPUPercent, stats.MemUsageBytes, stats.MemLimitBytes, stats.NetworkRxBytes, stats.NetworkTxBytes, stats.BlkioReadBytes, stats.BlkioWriteBytes)
 	}
+}
+
+// containerDisplayName mirrors dockerutil's own Inventory naming: Docker's
+// container list API returns names with a leading slash.
+func containerDisplayName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "/")
+}
 
-	dockerVersion, err := dockerManager.Version(ctx)
+// waitForLease keeps store's in-memory state hot via Watch while blocking
+// until this process wins the leadership lease for its agent_id. Only the
+// lease holder should reach the heartbeat loop; every other instance sharing
+// the same agent_id stays a passive standby here.
+func waitForLease(ctx context.Context, store *state.Store, ttl time.Duration) (state.Lease, error) {
+	watchCh, err := store.Watch(ctx)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("watch state for standby hot-sync: %w", err)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watchCh:
+				if !ok {
+					return
+				}
+				if err := store.Reload(event.Value, event.Version); err != nil {
+					log.Printf("standby state reload error: %v", err)
+				}
+			}
+		}
+	}()
+	return store.AcquireLease(ctx, ttl)
+}
+
+// buildKeyRing assembles the KeyRing state's envelope cipher wraps DEKs
+// with. When cfg.EncryptionKeyProvider selects a KMS/Vault backend and an
+// EncryptionKey passphrase is also set, the passphrase provider is kept in
+// the ring as a retired (decrypt-only) key so a token encrypted before the
+// migration keeps working until rotateEncryptionKey re-wraps it.
+func buildKeyRing(cfg config.Config, backend state.Backend) (*state.KeyRing, error) {
+	var retired []state.KeyProvider
+	var passphraseProvider *state.PassphraseKeyProvider
+	if cfg.EncryptionKey != "" {
+		saltB64, err := state.ReadEncryptionSalt(backend)
+		if err != nil {
+			return nil, err
+		}
+		if saltB64 != "" {
+			salt, err := base64.StdEncoding.DecodeString(saltB64)
+			if err != nil {
+				return nil, fmt.Errorf("decode encryption salt: %w", err)
+			}
+			passphraseProvider, err = state.LoadPassphraseKeyProvider(cfg.EncryptionKey, salt)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			passphraseProvider, err = state.NewPassphraseKeyProvider(cfg.EncryptionKey)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	req := controller.RegisterRequest{
-		Token: cfg.AgentToken,
-		Metrics: controller.Metrics{
-			CPUPercent: snap.CPUPercent,
-			MemPercent: snap.MemPercent,
-			DiskFreeGB: snap.DiskFreeGB,
-		},
-		DockerVersion: dockerVersion,
-		Hostname:      hostname,
-		Capabilities:  capabilities,
+	switch cfg.EncryptionKeyProvider {
+	case "", "passphrase":
+		if passphraseProvider == nil {
+			return nil, fmt.Errorf("encryption-key is required when encryption-key-provider is passphrase")
+		}
+		return state.NewKeyRing(passphraseProvider), nil
 	}
 
-	resp, err := client.Register(ctx, req)
+	if passphraseProvider != nil {
+		retired = append(retired, passphraseProvider)
+	}
+	active, err := buildKMSKeyProvider(cfg)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return state.NewKeyRing(active, retired...), nil
+}
+
+// buildKMSKeyProvider constructs the KMS/Vault-backed KeyProvider named by
+// cfg.EncryptionKeyProvider, using each provider's default credential
+// chain the same way the auto-auth Methods in internal/auth do.
+func buildKMSKeyProvider(cfg config.Config) (state.KeyProvider, error) {
+	ctx := context.Background()
+	switch cfg.EncryptionKeyProvider {
+	case "aws-kms":
+		if cfg.EncryptionAWSKMSKeyARN == "" {
+			return nil, fmt.Errorf("encryption-aws-kms-key is required for the aws-kms provider")
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS config: %w", err)
+		}
+		return &state.AWSKMSKeyProvider{Client: kms.NewFromConfig(awsCfg), KeyARN: cfg.EncryptionAWSKMSKeyARN}, nil
+	case "gcp-kms":
+		if cfg.EncryptionGCPKMSKeyName == "" {
+			return nil, fmt.Errorf("encryption-gcp-kms-key is required for the gcp-kms provider")
+		}
+		client, err := gcpkms.NewKeyManagementClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create cloud kms client: %w", err)
+		}
+		return &state.GCPKMSKeyProvider{Client: client, CryptoKeyRef: cfg.EncryptionGCPKMSKeyName}, nil
+	case "azure-keyvault":
+		if cfg.EncryptionAzureVaultURL == "" || cfg.EncryptionAzureKeyName == "" {
+			return nil, fmt.Errorf("encryption-azure-vault-url and encryption-azure-key-name are required for the azure-keyvault provider")
+		}
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("load azure credentials: %w", err)
+		}
+		client, err := azkeys.NewClient(cfg.EncryptionAzureVaultURL, cred, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create key vault client: %w", err)
+		}
+		return &state.AzureKeyVaultKeyProvider{
+			Client:    client,
+			VaultURL:  cfg.EncryptionAzureVaultURL,
+			KeyName:   cfg.EncryptionAzureKeyName,
+			Algorithm: azkeys.EncryptionAlgorithmRSAOAEP256,
+		}, nil
+	case "vault-transit":
+		if cfg.EncryptionVaultTransitKey == "" {
+			return nil, fmt.Errorf("encryption-vault-transit-key is required for the vault-transit provider")
+		}
+		client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("create vault client: %w", err)
+		}
+		return &state.VaultTransitKeyProvider{Client: client, KeyName: cfg.EncryptionVaultTransitKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown encryption-key-provider %q", cfg.EncryptionKeyProvider)
+	}
+}
+
+// warnIfCAPinsStale logs a warning if none of the configured controller CA
+// pins match a CA the PKI manager just observed issuing the agent's mTLS
+// client certificate. This is advisory only: pins keep guarding the
+// existing TLS verification path regardless of what this finds.
+func warnIfCAPinsStale(pins []string, issuers []*x509.Certificate) {
+	if len(pins) == 0 || len(issuers) == 0 {
+		return
+	}
+	for _, pin := range pins {
+		normalized := strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(pin)), "sha256:"), ":", "")
+		want, err := hex.DecodeString(normalized)
+		if err != nil {
+			continue
+		}
+		for _, cert := range issuers {
+			hash := sha256.Sum256(cert.Raw)
+			if bytes.Equal(hash[:], want) {
+				return
+			}
+		}
+	}
+	log.Printf("pki: configured controller-ca-pins do not match any CA in the ACME-issued trust chain; step-ca's roots may differ from what controller-ca-pins expects")
+}
+
+// rotateEncryptionKey re-wraps the persisted agent token's DEK under the
+// ring's active KEK. cfg.EncryptionRotateTo must match the active KeyID as
+// a safety check, so a stale or misconfigured flag can't silently rotate
+// state onto the wrong key.
+func rotateEncryptionKey(ctx context.Context, cfg config.Config, ring *state.KeyRing, store *state.Store) error {
+	active := ring.Active()
+	if active.KeyID() != cfg.EncryptionRotateTo {
+		return fmt.Errorf("encryption-rotate-to %q does not match the active key id %q", cfg.EncryptionRotateTo, active.KeyID())
+	}
+	return store.Rotate(ctx, active.KeyID())
+}
+
+// buildAuthMethod selects the auto-auth Method named by cfg.AuthMethod.
+func buildAuthMethod(cfg config.Config) (auth.Method, error) {
+	switch cfg.AuthMethod {
+	case "", "static":
+		return &auth.StaticMethod{Token: cfg.AgentToken}, nil
+	case "aws-iam":
+		return &auth.AWSIAMMethod{Role: cfg.AuthAWSRole}, nil
+	case "gcp-jwt":
+		if cfg.AuthGCPAudience == "" {
+			return nil, fmt.Errorf("auth-gcp-audience is required for the gcp-jwt auth method")
+		}
+		return &auth.GCPMethod{Audience: cfg.AuthGCPAudience}, nil
+	case "azure-imds":
+		return &auth.AzureIMDSMethod{Resource: cfg.AuthAzureResource}, nil
+	case "oci-instance-principal":
+		return &auth.OCIInstancePrincipalMethod{}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth method %q", cfg.AuthMethod)
+	}
+}
+
+// buildAuthSinks assembles the Sinks the auth Runner fans each renewed
+// token out to; the state store is always included so the persisted agent
+// token is replaced on every registration and renewal.
+func buildAuthSinks(cfg config.Config, store *state.Store, cipher state.Cipher) []auth.Sink {
+	sinks := []auth.Sink{&auth.StateSink{Store: store}}
+	if cfg.AuthTokenFile != "" {
+		sinks = append(sinks, &auth.FileSink{Path: cfg.AuthTokenFile, Cipher: cipher})
 	}
+	if cfg.AuthTokenSocket != "" {
+		sinks = append(sinks, &auth.UnixSocketSink{Path: cfg.AuthTokenSocket})
+	}
+	return sinks
+}
 
-	return store.SetAgent(resp.AgentID, resp.AgentToken)
+// buildAuditLogger assembles the audit.Logger's sink fan-out and optional
+// signing from cfg; pkiManager may be nil if audit-sign-records was set
+// without also enabling ACME enrollment, which is rejected below since a
+// signer with no certificate can never produce a signature.
+func buildAuditLogger(cfg config.Config, client *controller.Client, agentID string, pkiManager *pki.Manager, cipher state.Cipher) (*audit.Logger, error) {
+	opts := []audit.Option{audit.WithAgentID(agentID)}
+	if len(cfg.AuditRedactFields) > 0 {
+		opts = append(opts, audit.WithRedactor(audit.NewRedactor(cfg.AuditRedactFields)))
+	}
+	if cfg.AuditMaxSizeMB > 0 || cfg.AuditMaxAgeHours > 0 {
+		opts = append(opts, audit.WithRotation(cfg.AuditMaxSizeMB, cfg.AuditMaxAgeHours, cfg.AuditKeep))
+	}
+	if cfg.AuditSyslogAddr != "" {
+		sink, err := audit.NewSyslogSink(cfg.AuditSyslogNetwork, cfg.AuditSyslogAddr)
+		if err != nil {
+			return nil, fmt.Errorf("audit syslog sink: %w", err)
+		}
+		opts = append(opts, audit.WithSink(sink))
+	}
+	if cfg.AuditUnixSocketPath != "" {
+		sink, err := audit.NewUnixSocketSink(cfg.AuditUnixSocketPath)
+		if err != nil {
+			return nil, fmt.Errorf("audit unix socket sink: %w", err)
+		}
+		opts = append(opts, audit.WithSink(sink))
+	}
+	if cfg.AuditHTTPSPush {
+		spoolDir := cfg.AuditSpoolDir
+		if spoolDir == "" {
+			spoolDir = filepath.Join(cfg.DataDir, "audit-spool")
+		}
+		sink, err := audit.NewHTTPSSink(client, agentID, spoolDir)
+		if err != nil {
+			return nil, fmt.Errorf("audit https sink: %w", err)
+		}
+		opts = append(opts, audit.WithSink(sink))
+	}
+	if cfg.AuditSignRecords {
+		if pkiManager == nil {
+			return nil, errors.New("audit-sign-records requires pki-acme-directory so a signing certificate is available")
+		}
+		opts = append(opts, audit.WithSigner(pkiManager, cfg.AuditSignEvery))
+	}
+	if cfg.AuditSignArchives {
+		if cipher == nil {
+			return nil, errors.New("audit-sign-archives requires state encryption to be configured so a cipher is available to protect the signing key")
+		}
+		keyPath := filepath.Join(cfg.DataDir, "audit-archive-signing-key.enc")
+		opts = append(opts, audit.WithArchiveSigner(state.NewArchiveSigner(cipher, keyPath)))
+		if cfg.AuditAnchorIntervalMins > 0 {
+			opts = append(opts, audit.WithAnchorInterval(time.Duration(cfg.AuditAnchorIntervalMins)*time.Minute))
+		}
+	}
+	return audit.NewLogger(cfg.AuditLogPath, opts...)
 }
 
-func sendHeartbeat(ctx context.Context, handler *jobs.Handler, client *controller.Client, dockerManager *dockerutil.Manager, agentID string, capabilities []string) error {
+func sendHeartbeat(ctx context.Context, handler *jobs.Handler, jobPool *pool.Pool, client *controller.Client, dockerManager *dockerutil.Manager, shipper *logshipper.Shipper, agentID string, capabilities []string, registry *metrics.Registry, controllerReachable *atomic.Bool) error {
 	hbCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 
@@ -174,11 +643,33 @@ func sendHeartbeat(ctx context.Context, handler *jobs.Handler, client *controlle
 	if err != nil {
 		return fmt.Errorf("collect metrics: %w", err)
 	}
+	registry.ObserveHost(snap)
 
 	inventory, err := dockerManager.Inventory(hbCtx)
 	if err != nil {
 		return fmt.Errorf("inventory: %w", err)
 	}
+	wireInventory := make([]controller.InventoryResource, len(inventory))
+	for i, r := range inventory {
+		wireInventory[i] = controller.InventoryResource{
+			Name:         r.Name,
+			Image:        r.Image,
+			Ports:        r.Ports,
+			Status:       r.Status,
+			Health:       r.Health,
+			RestartCount: r.RestartCount,
+		}
+	}
+	registry.ObserveInventory(wireInventory)
+	observeManagedContainerStats(hbCtx, dockerManager, registry)
+
+	counters := jobPool.Counters()
+	jobQueue := metrics.FlattenJobQueue(jobTypeCounts(counters.Running), jobTypeCounts(counters.Queued), jobTypeCounts(counters.Retrying))
+	registry.ObserveJobQueue(jobQueue)
+	wireJobQueue := make([]controller.JobQueueDepth, len(jobQueue))
+	for i, d := range jobQueue {
+		wireJobQueue[i] = controller.JobQueueDepth{Type: d.Type, Running: d.Running, Queued: d.Queued, Retrying: d.Retrying}
+	}
 
 	req := controller.HeartbeatRequest{
 		Metrics: controller.Metrics{
@@ -186,11 +677,15 @@ func sendHeartbeat(ctx context.Context, handler *jobs.Handler, client *controlle
 			MemPercent: snap.MemPercent,
 			DiskFreeGB: snap.DiskFreeGB,
 		},
-		Inventory: inventory,
+		Inventory:    wireInventory,
 		Capabilities: capabilities,
+		JobQueue:     wireJobQueue,
 	}
 
+	rpcStart := time.Now()
 	resp, err := client.Heartbeat(hbCtx, agentID, req)
+	registry.ObserveControllerRPC("heartbeat", time.Since(rpcStart))
+	controllerReachable.Store(err == nil)
 	if err != nil {
 		return fmt.Errorf("controller heartbeat: %w", err)
 	}
@@ -199,37 +694,65 @@ func sendHeartbeat(ctx context.Context, handler *jobs.Handler, client *controlle
 		return nil
 	}
 
-	jobCtx, cancelJob := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancelJob()
-
 	log.Printf("received job %s (%s)", resp.Job.ID, resp.Job.Type)
 	// Convert controller.Job to internal jobs.Job type
 	job := &jobs.Job{ID: resp.Job.ID, Type: jobs.JobType(resp.Job.Type), Payload: resp.Job.Payload}
-	result, jobErr := handler.Handle(jobCtx, job)
-	status := controller.AckSucceeded
-	var detail interface{} = result
-	if jobErr != nil {
-		status = controller.AckFailed
-		detail = map[string]any{"error": jobErr.Error()}
-	}
-
-	if err := client.AckJob(jobCtx, agentID, resp.Job.ID, status, detail); err != nil {
-		return fmt.Errorf("ack job: %w", err)
-	}
 
-	if jobErr != nil {
-		return jobErr
-	}
+	// jobCtx is deliberately detached from ctx (which is cancelled on
+	// SIGINT/SIGTERM) rather than derived from it: the job pool may still
+	// be running this job, possibly behind other queued work for the same
+	// service, well after the heartbeat loop has returned to start its
+	// graceful drain, and a shutdown signal shouldn't yank the rug out
+	// from under a deploy that's already in progress.
+	jobCtx, cancelJob := context.WithTimeout(context.Background(), 10*time.Minute)
+	jobStart := time.Now()
+	jobPool.Submit(jobCtx, job, func(res pool.Result) {
+		defer cancelJob()
+		registry.ObserveJob(string(job.Type), jobOutcome(res), time.Since(jobStart))
+		registry.ObserveJobWait(string(job.Type), res.QueuedFor)
+		ackJobResult(jobCtx, client, shipper, agentID, res)
+	})
 	return nil
 }
 
-type controllerLogPublisher struct {
-	client *controller.Client
-	agentID string
+// jobOutcome labels a pool.Result for the deploybot_jobs_total counter.
+func jobOutcome(res pool.Result) string {
+	switch {
+	case res.Unclaimed:
+		return "unclaimed"
+	case res.Err != nil:
+		return "failed"
+	default:
+		return "succeeded"
+	}
 }
 
-func (p *controllerLogPublisher) Publish(ctx context.Context, jobID string, reader io.Reader) error {
-	return p.client.StreamLogs(ctx, p.agentID, jobID, reader)
+// ackJobResult reports a pool.Result back to the controller, truncating
+// the local log-shipper buffer once the ack lands. It runs from the job
+// pool's onComplete callback, independent of the heartbeat that submitted
+// the job, so its errors are only logged rather than returned anywhere.
+func ackJobResult(ctx context.Context, client *controller.Client, shipper *logshipper.Shipper, agentID string, res pool.Result) {
+	status := controller.AckSucceeded
+	var detail interface{} = res.Output
+	switch {
+	case res.Unclaimed:
+		status = controller.AckUnclaimed
+		detail = map[string]any{"error": "agent draining: job never started"}
+	case res.Err != nil:
+		status = controller.AckFailed
+		detail = map[string]any{"error": res.Err.Error()}
+	}
+
+	logSeq := shipper.LastSeq(res.Job.ID)
+	if err := client.AckJob(ctx, agentID, res.Job.ID, status, detail, logSeq); err != nil {
+		log.Printf("ack job %s: %v", res.Job.ID, err)
+		return
+	}
+	if logSeq > 0 {
+		if err := shipper.AckUpTo(res.Job.ID, logSeq); err != nil {
+			log.Printf("truncate log buffer for job %s: %v", res.Job.ID, err)
+		}
+	}
 }
 
 func buildCapabilities(cfg config.Config) []string {
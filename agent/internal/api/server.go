@@ -0,0 +1,87 @@
+// Package api serves a deliberately small subset of the Docker Engine /
+// Podman libpod REST API over a local Unix socket, so existing docker/podman
+// CLIs and Compose tooling can point DOCKER_HOST at a running agent and
+// drive the same Docker daemon the agent itself manages - without bypassing
+// the agent's own policy and audit trail. Every request is translated into
+// the same dockerutil.Manager calls the controller-driven job dispatcher in
+// internal/jobs uses, reusing Handler's image-policy, volume-root, and
+// digest checks plus its audit logger via the exported wrappers in
+// jobs/api_support.go. This is a compatibility surface for local tooling,
+// not a general-purpose remote API: it only ever listens on a Unix socket,
+// never TCP.
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"deploybot-agent/internal/dockerutil"
+	"deploybot-agent/internal/jobs"
+)
+
+// Config configures the Docker/Podman-compatible API server.
+type Config struct {
+	// SocketPath is the Unix socket to listen on. A Server is only useful
+	// when this is set; callers should skip constructing one otherwise.
+	SocketPath string
+	// SocketMode restricts who can dial SocketPath once created; 0 leaves
+	// the umask-determined default in place.
+	SocketMode os.FileMode
+}
+
+// Server is the Docker/Podman-compatible HTTP server.
+type Server struct {
+	httpSrv  *http.Server
+	listener net.Listener
+}
+
+// NewServer builds a Server backed by handler and docker, listening on
+// cfg.SocketPath. It removes a stale socket file left behind by a previous
+// run before binding. Call Serve to start accepting connections.
+func NewServer(handler *jobs.Handler, docker *dockerutil.Manager, cfg Config) (*Server, error) {
+	if cfg.SocketPath == "" {
+		return nil, fmt.Errorf("api: socket path is required")
+	}
+	if err := os.Remove(cfg.SocketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("api: remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", cfg.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("api: listen on %s: %w", cfg.SocketPath, err)
+	}
+	if cfg.SocketMode != 0 {
+		if err := os.Chmod(cfg.SocketPath, cfg.SocketMode); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("api: chmod socket: %w", err)
+		}
+	}
+
+	h := &handlers{handler: handler, docker: docker}
+	return &Server{
+		httpSrv:  &http.Server{Handler: newRouter(h)},
+		listener: listener,
+	}, nil
+}
+
+// Serve accepts connections until ctx is cancelled, then shuts the server
+// down gracefully. It never returns http.ErrServerClosed as an error.
+func (s *Server) Serve(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if err := s.httpSrv.Serve(s.listener); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+			return
+		}
+		errCh <- nil
+	}()
+
+	select {
+	case <-ctx.Done():
+		return s.httpSrv.Shutdown(context.Background())
+	case err := <-errCh:
+		return err
+	}
+}
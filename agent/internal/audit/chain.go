@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// canonicalRecordBytes produces a deterministic JSON encoding of rec's
+// content fields (everything except Hash/Signature, which depend on it),
+// so hash_n = SHA256(hash_{n-1} || canonicalRecordBytes(record_n)) is
+// reproducible by any verifier re-deriving the chain. Map key order is the
+// only thing encoding/json doesn't already fix deterministically for a
+// struct, so Fields is re-marshalled with sorted keys.
+func canonicalRecordBytes(rec Record) ([]byte, error) {
+	sortedFields, err := sortedFieldsJSON(rec.Fields)
+	if err != nil {
+		return nil, err
+	}
+	canonical := struct {
+		Seq       uint64          `json:"seq"`
+		Time      string          `json:"time"`
+		MonoNanos int64           `json:"mono_nanos"`
+		AgentID   string          `json:"agent_id,omitempty"`
+		JobID     string          `json:"job_id,omitempty"`
+		Event     string          `json:"event"`
+		Fields    json.RawMessage `json:"fields,omitempty"`
+		PrevHash  string          `json:"prev_hash"`
+	}{
+		Seq:       rec.Seq,
+		Time:      rec.Time.Format("2006-01-02T15:04:05.000000000Z07:00"),
+		MonoNanos: rec.MonoNanos,
+		AgentID:   rec.AgentID,
+		JobID:     rec.JobID,
+		Event:     rec.Event,
+		Fields:    sortedFields,
+		PrevHash:  rec.PrevHash,
+	}
+	return json.Marshal(canonical)
+}
+
+// sortedFieldsJSON marshals fields as a JSON object with keys in sorted
+// order, since map iteration order (and therefore encoding/json's default
+// output) is not stable across runs.
+func sortedFieldsJSON(fields map[string]interface{}) (json.RawMessage, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyJSON, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		valJSON, err := json.Marshal(fields[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(keyJSON)
+		buf.WriteByte(':')
+		buf.Write(valJSON)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// chainHash computes hash_n = SHA256(hash_{n-1} || canonical_json(record_n)).
+func chainHash(prevHash string, rec Record) (string, error) {
+	canonical, err := canonicalRecordBytes(rec)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// chainState is the small sidecar persisted next to the audit log so a
+// restarted agent resumes the hash chain instead of silently starting a
+// new one - which would make every record since the last restart look like
+// a truncation to a verifier replaying the whole chain. StartedAt anchors
+// age-based rotation the same way, surviving restarts instead of resetting
+// the rotation clock every time the agent starts.
+type chainState struct {
+	Genesis   string    `json:"genesis"`
+	LastSeq   uint64    `json:"last_seq"`
+	LastHash  string    `json:"last_hash"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+func loadOrInitChainState(path string) (chainState, error) {
+	if path == "" {
+		return freshChainState()
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		st, err := freshChainState()
+		if err != nil {
+			return chainState{}, err
+		}
+		return st, saveChainState(path, st)
+	}
+	if err != nil {
+		return chainState{}, err
+	}
+	var st chainState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return chainState{}, err
+	}
+	if st.StartedAt.IsZero() {
+		// Chain state written before StartedAt existed; start the
+		// rotation age clock now rather than treating it as already due.
+		st.StartedAt = time.Now().UTC()
+	}
+	return st, nil
+}
+
+func freshChainState() (chainState, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return chainState{}, err
+	}
+	genesis := hex.EncodeToString(buf)
+	return chainState{Genesis: genesis, LastHash: genesis, StartedAt: time.Now().UTC()}, nil
+}
+
+func saveChainState(path string, st chainState) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
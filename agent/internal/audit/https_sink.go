@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHTTPSBatchSize     = 100
+	defaultHTTPSFlushInterval = 5 * time.Second
+	defaultSpoolMaxItems      = 5000
+)
+
+// AuditPusher ships a batch of spooled audit records to the controller.
+// *controller.Client satisfies this with its PushAudit method; HTTPSSink
+// depends on the interface rather than importing the controller package
+// directly, since the only thing it needs is this one RPC.
+type AuditPusher interface {
+	PushAudit(ctx context.Context, agentID string, records []json.RawMessage) error
+}
+
+// HTTPSSink pushes audit records to the controller in batches, backed by a
+// bounded on-disk spool (auditSpool) so records survive an offline period
+// instead of being dropped the moment the controller is unreachable.
+// Write only appends to the spool and returns, so a stalled controller
+// connection never blocks Logger.Log; a background goroutine drains the
+// spool at its own pace.
+type HTTPSSink struct {
+	client  AuditPusher
+	agentID string
+	spool   *auditSpool
+
+	batchSize     int
+	flushInterval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHTTPSSink opens a spool under spoolDir and starts the background
+// flusher; cancel it via Close.
+func NewHTTPSSink(client AuditPusher, agentID, spoolDir string) (*HTTPSSink, error) {
+	spool, err := openAuditSpool(spoolDir, defaultSpoolMaxItems)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &HTTPSSink{
+		client:        client,
+		agentID:       agentID,
+		spool:         spool,
+		batchSize:     defaultHTTPSBatchSize,
+		flushInterval: defaultHTTPSFlushInterval,
+		cancel:        cancel,
+	}
+	s.wg.Add(1)
+	go s.flushLoop(ctx)
+	return s, nil
+}
+
+func (s *HTTPSSink) Write(ctx context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.spool.Push(data)
+}
+
+func (s *HTTPSSink) flushLoop(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.flushOnce(context.Background())
+			return
+		case <-ticker.C:
+			s.flushOnce(ctx)
+		}
+	}
+}
+
+func (s *HTTPSSink) flushOnce(ctx context.Context) {
+	for {
+		batch := s.spool.Batch(s.batchSize)
+		if len(batch) == 0 {
+			return
+		}
+		pushCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+		err := s.client.PushAudit(pushCtx, s.agentID, batch)
+		cancel()
+		if err != nil {
+			log.Printf("audit: push to controller failed, will retry from spool: %v", err)
+			return
+		}
+		if err := s.spool.Ack(len(batch)); err != nil {
+			log.Printf("audit: failed to truncate spool after push: %v", err)
+			return
+		}
+		if len(batch) < s.batchSize {
+			return
+		}
+	}
+}
+
+func (s *HTTPSSink) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return s.spool.Close()
+}
@@ -1,60 +1,273 @@
+// Package audit provides a tamper-evident, streamable audit log for the
+// agent: every record carries a monotonic sequence number and chains via
+// SHA-256 from the record before it, so a gap or edit anywhere in the
+// history is detectable by recomputing the chain (see Verify/VerifyChain).
+// Records can optionally be signed with the agent's mTLS key (see
+// internal/pki) and are fanned out to one or more pluggable Sinks (local
+// file, syslog, HTTPS push to the controller, Unix socket) after secrets
+// are redacted. The local file can be rotated by size and/or age (see
+// WithRotation), continuing the same hash chain into each new file and
+// optionally signing each rotated-out archive as a whole (see
+// WithArchiveSigner). WithAnchorInterval additionally emits a signed
+// audit.anchor record over the live chain's head hash on a schedule,
+// independent of rotation.
 package audit
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
 	"sync"
 	"time"
 )
 
-// Logger persists structured audit events as JSON lines using a persistent file handle.
+// Signer signs data, e.g. with the agent's current mTLS client certificate
+// private key (pki.Manager implements this), letting a verifier prove a
+// record was produced by this specific agent rather than forged after the
+// fact by anything with filesystem access to the audit log.
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// Logger persists structured, hash-chained audit events, fanned out to
+// every configured Sink.
 type Logger struct {
-	mu   sync.Mutex
-	file *os.File
+	mu        sync.Mutex
+	sinks     []Sink
+	redactor  *Redactor
+	signer    Signer
+	signEvery int // sign every Nth record; <=1 means sign every record
+
+	agentID   string
+	path      string
+	chainPath string
+	seq       uint64
+	prevHash  string
+	startedAt time.Time
+
+	fileSink      *FileSink
+	rot           *rotator
+	archiveSigner ArchiveSigner
+
+	anchorInterval time.Duration
+	lastAnchorAt   time.Time
+}
+
+// Option configures a Logger built by NewLogger.
+type Option func(*Logger)
+
+// WithSink registers an additional Sink; the local file sink (if path was
+// non-empty) is always included first.
+func WithSink(s Sink) Option { return func(l *Logger) { l.sinks = append(l.sinks, s) } }
+
+// WithRedactor overrides the default secret-field deny-list.
+func WithRedactor(r *Redactor) Option { return func(l *Logger) { l.redactor = r } }
+
+// WithSigner enables per-record signing, signing every Nth record when
+// every > 1 to bound the signing cost on a busy agent; every <= 1 signs
+// every record.
+func WithSigner(signer Signer, every int) Option {
+	return func(l *Logger) {
+		l.signer = signer
+		l.signEvery = every
+	}
 }
 
-// NewLogger initialises an audit logger writing to the given path.
-func NewLogger(path string) (*Logger, error) {
-	if path == "" {
-		return &Logger{}, nil
+// WithAgentID stamps every record with agentID; see SetAgentID for setting
+// this after the agent has registered and learned its ID.
+func WithAgentID(agentID string) Option { return func(l *Logger) { l.agentID = agentID } }
+
+// WithRotation enables size- and/or time-based rotation of the local audit
+// file: once it reaches maxSizeMB or has been active for maxAgeHours,
+// Logger writes a terminal "audit.rotate" record, renames the file to
+// audit-<timestamp>.jsonl, and starts a fresh file continuing the hash
+// chain from that terminal hash. keep caps how many archives are retained
+// (<=0 keeps them all). A zero maxSizeMB and maxAgeHours disables
+// rotation. Has no effect on a Logger built with path == "".
+func WithRotation(maxSizeMB, maxAgeHours, keep int) Option {
+	return func(l *Logger) {
+		if l.path == "" {
+			return
+		}
+		l.rot = newRotator(l.path, maxSizeMB, maxAgeHours, keep)
 	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return nil, err
+}
+
+// NewLogger initialises an audit logger. If path is non-empty, records are
+// always appended there as NDJSON (the agent's original audit storage
+// model) and the hash chain resumes from path's sidecar chain-state file
+// across restarts; pass additional Sinks via options for syslog/HTTPS/Unix
+// socket delivery. NewLogger("") with no sink options returns a no-op
+// Logger whose Log calls are cheap nil-checked skips.
+func NewLogger(path string, opts ...Option) (*Logger, error) {
+	l := &Logger{redactor: NewRedactor(nil), path: path}
+	if path != "" {
+		fileSink, err := NewFileSink(path)
+		if err != nil {
+			return nil, err
+		}
+		l.sinks = append(l.sinks, fileSink)
+		l.fileSink = fileSink
+		l.chainPath = path + ".chain.json"
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+
+	state, err := loadOrInitChainState(l.chainPath)
 	if err != nil {
 		return nil, err
 	}
-	return &Logger{file: f}, nil
+	l.seq = state.LastSeq
+	l.prevHash = state.LastHash
+	l.startedAt = state.StartedAt
+	l.lastAnchorAt = time.Now().UTC()
+	return l, nil
+}
+
+// SetAgentID stamps every subsequent record with agentID, for a Logger
+// constructed before registration has assigned one (otherwise WithAgentID
+// sets it at construction).
+func (l *Logger) SetAgentID(agentID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.agentID = agentID
 }
 
-// Close releases the underlying file handle.
+// Close releases every configured sink.
 func (l *Logger) Close() error {
-	if l == nil || l.file == nil {
+	if l == nil {
 		return nil
 	}
-	return l.file.Close()
+	var firstErr error
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
-// Log writes an audit entry with the supplied event name and metadata.
+// Log writes an audit entry with the supplied event name and metadata,
+// redacting secret fields, extending the hash chain, optionally signing,
+// and fanning the finished record out to every configured sink.
 func (l *Logger) Log(event string, fields map[string]interface{}) error {
-	if l == nil || l.file == nil {
+	if l == nil || len(l.sinks) == 0 {
 		return nil
 	}
-	entry := map[string]interface{}{
-		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
-		"event":     event,
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	rec := newRecord(l.seq, l.agentID, event, l.redactor.Redact(fields))
+	rec.PrevHash = l.prevHash
+
+	hash, err := chainHash(rec.PrevHash, rec)
+	if err != nil {
+		l.seq--
+		return err
+	}
+	rec.Hash = hash
+
+	if l.signer != nil && (l.signEvery <= 1 || l.seq%uint64(l.signEvery) == 0) {
+		sig, err := l.signer.Sign([]byte(hash))
+		if err != nil {
+			log.Printf("audit: failed to sign record %d: %v", l.seq, err)
+		} else {
+			rec.Signature = base64.StdEncoding.EncodeToString(sig)
+		}
+	}
+
+	l.prevHash = hash
+	if l.startedAt.IsZero() {
+		l.startedAt = time.Now().UTC()
+	}
+	if err := saveChainState(l.chainPath, chainState{LastSeq: l.seq, LastHash: l.prevHash, StartedAt: l.startedAt}); err != nil {
+		log.Printf("audit: failed to persist chain state: %v", err)
+	}
+
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Write(context.Background(), rec); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if l.anchorDueLocked() {
+		if err := l.writeAnchorLocked(); err != nil {
+			log.Printf("audit: anchor failed: %v", err)
+		}
 	}
-	for k, v := range fields {
-		entry[k] = v
+
+	if l.rot != nil && l.rot.due(l.startedAt) {
+		if err := l.rotateLocked(); err != nil {
+			log.Printf("audit: rotation failed: %v", err)
+		}
 	}
-	data, err := json.Marshal(entry)
+	return firstErr
+}
+
+// rotateLocked writes a terminal "audit.rotate" record, archives the
+// active file, optionally signs the archive, and opens a fresh file that
+// continues the hash chain from the terminal record's hash. Called from
+// Log with l.mu already held.
+func (l *Logger) rotateLocked() error {
+	now := time.Now().UTC()
+
+	l.seq++
+	rec := newRecord(l.seq, l.agentID, "audit.rotate", map[string]interface{}{"rotated_at": now.Format(time.RFC3339)})
+	rec.PrevHash = l.prevHash
+	hash, err := chainHash(rec.PrevHash, rec)
 	if err != nil {
+		l.seq--
 		return err
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	_, err = l.file.Write(append(data, '\n'))
-	return err
+	rec.Hash = hash
+	if l.signer != nil && (l.signEvery <= 1 || l.seq%uint64(l.signEvery) == 0) {
+		if sig, err := l.signer.Sign([]byte(hash)); err != nil {
+			log.Printf("audit: failed to sign rotate record %d: %v", l.seq, err)
+		} else {
+			rec.Signature = base64.StdEncoding.EncodeToString(sig)
+		}
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Write(context.Background(), rec); err != nil {
+			log.Printf("audit: failed to write rotate record to a sink: %v", err)
+		}
+	}
+	terminalHash := hash
+
+	if err := l.fileSink.Close(); err != nil {
+		return fmt.Errorf("close audit file before rotation: %w", err)
+	}
+	archivePath, err := l.rot.archive(now)
+	if err != nil {
+		return fmt.Errorf("archive audit file: %w", err)
+	}
+	if l.archiveSigner != nil {
+		if err := signArchive(l.archiveSigner, archivePath); err != nil {
+			log.Printf("audit: failed to sign archive %s: %v", archivePath, err)
+		}
+	}
+
+	newSink, err := NewFileSink(l.path)
+	if err != nil {
+		return fmt.Errorf("open new audit file after rotation: %w", err)
+	}
+	for i, s := range l.sinks {
+		if s == Sink(l.fileSink) {
+			l.sinks[i] = newSink
+			break
+		}
+	}
+	l.fileSink = newSink
+
+	l.prevHash = terminalHash
+	l.startedAt = now
+	if err := saveChainState(l.chainPath, chainState{LastSeq: l.seq, LastHash: l.prevHash, StartedAt: l.startedAt}); err != nil {
+		log.Printf("audit: failed to persist chain state after rotation: %v", err)
+	}
+	log.Printf("audit: rotated %s -> %s", l.path, archivePath)
+	return nil
 }
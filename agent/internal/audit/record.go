@@ -0,0 +1,40 @@
+package audit
+
+import "time"
+
+// processStart anchors Record.MonoNanos to process start rather than the
+// Unix epoch, so the monotonic timestamp stays meaningful even if the
+// system clock jumps or is adjusted by NTP between records.
+var processStart = time.Now()
+
+// Record is a single tamper-evident audit entry. Hash chains from
+// PrevHash, covering the canonical JSON encoding of every field below it
+// (see canonicalRecordBytes) so any gap, reorder, or edit is detectable by
+// recomputing the chain from a known-good prefix.
+type Record struct {
+	Seq       uint64                 `json:"seq"`
+	Time      time.Time              `json:"time"`
+	MonoNanos int64                  `json:"mono_nanos"`
+	AgentID   string                 `json:"agent_id,omitempty"`
+	JobID     string                 `json:"job_id,omitempty"`
+	Event     string                 `json:"event"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	PrevHash  string                 `json:"prev_hash"`
+	Hash      string                 `json:"hash"`
+	Signature string                 `json:"signature,omitempty"`
+}
+
+func newRecord(seq uint64, agentID, event string, fields map[string]interface{}) Record {
+	rec := Record{
+		Seq:       seq,
+		Time:      time.Now().UTC(),
+		MonoNanos: int64(time.Since(processStart)),
+		AgentID:   agentID,
+		Event:     event,
+		Fields:    fields,
+	}
+	if jobID, ok := fields["job_id"].(string); ok {
+		rec.JobID = jobID
+	}
+	return rec
+}
@@ -0,0 +1,48 @@
+package audit
+
+import "strings"
+
+const redactedValue = "[REDACTED]"
+
+// defaultDenyList covers the field names audit events in this codebase are
+// already known to carry (see jobs.Handler's h.audit call sites).
+var defaultDenyList = []string{
+	"token", "agent_token", "password", "secret", "api_key", "private_key",
+}
+
+// Redactor masks field values whose name (case-insensitively) appears on
+// DenyList before a record is hashed or written to any sink, so secrets
+// never end up signed, chained, or shipped off-box.
+type Redactor struct {
+	denyList map[string]struct{}
+}
+
+// NewRedactor builds a Redactor from names, falling back to
+// defaultDenyList when names is empty.
+func NewRedactor(names []string) *Redactor {
+	if len(names) == 0 {
+		names = defaultDenyList
+	}
+	r := &Redactor{denyList: make(map[string]struct{}, len(names))}
+	for _, n := range names {
+		r.denyList[strings.ToLower(n)] = struct{}{}
+	}
+	return r
+}
+
+// Redact returns a shallow copy of fields with denied keys masked, leaving
+// the original map untouched for the caller.
+func (r *Redactor) Redact(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return fields
+	}
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if _, denied := r.denyList[strings.ToLower(k)]; denied {
+			out[k] = redactedValue
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
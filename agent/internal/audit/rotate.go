@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ArchiveSigner signs the full contents of a rotated audit file, producing
+// a detached signature written alongside the archive as "<archive>.sig" -
+// distinct from Signer, which signs individual record hashes as they're
+// written. Optional; NewArchiveSigner in internal/state derives one from
+// the same keyring used for state envelope encryption.
+type ArchiveSigner interface {
+	SignArchive(data []byte) ([]byte, error)
+}
+
+// WithArchiveSigner enables signing of each rotated-out audit file.
+func WithArchiveSigner(s ArchiveSigner) Option {
+	return func(l *Logger) { l.archiveSigner = s }
+}
+
+// rotator owns size/age-based rotation of the Logger's local audit file,
+// renaming the rotated-out file to audit-<timestamp>.jsonl in the same
+// directory and pruning archives beyond keep.
+type rotator struct {
+	path     string
+	dir      string
+	ext      string
+	maxBytes int64
+	maxAge   time.Duration
+	keep     int
+}
+
+// newRotator returns nil if neither threshold is configured, so callers
+// can skip rotation entirely with a single nil check.
+func newRotator(path string, maxSizeMB, maxAgeHours, keep int) *rotator {
+	if maxSizeMB <= 0 && maxAgeHours <= 0 {
+		return nil
+	}
+	return &rotator{
+		path:     path,
+		dir:      filepath.Dir(path),
+		ext:      filepath.Ext(path),
+		maxBytes: int64(maxSizeMB) * 1024 * 1024,
+		maxAge:   time.Duration(maxAgeHours) * time.Hour,
+		keep:     keep,
+	}
+}
+
+// due reports whether the active file has crossed either rotation
+// threshold, re-statting the file rather than tracking bytes written in
+// memory so it stays correct across an agent restart.
+func (r *rotator) due(startedAt time.Time) bool {
+	if r == nil {
+		return false
+	}
+	if r.maxBytes > 0 {
+		if info, err := os.Stat(r.path); err == nil && info.Size() >= r.maxBytes {
+			return true
+		}
+	}
+	if r.maxAge > 0 && !startedAt.IsZero() && time.Since(startedAt) >= r.maxAge {
+		return true
+	}
+	return false
+}
+
+// archive renames r.path to audit-<timestamp>.jsonl and prunes archives
+// beyond r.keep (<=0 keeps every archive).
+func (r *rotator) archive(now time.Time) (string, error) {
+	archivePath := filepath.Join(r.dir, fmt.Sprintf("audit-%s%s", now.Format("20060102T150405Z"), r.ext))
+	if err := os.Rename(r.path, archivePath); err != nil {
+		return "", err
+	}
+	if r.keep > 0 {
+		if err := r.prune(); err != nil {
+			return archivePath, err
+		}
+	}
+	return archivePath, nil
+}
+
+func (r *rotator) prune() error {
+	matches, err := filepath.Glob(filepath.Join(r.dir, "audit-*"+r.ext))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches) // the timestamp suffix sorts chronologically
+	if len(matches) <= r.keep {
+		return nil
+	}
+	for _, old := range matches[:len(matches)-r.keep] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func signArchive(signer ArchiveSigner, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig, err := signer.SignArchive(data)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(sig) + "\n"
+	return os.WriteFile(path+".sig", []byte(encoded), 0o600)
+}
@@ -0,0 +1,13 @@
+package audit
+
+import "context"
+
+// Sink receives every finalized Record (already hashed, redacted, and
+// optionally signed) for durable storage or forwarding. Write should not
+// block the caller indefinitely; sinks that talk to a remote endpoint
+// (HTTPSSink) queue internally and apply their own backpressure/spool
+// policy instead of stalling Logger.Log.
+type Sink interface {
+	Write(ctx context.Context, rec Record) error
+	Close() error
+}
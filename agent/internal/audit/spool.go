@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// auditSpool is HTTPSSink's bounded on-disk queue, letting audit records
+// keep accumulating (durably, across restarts) while the controller is
+// unreachable. It mirrors logshipper's ring buffer: an append-only JSONL
+// file plus a small state file tracking how much of it has been
+// successfully pushed.
+type auditSpool struct {
+	mu       sync.Mutex
+	dir      string
+	maxItems int
+	acked    int
+	items    []json.RawMessage
+	file     *os.File
+}
+
+type spoolState struct {
+	Acked int `json:"acked"`
+}
+
+func openAuditSpool(dir string, maxItems int) (*auditSpool, error) {
+	if maxItems <= 0 {
+		maxItems = 5000
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	sp := &auditSpool{dir: dir, maxItems: maxItems}
+	if err := sp.loadState(); err != nil {
+		return nil, err
+	}
+	if err := sp.loadItems(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(sp.itemsPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	sp.file = f
+	return sp, nil
+}
+
+func (sp *auditSpool) statePath() string { return filepath.Join(sp.dir, "state.json") }
+func (sp *auditSpool) itemsPath() string { return filepath.Join(sp.dir, "pending.jsonl") }
+
+func (sp *auditSpool) loadState() error {
+	data, err := os.ReadFile(sp.statePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st spoolState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	sp.acked = st.Acked
+	return nil
+}
+
+func (sp *auditSpool) loadItems() error {
+	f, err := os.Open(sp.itemsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	idx := 0
+	for scanner.Scan() {
+		idx++
+		if idx <= sp.acked {
+			continue
+		}
+		line := append([]byte(nil), scanner.Bytes()...)
+		sp.items = append(sp.items, json.RawMessage(line))
+	}
+	return scanner.Err()
+}
+
+// Push appends rec to the spool, dropping the oldest unsent item once
+// maxItems is exceeded - the backpressure policy for a controller that's
+// been unreachable long enough to fill the spool.
+func (sp *auditSpool) Push(rec json.RawMessage) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if _, err := sp.file.Write(append(append([]byte(nil), rec...), '\n')); err != nil {
+		return err
+	}
+	sp.items = append(sp.items, rec)
+	if len(sp.items) > sp.maxItems {
+		drop := len(sp.items) - sp.maxItems
+		sp.items = sp.items[drop:]
+		return sp.compactLocked()
+	}
+	return nil
+}
+
+// Batch returns up to n unsent items for a flush attempt.
+func (sp *auditSpool) Batch(n int) []json.RawMessage {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if n > len(sp.items) {
+		n = len(sp.items)
+	}
+	out := make([]json.RawMessage, n)
+	copy(out, sp.items[:n])
+	return out
+}
+
+// Ack drops the first n items, called once the controller has confirmed
+// the batch was durably received.
+func (sp *auditSpool) Ack(n int) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if n <= 0 {
+		return nil
+	}
+	if n > len(sp.items) {
+		n = len(sp.items)
+	}
+	sp.items = sp.items[n:]
+	sp.acked += n
+	return sp.compactLocked()
+}
+
+func (sp *auditSpool) compactLocked() error {
+	if err := sp.file.Close(); err != nil {
+		return err
+	}
+	tmp := sp.itemsPath() + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	for _, item := range sp.items {
+		if _, err := f.Write(append(append([]byte(nil), item...), '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, sp.itemsPath()); err != nil {
+		return err
+	}
+	newFile, err := os.OpenFile(sp.itemsPath(), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	sp.file = newFile
+	sp.acked = 0
+	return sp.saveState()
+}
+
+func (sp *auditSpool) saveState() error {
+	data, err := json.Marshal(spoolState{Acked: sp.acked})
+	if err != nil {
+		return err
+	}
+	tmp := sp.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, sp.statePath())
+}
+
+func (sp *auditSpool) Close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.file == nil {
+		return nil
+	}
+	return sp.file.Close()
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	syslogFacilityAuth = 10 // RFC 5424 facility 10 = security/authorization messages
+	syslogSeverityInfo = 6
+)
+
+// SyslogSink forwards each Record as an RFC 5424 message to a syslog
+// collector, framed as the structured-data element so a record's JSON
+// survives intact for SIEM parsers that understand it, while MSG carries a
+// human-readable summary for everything else. Messages are formatted
+// directly rather than through the standard library's log/syslog, which
+// has no Windows implementation and no way to set our own APP-NAME/fixed
+// structured data.
+type SyslogSink struct {
+	network  string // "udp" or "tcp"
+	addr     string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink dials addr over network ("udp" or "tcp"); the connection is
+// re-established lazily on the next Write if it drops.
+func NewSyslogSink(network, addr string) (*SyslogSink, error) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	s := &SyslogSink{network: network, addr: addr, hostname: hostname}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial syslog collector: %w", err)
+	}
+	s.conn = conn
+	return s, nil
+}
+
+func (s *SyslogSink) Write(ctx context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	pri := syslogFacilityAuth*8 + syslogSeverityInfo
+	msg := fmt.Sprintf("<%d>1 %s %s deploybot-agent %s audit [record@32473 json=%q] %s",
+		pri,
+		rec.Time.Format(time.RFC3339Nano),
+		s.hostname,
+		rec.AgentID,
+		string(data),
+		rec.Event,
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, dialErr := net.Dial(s.network, s.addr)
+		if dialErr != nil {
+			return fmt.Errorf("reconnect to syslog collector: %w", dialErr)
+		}
+		s.conn = conn
+	}
+	if _, err := s.conn.Write([]byte(msg + "\n")); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("write to syslog collector: %w", err)
+	}
+	return nil
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
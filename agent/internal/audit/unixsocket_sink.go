@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// UnixSocketSink streams each Record as an NDJSON line over a Unix domain
+// socket, for a local SIEM shipper (e.g. a Vector/Filebeat sidecar) to
+// consume without parsing the on-disk file format.
+type UnixSocketSink struct {
+	path string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewUnixSocketSink dials the socket at path; like SyslogSink, the
+// connection is re-established lazily if a local shipper restarts.
+func NewUnixSocketSink(path string) (*UnixSocketSink, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("dial audit unix socket: %w", err)
+	}
+	return &UnixSocketSink{path: path, conn: conn}, nil
+}
+
+func (s *UnixSocketSink) Write(ctx context.Context, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, dialErr := net.Dial("unix", s.path)
+		if dialErr != nil {
+			return fmt.Errorf("reconnect audit unix socket: %w", dialErr)
+		}
+		s.conn = conn
+	}
+	if _, err := s.conn.Write(append(data, '\n')); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("write audit unix socket: %w", err)
+	}
+	return nil
+}
+
+func (s *UnixSocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
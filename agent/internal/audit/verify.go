@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Verify walks path's NDJSON records end-to-end, recomputing
+// hash_n = SHA256(hash_{n-1} || canonical_json(record_n)) for each line
+// and confirming it matches the record's stored Hash, and that each
+// record's PrevHash matches the record before it (except the first, which
+// is accepted as given - see VerifyChain to also check that against the
+// file that preceded it across a rotation). Returns the last record's Hash
+// so a caller can continue the check into the next file in an archive.
+func Verify(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var lastHash string
+	var lastSeq uint64
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return "", fmt.Errorf("%s:%d: decode record: %w", path, line, err)
+		}
+		if line > 1 && rec.PrevHash != lastHash {
+			return "", fmt.Errorf("%s:%d: prev_hash %q does not match preceding record's hash %q", path, line, rec.PrevHash, lastHash)
+		}
+		if line > 1 && rec.Seq != lastSeq+1 {
+			return "", fmt.Errorf("%s:%d: seq %d is not the preceding record's seq+1 (%d)", path, line, rec.Seq, lastSeq+1)
+		}
+		want := rec.Hash
+		rec.Hash = ""
+		got, err := chainHash(rec.PrevHash, rec)
+		if err != nil {
+			return "", fmt.Errorf("%s:%d: recompute hash: %w", path, line, err)
+		}
+		if got != want {
+			return "", fmt.Errorf("%s:%d: hash mismatch: record claims %q, recomputed %q", path, line, want, got)
+		}
+		lastHash = want
+		lastSeq = rec.Seq
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("%s: scan: %w", path, err)
+	}
+	return lastHash, nil
+}
+
+// VerifyChain verifies every rotated audit-<timestamp>.jsonl archive in
+// dir, oldest first, followed by the live file at activePath, confirming
+// each file's first record continues from the previous file's terminal
+// hash - the property that makes a rotated audit log verifiable as one
+// continuous chain rather than N independent ones.
+func VerifyChain(dir, activePath string) error {
+	ext := filepath.Ext(activePath)
+	matches, err := filepath.Glob(filepath.Join(dir, "audit-*"+ext))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches) // the timestamp suffix sorts chronologically
+	files := append(matches, activePath)
+
+	var prevTerminal string
+	for i, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			if i == len(files)-1 && os.IsNotExist(err) {
+				continue // a brand new agent may not have an active file yet
+			}
+			return err
+		}
+		firstPrevHash, err := firstRecordPrevHash(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if i > 0 && firstPrevHash != prevTerminal {
+			return fmt.Errorf("%s: first record's prev_hash %q does not continue from %s's terminal hash %q", path, firstPrevHash, files[i-1], prevTerminal)
+		}
+		terminal, err := Verify(path)
+		if err != nil {
+			return err
+		}
+		prevTerminal = terminal
+	}
+	return nil
+}
+
+func firstRecordPrevHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return "", err
+		}
+		return rec.PrevHash, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no records found")
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AWSIAMMethod authenticates via AWS IAM, Vault-style: it builds a signed
+// sts:GetCallerIdentity request using the instance's ambient credentials
+// (environment, EC2 instance profile, or container credentials) and hands
+// the controller the signed request to replay against AWS, so neither side
+// ever handles a long-lived AWS key.
+type AWSIAMMethod struct {
+	// Role, if set, is included so the controller can map the caller's AWS
+	// identity to a specific agent role/policy.
+	Role string
+}
+
+// awsIAMProof is the registration proof: a presigned GetCallerIdentity
+// request, serialised so the controller can replay it verbatim against AWS
+// to recover the caller's identity.
+type awsIAMProof struct {
+	Role    string      `json:"role,omitempty"`
+	Method  string      `json:"iam_request_method"`
+	URL     string      `json:"iam_request_url"`
+	Headers http.Header `json:"iam_request_headers"`
+}
+
+// presignedGetCallerIdentityTTL is how long a presigned STS request remains
+// valid; Runner re-authenticates a little before it expires.
+const presignedGetCallerIdentityTTL = 10 * time.Minute
+
+func (m *AWSIAMMethod) Authenticate(ctx context.Context) (string, time.Duration, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("load AWS config: %w", err)
+	}
+
+	presignClient := sts.NewPresignClient(sts.NewFromConfig(cfg))
+	presigned, err := presignClient.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", 0, fmt.Errorf("presign GetCallerIdentity: %w", err)
+	}
+
+	proof, err := json.Marshal(awsIAMProof{
+		Role:    m.Role,
+		Method:  presigned.Method,
+		URL:     presigned.URL,
+		Headers: presigned.SignedHeader,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("encode AWS IAM proof: %w", err)
+	}
+
+	return string(proof), presignedGetCallerIdentityTTL, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AzureIMDSMethod authenticates via Azure's Instance Metadata Service,
+// fetching a managed-identity access token the controller can validate
+// against Azure AD without either side handling a client secret.
+type AzureIMDSMethod struct {
+	// Resource is the Azure resource (API audience) to request a token for.
+	Resource string
+}
+
+type azureIMDSResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   string `json:"expires_in"`
+}
+
+type azureTokenProof struct {
+	AccessToken string `json:"access_token"`
+}
+
+const azureIMDSURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// azureIMDSFallbackTTL is used if the IMDS response omits expires_in.
+const azureIMDSFallbackTTL = time.Hour
+
+func (m *AzureIMDSMethod) Authenticate(ctx context.Context) (string, time.Duration, error) {
+	endpoint := azureIMDSURL + "?api-version=2018-02-01&resource=" + url.QueryEscape(m.Resource)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("fetch Azure IMDS token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("Azure IMDS returned %d", res.StatusCode)
+	}
+
+	var imds azureIMDSResponse
+	if err := json.NewDecoder(res.Body).Decode(&imds); err != nil {
+		return "", 0, fmt.Errorf("decode Azure IMDS response: %w", err)
+	}
+
+	proof, err := json.Marshal(azureTokenProof{AccessToken: imds.AccessToken})
+	if err != nil {
+		return "", 0, fmt.Errorf("encode Azure token proof: %w", err)
+	}
+
+	return string(proof), azureExpiry(imds.ExpiresIn), nil
+}
+
+func azureExpiry(expiresIn string) time.Duration {
+	seconds, err := parsePositiveSeconds(expiresIn)
+	if err != nil {
+		return azureIMDSFallbackTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
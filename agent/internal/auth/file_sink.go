@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"os"
+
+	"deploybot-agent/internal/state"
+)
+
+// FileSink mirrors the token into a plain file, optionally wrapped with the
+// same state.Cipher the agent uses for its own state, for co-located
+// tooling that only needs the bearer token rather than the full state file.
+type FileSink struct {
+	Path   string
+	Cipher state.Cipher
+}
+
+func (f *FileSink) Write(token []byte) error {
+	data := token
+	if f.Cipher != nil {
+		enc, err := f.Cipher.Encrypt(token)
+		if err != nil {
+			return err
+		}
+		data = []byte(enc)
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
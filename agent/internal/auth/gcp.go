@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GCPMethod authenticates via a GCE/GKE instance identity JWT fetched from
+// the metadata server; the controller verifies the JWT's signature against
+// Google's public keys and checks the audience/instance claims.
+type GCPMethod struct {
+	// Audience is requested as the JWT's "aud" claim; the controller
+	// rejects tokens minted for a different audience.
+	Audience string
+}
+
+type gcpJWTProof struct {
+	JWT string `json:"jwt"`
+}
+
+const gcpIdentityURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+
+// gcpIdentityTokenTTL mirrors the fixed lifetime of GCE/GKE instance
+// identity tokens.
+const gcpIdentityTokenTTL = time.Hour
+
+func (m *GCPMethod) Authenticate(ctx context.Context) (string, time.Duration, error) {
+	endpoint := gcpIdentityURL + "?audience=" + url.QueryEscape(m.Audience) + "&format=full"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("fetch GCP instance identity token: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("GCP metadata server returned %d", res.StatusCode)
+	}
+	jwt, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", 0, err
+	}
+
+	proof, err := json.Marshal(gcpJWTProof{JWT: string(jwt)})
+	if err != nil {
+		return "", 0, fmt.Errorf("encode GCP JWT proof: %w", err)
+	}
+
+	return string(proof), gcpIdentityTokenTTL, nil
+}
@@ -0,0 +1,18 @@
+// Package auth implements Vault-agent-style auto-auth: a pluggable Method
+// produces the bootstrap proof sent to the controller's existing agent
+// registration endpoint (a static token, or a short-lived signed cloud
+// identity document), and a Runner keeps re-authenticating before that
+// proof expires, fanning the resulting agent token out to every Sink.
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Method produces a fresh registration proof. leaseTTL is how long the
+// proof itself stays valid (0 meaning it never expires, as with a static
+// token); Runner re-authenticates shortly before it does.
+type Method interface {
+	Authenticate(ctx context.Context) (proof string, leaseTTL time.Duration, err error)
+}
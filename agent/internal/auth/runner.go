@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"deploybot-agent/internal/controller"
+)
+
+// retryBackoff is how soon Runner retries after a failed renewal.
+const retryBackoff = 30 * time.Second
+
+// Runner keeps the agent registered with a fresh credential: it builds a
+// RegisterRequest via BuildRequest, authenticates with Method to obtain
+// this cycle's bootstrap proof, registers (the controller treats repeat
+// registrations idempotently, so this doubles as a Vault-agent-style
+// startup auth), and fans the resulting agent token out to every Sink
+// before re-authenticating shortly before the proof's lease expires.
+type Runner struct {
+	Method Method
+	Client *controller.Client
+	Sinks  []Sink
+
+	// RenewBefore overrides how long before a proof's lease expires Runner
+	// re-authenticates; zero defaults to 20% of the lease.
+	RenewBefore time.Duration
+
+	// BuildRequest returns the next RegisterRequest to send, sans Token
+	// (Runner fills that in from Method.Authenticate). It's called fresh on
+	// every registration so metrics/capabilities stay current.
+	BuildRequest func(ctx context.Context) (controller.RegisterRequest, error)
+}
+
+// Start performs an initial registration synchronously, returning the
+// response so the caller can use the agent ID immediately, then keeps
+// renewing in the background until ctx is cancelled.
+func (r *Runner) Start(ctx context.Context) (controller.RegisterResponse, error) {
+	resp, ttl, err := r.registerOnce(ctx)
+	if err != nil {
+		return controller.RegisterResponse{}, err
+	}
+	go r.renewLoop(ctx, ttl)
+	return resp, nil
+}
+
+func (r *Runner) renewLoop(ctx context.Context, lastTTL time.Duration) {
+	for {
+		wait := r.renewDelay(lastTTL)
+		if wait <= 0 {
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_, ttl, err := r.registerOnce(ctx)
+		if err != nil {
+			log.Printf("auto-auth renewal failed, retrying shortly: %v", err)
+			lastTTL = retryBackoff
+			continue
+		}
+		lastTTL = ttl
+	}
+}
+
+func (r *Runner) registerOnce(ctx context.Context) (controller.RegisterResponse, time.Duration, error) {
+	proof, ttl, err := r.Method.Authenticate(ctx)
+	if err != nil {
+		return controller.RegisterResponse{}, 0, fmt.Errorf("authenticate: %w", err)
+	}
+
+	req, err := r.BuildRequest(ctx)
+	if err != nil {
+		return controller.RegisterResponse{}, 0, err
+	}
+	req.Token = proof
+
+	resp, err := r.Client.Register(ctx, req)
+	if err != nil {
+		return controller.RegisterResponse{}, 0, fmt.Errorf("register: %w", err)
+	}
+
+	for _, sink := range r.Sinks {
+		if err := sink.Write([]byte(resp.AgentToken)); err != nil {
+			log.Printf("auth token sink write failed: %v", err)
+		}
+	}
+	return resp, ttl, nil
+}
+
+func (r *Runner) renewDelay(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		// Static/non-expiring proof: nothing to renew.
+		return 0
+	}
+	before := r.RenewBefore
+	if before <= 0 || before >= ttl {
+		before = ttl / 5
+	}
+	return ttl - before
+}
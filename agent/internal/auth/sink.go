@@ -0,0 +1,8 @@
+package auth
+
+// Sink receives the current agent token whenever Runner (re-)authenticates,
+// so every interested consumer (persisted state, a file for other tooling,
+// a socket listener) stays in sync without polling.
+type Sink interface {
+	Write(token []byte) error
+}
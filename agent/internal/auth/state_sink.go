@@ -0,0 +1,13 @@
+package auth
+
+import "deploybot-agent/internal/state"
+
+// StateSink persists the token into the agent's on-disk state store,
+// alongside its other persistent fields (ports, deployment history).
+type StateSink struct {
+	Store *state.Store
+}
+
+func (s *StateSink) Write(token []byte) error {
+	return s.Store.SetAgentToken(string(token))
+}
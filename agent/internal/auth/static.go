@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// StaticMethod wraps the legacy long-lived bootstrap token so it can be
+// used interchangeably with the cloud identity methods below. The proof
+// never expires, so Runner never re-authenticates once it has registered.
+type StaticMethod struct {
+	Token string
+}
+
+func (m *StaticMethod) Authenticate(ctx context.Context) (string, time.Duration, error) {
+	return m.Token, 0, nil
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// UnixSocketSink pushes the token to a Unix domain socket that co-located
+// tooling listens on, e.g. a sidecar that wants to be notified the moment a
+// renewal happens rather than polling a file.
+type UnixSocketSink struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (u *UnixSocketSink) Write(token []byte) error {
+	timeout := u.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	conn, err := net.DialTimeout("unix", u.Path, timeout)
+	if err != nil {
+		return fmt.Errorf("dial auth token sink %s: %w", u.Path, err)
+	}
+	defer conn.Close()
+	_, err = conn.Write(append(token, '\n'))
+	return err
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+)
+
+// parsePositiveSeconds parses a decimal seconds count (as IMDS-style APIs
+// return it) and rejects anything that isn't strictly positive.
+func parsePositiveSeconds(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, errors.New("non-positive duration")
+	}
+	return n, nil
+}
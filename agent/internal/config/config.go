@@ -1,57 +1,109 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 )
 
 // Config represents runtime configuration for the agent.
 type Config struct {
-	ControllerURL           string
-	AgentToken              string
-	HeartbeatInterval       time.Duration
-	DataDir                 string
-	WorkDir                 string
-	HealthTimeout           time.Duration
-	LogsFollowDuration      time.Duration
-	AllowInsecureController bool
-	ControllerCAFile        string
-	ControllerCAPins        []string
-	ClientCertFile          string
-	ClientKeyFile           string
-	SecurityBypass          bool
-	EnableStateEncryption   bool
-	EncryptionKey           string
-	RegistryAllowList       []string
-	RequireImageDigest      bool
-	AllowedVolumeRoots      []string
-	CleanupWorkspaces       bool
-	AuditLogPath            string
-	AllowUnsafeCommands     bool
-	InteractiveSetup        bool
+	ControllerURL            string
+	AgentToken               string
+	HeartbeatInterval        time.Duration
+	DataDir                  string
+	WorkDir                  string
+	HealthTimeout            time.Duration
+	LogsFollowDuration       time.Duration
+	AllowInsecureController  bool
+	ControllerCAFile         string
+	ControllerCAPins         []string
+	ClientCertFile           string
+	ClientKeyFile            string
+	SecurityBypass           bool
+	EnableStateEncryption    bool
+	EncryptionKey            string
+	RegistryAllowList        []string
+	RequireImageDigest       bool
+	ImageDigestAllowListFile string
+	TrustedSignerKeys        []string
+	RequiredSignatureCount   int
+	SignaturePolicyMode      string
+	AllowedVolumeRoots       []string
+	CleanupWorkspaces        bool
+	AuditLogPath             string
+	AllowUnsafeCommands      bool
+	InteractiveSetup         bool
+	AuthMethod               string
+	AuthAWSRole              string
+	AuthGCPAudience          string
+	AuthAzureResource        string
+	AuthTokenFile            string
+	AuthTokenSocket          string
+	AuthRenewBefore           time.Duration
+	EncryptionKeyProvider     string
+	EncryptionAWSKMSKeyARN    string
+	EncryptionGCPKMSKeyName   string
+	EncryptionAzureVaultURL   string
+	EncryptionAzureKeyName    string
+	EncryptionVaultTransitKey string
+	EncryptionRotateTo        string
+	PKIDirectoryURL           string
+	PKIEABKeyID               string
+	PKIChallengeAddr          string
+	PKIRenewalFraction        float64
+	StateBackend              string
+	AuditSyslogNetwork        string
+	AuditSyslogAddr           string
+	AuditUnixSocketPath       string
+	AuditHTTPSPush            bool
+	AuditSpoolDir             string
+	AuditRedactFields         []string
+	AuditSignRecords          bool
+	AuditSignEvery            int
+	MaxCopyBytes              int64
+	MaxConcurrentJobs         int
+	JobRetryLimit             int
+	JobTypeConcurrency        []string
+	MetricsListenAddr         string
+	MetricsAuthToken          string
+	AuditMaxSizeMB            int
+	AuditMaxAgeHours          int
+	AuditKeep                 int
+	AuditSignArchives         bool
+	AuditAnchorIntervalMins   int
+	APISocketPath             string
+	HookDirs                  []string
+	HistoryDepth              int
+	BuildKitAddr              string
 }
 
-// Load parses CLI flags and environment variables into a Config.
+// Load parses a layered config file, environment variables, and CLI flags
+// into a Config, in that increasing order of precedence: defaults < config
+// file (--config / AGENT_CONFIG) < environment variables < CLI flags.
 func Load() (Config, error) {
 	cfg := Config{}
-	defaultHeartbeat := durationFromEnv("HEARTBEAT_INTERVAL", 10*time.Second)
-	defaultHealth := durationFromEnv("HEALTH_TIMEOUT", 60*time.Second)
-	defaultLogsDuration := durationFromEnv("LOGS_FOLLOW_DURATION", 2*time.Minute)
-	flag.StringVar(&cfg.ControllerURL, "controller-url", os.Getenv("CONTROLLER_URL"), "DeployBot controller base URL")
-	flag.StringVar(&cfg.AgentToken, "agent-token", os.Getenv("AGENT_TOKEN"), "DeployBot agent bootstrap token")
-	flag.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", defaultHeartbeat, "Heartbeat interval to controller")
-	flag.StringVar(&cfg.DataDir, "data-dir", valueOr(os.Getenv("AGENT_DATA_DIR"), "/var/lib/deploybot"), "Persistent state directory")
-	flag.StringVar(&cfg.WorkDir, "work-dir", os.Getenv("AGENT_WORK_DIR"), "Override git work directory; defaults to data-dir/work")
-	flag.DurationVar(&cfg.HealthTimeout, "health-timeout", defaultHealth, "Maximum time to wait for healthy container")
-	flag.DurationVar(&cfg.LogsFollowDuration, "logs-follow-duration", defaultLogsDuration, "Default duration to follow logs for log jobs")
-	flag.BoolVar(&cfg.AllowInsecureController, "allow-insecure-controller", boolFromEnv("ALLOW_INSECURE_CONTROLLER", false), "Permit HTTP or insecure TLS for controller communication")
-	flag.StringVar(&cfg.ControllerCAFile, "controller-ca", os.Getenv("CONTROLLER_CA_FILE"), "PEM bundle used to trust the controller")
-	defaultPins := listFromEnv("CONTROLLER_CA_PINS")
+
+	file, err := loadConfigFile(configFilePath())
+	if err != nil {
+		return Config{}, err
+	}
+	r := newResolver(file)
+
+	flag.StringVar(&cfg.ControllerURL, "controller-url", r.string("controller-url", "CONTROLLER_URL", ""), "DeployBot controller base URL")
+	flag.StringVar(&cfg.AgentToken, "agent-token", r.string("agent-token", "AGENT_TOKEN", ""), "DeployBot agent bootstrap token")
+	flag.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", r.duration("heartbeat-interval", "HEARTBEAT_INTERVAL", 10*time.Second), "Heartbeat interval to controller")
+	flag.StringVar(&cfg.DataDir, "data-dir", r.string("data-dir", "AGENT_DATA_DIR", "/var/lib/deploybot"), "Persistent state directory")
+	flag.StringVar(&cfg.WorkDir, "work-dir", r.string("work-dir", "AGENT_WORK_DIR", ""), "Override git work directory; defaults to data-dir/work")
+	flag.DurationVar(&cfg.HealthTimeout, "health-timeout", r.duration("health-timeout", "HEALTH_TIMEOUT", 60*time.Second), "Maximum time to wait for healthy container")
+	flag.DurationVar(&cfg.LogsFollowDuration, "logs-follow-duration", r.duration("logs-follow-duration", "LOGS_FOLLOW_DURATION", 2*time.Minute), "Default duration to follow logs for log jobs")
+	flag.BoolVar(&cfg.AllowInsecureController, "allow-insecure-controller", r.boolean("allow-insecure-controller", "ALLOW_INSECURE_CONTROLLER", false), "Permit HTTP or insecure TLS for controller communication")
+	flag.StringVar(&cfg.ControllerCAFile, "controller-ca", r.string("controller-ca", "CONTROLLER_CA_FILE", ""), "PEM bundle used to trust the controller")
+	defaultPins := r.list("controller-ca-pins", "CONTROLLER_CA_PINS")
 	flag.Func("controller-ca-pins", "Comma-separated SHA256 fingerprints for pinning controller certificates", func(val string) error {
 		if val == "" {
 			cfg.ControllerCAPins = nil
@@ -63,12 +115,12 @@ func Load() (Config, error) {
 	if cfg.ControllerCAPins == nil {
 		cfg.ControllerCAPins = defaultPins
 	}
-	flag.StringVar(&cfg.ClientCertFile, "client-cert", os.Getenv("CLIENT_CERT_FILE"), "Client certificate for mutual TLS")
-	flag.StringVar(&cfg.ClientKeyFile, "client-key", os.Getenv("CLIENT_KEY_FILE"), "Client key for mutual TLS")
-	flag.BoolVar(&cfg.SecurityBypass, "security-bypass", boolFromEnv("SECURITY_BYPASS", false), "Disable security enforcement (not recommended)")
-	flag.BoolVar(&cfg.EnableStateEncryption, "state-encryption", boolFromEnv("STATE_ENCRYPTION", os.Getenv("AGENT_STATE_KEY") != ""), "Encrypt credentials in state file")
-	flag.StringVar(&cfg.EncryptionKey, "encryption-key", os.Getenv("AGENT_STATE_KEY"), "Key material for state encryption")
-	defaultRegistries := listFromEnv("REGISTRY_ALLOWLIST")
+	flag.StringVar(&cfg.ClientCertFile, "client-cert", r.string("client-cert", "CLIENT_CERT_FILE", ""), "Client certificate for mutual TLS")
+	flag.StringVar(&cfg.ClientKeyFile, "client-key", r.string("client-key", "CLIENT_KEY_FILE", ""), "Client key for mutual TLS")
+	flag.BoolVar(&cfg.SecurityBypass, "security-bypass", r.boolean("security-bypass", "SECURITY_BYPASS", false), "Disable security enforcement (not recommended)")
+	flag.BoolVar(&cfg.EnableStateEncryption, "state-encryption", r.boolean("state-encryption", "STATE_ENCRYPTION", os.Getenv("AGENT_STATE_KEY") != ""), "Encrypt credentials in state file")
+	flag.StringVar(&cfg.EncryptionKey, "encryption-key", r.string("encryption-key", "AGENT_STATE_KEY", ""), "Key material for state encryption")
+	defaultRegistries := r.list("registry-allowlist", "REGISTRY_ALLOWLIST")
 	flag.Func("registry-allowlist", "Comma separated list of registries permitted for deployments", func(val string) error {
 		if val == "" {
 			cfg.RegistryAllowList = nil
@@ -80,8 +132,23 @@ func Load() (Config, error) {
 	if cfg.RegistryAllowList == nil {
 		cfg.RegistryAllowList = defaultRegistries
 	}
-	flag.BoolVar(&cfg.RequireImageDigest, "require-image-digest", boolFromEnv("REQUIRE_IMAGE_DIGEST", false), "Reject images that are not pinned by digest")
-	defaultVolumeRoots := listFromEnv("ALLOWED_VOLUME_ROOTS")
+	flag.BoolVar(&cfg.RequireImageDigest, "require-image-digest", r.boolean("require-image-digest", "REQUIRE_IMAGE_DIGEST", false), "Reject images that are not pinned by digest")
+	flag.StringVar(&cfg.ImageDigestAllowListFile, "image-digest-allowlist", r.string("image-digest-allowlist", "IMAGE_DIGEST_ALLOWLIST_FILE", ""), "JSON file mapping registry/repo prefixes to allowed image digests")
+	defaultSignerKeys := r.list("trusted-signer-keys", "TRUSTED_SIGNER_KEYS")
+	flag.Func("trusted-signer-keys", "Comma separated list of PEM files (Ed25519 or ECDSA-P256) trusted to sign DeployJobPayload.ImageSignatures", func(val string) error {
+		if val == "" {
+			cfg.TrustedSignerKeys = nil
+			return nil
+		}
+		cfg.TrustedSignerKeys = strings.Split(val, ",")
+		return nil
+	})
+	if cfg.TrustedSignerKeys == nil {
+		cfg.TrustedSignerKeys = defaultSignerKeys
+	}
+	flag.IntVar(&cfg.RequiredSignatureCount, "required-signature-count", r.integer("required-signature-count", "REQUIRED_SIGNATURE_COUNT", 1), "Minimum number of signatures that must verify against trusted-signer-keys before a deploy proceeds")
+	flag.StringVar(&cfg.SignaturePolicyMode, "signature-policy-mode", r.string("signature-policy-mode", "SIGNATURE_POLICY_MODE", "off"), "Image signature policy: off (no check), warn (audit only), enforce (block deploy on failure). Checks both the image's registry-published cosign artifact and a deploy's inline ImageSignatures against trusted-signer-keys (the inline check uses the deploy's own image_signers instead when it supplies them)")
+	defaultVolumeRoots := r.list("allowed-volume-roots", "ALLOWED_VOLUME_ROOTS")
 	flag.Func("allowed-volume-roots", "Comma separated host paths that volume mounts must fall under", func(val string) error {
 		if val == "" {
 			cfg.AllowedVolumeRoots = nil
@@ -93,16 +160,105 @@ func Load() (Config, error) {
 	if cfg.AllowedVolumeRoots == nil {
 		cfg.AllowedVolumeRoots = defaultVolumeRoots
 	}
-	flag.BoolVar(&cfg.CleanupWorkspaces, "cleanup-workspaces", boolFromEnv("CLEANUP_WORKSPACES", true), "Remove git workspaces after jobs complete")
-	flag.StringVar(&cfg.AuditLogPath, "audit-log", os.Getenv("AUDIT_LOG_PATH"), "File path for JSONL audit logs")
-	flag.BoolVar(&cfg.AllowUnsafeCommands, "allow-unsafe-commands", boolFromEnv("ALLOW_UNSAFE_COMMANDS", false), "Permit exec/env jobs that run host commands")
-	flag.BoolVar(&cfg.InteractiveSetup, "interactive-setup", boolFromEnv("AGENT_INTERACTIVE_SETUP", true), "Run interactive prerequisite checks before starting")
+	flag.BoolVar(&cfg.CleanupWorkspaces, "cleanup-workspaces", r.boolean("cleanup-workspaces", "CLEANUP_WORKSPACES", true), "Remove git workspaces after jobs complete")
+	flag.StringVar(&cfg.AuditLogPath, "audit-log", r.string("audit-log", "AUDIT_LOG_PATH", ""), "File path for JSONL audit logs")
+	flag.BoolVar(&cfg.AllowUnsafeCommands, "allow-unsafe-commands", r.boolean("allow-unsafe-commands", "ALLOW_UNSAFE_COMMANDS", false), "Permit exec/env jobs that run host commands")
+	flag.BoolVar(&cfg.InteractiveSetup, "interactive-setup", r.boolean("interactive-setup", "AGENT_INTERACTIVE_SETUP", true), "Run interactive prerequisite checks before starting")
+	flag.StringVar(&cfg.AuthMethod, "auth-method", r.string("auth-method", "AUTH_METHOD", "static"), "Auto-auth method used to obtain the registration proof: static, aws-iam, gcp-jwt, azure-imds, oci-instance-principal")
+	flag.StringVar(&cfg.AuthAWSRole, "auth-aws-role", r.string("auth-aws-role", "AUTH_AWS_ROLE", ""), "Controller-side role to request when using the aws-iam auth method")
+	flag.StringVar(&cfg.AuthGCPAudience, "auth-gcp-audience", r.string("auth-gcp-audience", "AUTH_GCP_AUDIENCE", ""), "Audience claim requested in the GCP instance identity token")
+	flag.StringVar(&cfg.AuthAzureResource, "auth-azure-resource", r.string("auth-azure-resource", "AUTH_AZURE_RESOURCE", "https://management.azure.com/"), "Azure resource to request a managed-identity token for")
+	flag.StringVar(&cfg.AuthTokenFile, "auth-token-file", r.string("auth-token-file", "AUTH_TOKEN_FILE", ""), "Optional file to mirror the current agent token into for co-located tooling")
+	flag.StringVar(&cfg.AuthTokenSocket, "auth-token-socket", r.string("auth-token-socket", "AUTH_TOKEN_SOCKET", ""), "Optional Unix socket to push the current agent token to on every renewal")
+	flag.DurationVar(&cfg.AuthRenewBefore, "auth-renew-before", r.duration("auth-renew-before", "AUTH_RENEW_BEFORE", 0), "How long before a proof's lease expires to re-authenticate; defaults to 20% of the lease")
+	flag.StringVar(&cfg.EncryptionKeyProvider, "encryption-key-provider", r.string("encryption-key-provider", "ENCRYPTION_KEY_PROVIDER", "passphrase"), "KEK provider for state encryption: passphrase, aws-kms, gcp-kms, azure-keyvault, vault-transit")
+	flag.StringVar(&cfg.EncryptionAWSKMSKeyARN, "encryption-aws-kms-key", r.string("encryption-aws-kms-key", "ENCRYPTION_AWS_KMS_KEY_ARN", ""), "AWS KMS key ARN used as the KEK when encryption-key-provider is aws-kms")
+	flag.StringVar(&cfg.EncryptionGCPKMSKeyName, "encryption-gcp-kms-key", r.string("encryption-gcp-kms-key", "ENCRYPTION_GCP_KMS_KEY_NAME", ""), "Cloud KMS CryptoKey resource name used as the KEK when encryption-key-provider is gcp-kms")
+	flag.StringVar(&cfg.EncryptionAzureVaultURL, "encryption-azure-vault-url", r.string("encryption-azure-vault-url", "ENCRYPTION_AZURE_VAULT_URL", ""), "Key Vault URL used when encryption-key-provider is azure-keyvault")
+	flag.StringVar(&cfg.EncryptionAzureKeyName, "encryption-azure-key-name", r.string("encryption-azure-key-name", "ENCRYPTION_AZURE_KEY_NAME", ""), "Key Vault key name used when encryption-key-provider is azure-keyvault")
+	flag.StringVar(&cfg.EncryptionVaultTransitKey, "encryption-vault-transit-key", r.string("encryption-vault-transit-key", "ENCRYPTION_VAULT_TRANSIT_KEY", ""), "Vault Transit key name used when encryption-key-provider is vault-transit")
+	flag.StringVar(&cfg.EncryptionRotateTo, "encryption-rotate-to", r.string("encryption-rotate-to", "ENCRYPTION_ROTATE_TO", ""), "If set, must equal the key ID of the configured (active) KEK; the stored token is re-wrapped under that key on startup. No additional KEK is registered by this flag")
+	flag.StringVar(&cfg.PKIDirectoryURL, "pki-acme-directory", r.string("pki-acme-directory", "PKI_ACME_DIRECTORY", ""), "ACME directory URL (e.g. a step-ca provisioner) used to enroll/renew the agent's mTLS client certificate; leave unset to use static client-cert/client-key instead")
+	flag.StringVar(&cfg.PKIEABKeyID, "pki-eab-key-id", r.string("pki-eab-key-id", "PKI_EAB_KEY_ID", ""), "step-ca ACME provisioner external account binding key ID")
+	flag.StringVar(&cfg.PKIChallengeAddr, "pki-challenge-addr", r.string("pki-challenge-addr", "PKI_CHALLENGE_ADDR", ":80"), "Address the ACME http-01 challenge responder binds while enrolling/renewing")
+	flag.Float64Var(&cfg.PKIRenewalFraction, "pki-renewal-fraction", r.float("pki-renewal-fraction", "", 0), "Fraction of certificate lifetime elapsed before renewal is attempted; defaults to 2/3")
+	flag.StringVar(&cfg.StateBackend, "state-backend", r.string("state-backend", "STATE_BACKEND", ""), "State storage backend URL (file://, bolt://, consul://host:port/prefix, etcd://host:port/prefix, vault://host:port/mount/path); defaults to a local file under data-dir")
+	flag.StringVar(&cfg.AuditSyslogNetwork, "audit-syslog-network", r.string("audit-syslog-network", "AUDIT_SYSLOG_NETWORK", "udp"), "Network for audit-syslog-addr: udp or tcp")
+	flag.StringVar(&cfg.AuditSyslogAddr, "audit-syslog-addr", r.string("audit-syslog-addr", "AUDIT_SYSLOG_ADDR", ""), "If set, also forward audit records to this syslog collector address")
+	flag.StringVar(&cfg.AuditUnixSocketPath, "audit-unix-socket", r.string("audit-unix-socket", "AUDIT_UNIX_SOCKET", ""), "If set, also stream audit records as NDJSON to this Unix domain socket for a local SIEM shipper")
+	flag.BoolVar(&cfg.AuditHTTPSPush, "audit-https-push", r.boolean("audit-https-push", "AUDIT_HTTPS_PUSH", false), "Also push audit records to the controller over HTTPS, spooling locally while it is unreachable")
+	flag.StringVar(&cfg.AuditSpoolDir, "audit-spool-dir", r.string("audit-spool-dir", "AUDIT_SPOOL_DIR", ""), "Directory for the audit-https-push spool; defaults to data-dir/audit-spool")
+	defaultAuditDenyList := r.list("audit-redact-fields", "AUDIT_REDACT_FIELDS")
+	flag.Func("audit-redact-fields", "Comma-separated field names (case-insensitive) to redact from audit records before hashing or shipping; defaults to a built-in secret-field list", func(val string) error {
+		if val == "" {
+			cfg.AuditRedactFields = nil
+			return nil
+		}
+		cfg.AuditRedactFields = strings.Split(val, ",")
+		return nil
+	})
+	if cfg.AuditRedactFields == nil {
+		cfg.AuditRedactFields = defaultAuditDenyList
+	}
+	flag.BoolVar(&cfg.AuditSignRecords, "audit-sign-records", r.boolean("audit-sign-records", "AUDIT_SIGN_RECORDS", false), "Sign audit record hashes with the agent's mTLS client certificate key (requires pki-acme-directory)")
+	flag.IntVar(&cfg.AuditSignEvery, "audit-sign-every", r.integer("audit-sign-every", "AUDIT_SIGN_EVERY", 1), "Sign every Nth audit record when audit-sign-records is set")
+	flag.IntVar(&cfg.AuditMaxSizeMB, "audit-max-size-mb", r.integer("audit-max-size-mb", "AUDIT_MAX_SIZE_MB", 0), "Rotate the audit log once it reaches this size in MB; 0 disables size-based rotation")
+	flag.IntVar(&cfg.AuditMaxAgeHours, "audit-max-age-hours", r.integer("audit-max-age-hours", "AUDIT_MAX_AGE_HOURS", 0), "Rotate the audit log once it has been active this many hours; 0 disables age-based rotation")
+	flag.IntVar(&cfg.AuditKeep, "audit-keep", r.integer("audit-keep", "AUDIT_KEEP", 0), "Number of rotated audit archives to retain; 0 keeps them all")
+	flag.BoolVar(&cfg.AuditSignArchives, "audit-sign-archives", r.boolean("audit-sign-archives", "AUDIT_SIGN_ARCHIVES", false), "Sign each rotated-out audit archive with an Ed25519 key persisted alongside the agent's state encryption key")
+	flag.IntVar(&cfg.AuditAnchorIntervalMins, "audit-anchor-interval-minutes", r.integer("audit-anchor-interval-minutes", "AUDIT_ANCHOR_INTERVAL_MINUTES", 0), "If set with audit-sign-archives, emit a signed audit.anchor record over the chain's head hash at least this often, independent of rotation; 0 disables periodic anchoring")
+	flag.Int64Var(&cfg.MaxCopyBytes, "max-copy-bytes", r.integer64("max-copy-bytes", "MAX_COPY_BYTES", 100*1024*1024), "Maximum total bytes a single copy job may transfer")
+	flag.IntVar(&cfg.MaxConcurrentJobs, "max-concurrent-jobs", r.integer("max-concurrent-jobs", "MAX_CONCURRENT_JOBS", 4), "Number of jobs the worker pool may run at once; deploys targeting the same service still serialize")
+	flag.IntVar(&cfg.JobRetryLimit, "job-retry-limit", r.integer("job-retry-limit", "JOB_RETRY_LIMIT", 3), "Maximum retries for a job that fails with a transient Docker/controller error")
+	defaultJobTypeConcurrency := r.list("job-type-concurrency", "JOB_TYPE_CONCURRENCY")
+	flag.Func("job-type-concurrency", "Comma separated type=limit pairs capping how many jobs of that type run at once (e.g. build=1,exec=2), on top of max-concurrent-jobs", func(val string) error {
+		if val == "" {
+			cfg.JobTypeConcurrency = nil
+			return nil
+		}
+		cfg.JobTypeConcurrency = strings.Split(val, ",")
+		return nil
+	})
+	if cfg.JobTypeConcurrency == nil {
+		cfg.JobTypeConcurrency = defaultJobTypeConcurrency
+	}
+	flag.StringVar(&cfg.MetricsListenAddr, "metrics-listen-addr", r.string("metrics-listen-addr", "METRICS_LISTEN_ADDR", ""), "Address to serve /metrics, /healthz and /readyz on; empty disables the metrics server")
+	flag.StringVar(&cfg.MetricsAuthToken, "metrics-auth-token", r.string("metrics-auth-token", "METRICS_AUTH_TOKEN", ""), "Bearer token required on /metrics requests; empty leaves it unauthenticated")
+	flag.StringVar(&cfg.APISocketPath, "api-socket", r.string("api-socket", "API_SOCKET_PATH", ""), "Unix socket to serve a Docker/Podman-compatible REST API subset on, for local docker/podman CLI and Compose tooling; empty disables it")
+	defaultHookDirs := r.list("hook-dirs", "HOOK_DIRS")
+	flag.Func("hook-dirs", "Comma separated directories scanned for *.json pre/post-deploy hook definitions; defaults to /etc/deploybot/hooks.d and $HOME/.config/deploybot/hooks.d", func(val string) error {
+		if val == "" {
+			cfg.HookDirs = nil
+			return nil
+		}
+		cfg.HookDirs = strings.Split(val, ",")
+		return nil
+	})
+	if cfg.HookDirs == nil {
+		cfg.HookDirs = defaultHookDirs
+	}
+	flag.IntVar(&cfg.HistoryDepth, "history-depth", r.integer("history-depth", "HISTORY_DEPTH", 3), "Number of past generations kept (stopped, renamed, not removed) per deployment for the rollback job to target")
+	flag.StringVar(&cfg.BuildKitAddr, "buildkit-addr", r.string("buildkit-addr", "BUILDKIT_ADDR", ""), "Address of a standalone buildkitd (e.g. unix:///run/buildkit/buildkitd.sock) used for build/deploy jobs requesting builder=\"buildkit\"; empty falls back to the classic daemon builder")
+	flag.String("config", configFilePath(), "YAML config file populating this Config; also settable via AGENT_CONFIG. Precedence is defaults < config file < environment variables < CLI flags")
+	printConfig := flag.Bool("print-config", false, "Print the fully-resolved effective configuration (secrets redacted) as JSON, with each value's origin, and exit")
 	flag.Parse()
+	r.promoteFlags(flag.CommandLine)
+
+	if *printConfig {
+		if err := printEffectiveConfig(cfg, r.origins); err != nil {
+			return Config{}, err
+		}
+		os.Exit(0)
+	}
+
 	if cfg.ControllerURL == "" {
 		return Config{}, errors.New("controller URL is required")
 	}
-	if cfg.AgentToken == "" {
-		return Config{}, errors.New("agent token is required")
+	if cfg.AuthMethod == "" {
+		cfg.AuthMethod = "static"
+	}
+	if cfg.AuthMethod == "static" && cfg.AgentToken == "" {
+		return Config{}, errors.New("agent token is required when auth-method is static")
 	}
 	if cfg.WorkDir == "" {
 		cfg.WorkDir = fmt.Sprintf("%s/work", cfg.DataDir)
@@ -110,34 +266,32 @@ func Load() (Config, error) {
 	return cfg, nil
 }
 
-func durationFromEnv(key string, fallback time.Duration) time.Duration {
-	val := os.Getenv(key)
-	if val == "" {
-		return fallback
-	}
-	n, err := strconv.Atoi(val)
-	if err != nil {
-		return fallback
+// printEffectiveConfig writes the fully-resolved Config and the precedence
+// tier that supplied each setting to stdout as JSON, redacting fields that
+// hold live secret material rather than just a path or identifier.
+func printEffectiveConfig(cfg Config, origins map[string]origin) error {
+	redacted := cfg
+	if redacted.AgentToken != "" {
+		redacted.AgentToken = "***redacted***"
 	}
-	return time.Duration(n) * time.Second
-}
-func valueOr(v, fallback string) string {
-	if v == "" {
-		return fallback
+	if redacted.EncryptionKey != "" {
+		redacted.EncryptionKey = "***redacted***"
 	}
-	return v
-}
-func boolFromEnv(key string, def bool) bool {
-	val := os.Getenv(key)
-	if val == "" {
-		return def
+	if redacted.MetricsAuthToken != "" {
+		redacted.MetricsAuthToken = "***redacted***"
 	}
-	b, err := strconv.ParseBool(val)
+	dump := struct {
+		Config  Config            `json:"config"`
+		Origins map[string]origin `json:"origins"`
+	}{Config: redacted, Origins: origins}
+	out, err := json.MarshalIndent(dump, "", "  ")
 	if err != nil {
-		return def
+		return fmt.Errorf("marshal effective config: %w", err)
 	}
-	return b
+	fmt.Println(string(out))
+	return nil
 }
+
 func listFromEnv(key string) []string {
 	val := strings.TrimSpace(os.Getenv(key))
 	if val == "" {
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileDocument is the flattened result of loading a config file and any
+// include: fragments it references, keyed by the same names used for CLI
+// flags (e.g. "controller-url") so a single lookup serves both scalar and
+// list-valued settings. List-valued keys are kept separately since YAML
+// encodes them as sequences rather than comma-joined strings.
+type fileDocument struct {
+	Values map[string]string
+	Lists  map[string][]string
+}
+
+func (d fileDocument) str(key string) (string, bool) {
+	v, ok := d.Values[key]
+	return v, ok
+}
+
+func (d fileDocument) list(key string) ([]string, bool) {
+	v, ok := d.Lists[key]
+	return v, ok
+}
+
+// configFilePath picks the config file to load, checking the --config/
+// -config CLI flag before flag.Parse has run (its value feeds the default
+// of every other flag, so it must be resolved first) and falling back to
+// AGENT_CONFIG. Returns "" if neither is set; a config file is optional.
+func configFilePath() string {
+	args := os.Args[1:]
+	for i, arg := range args {
+		switch {
+		case arg == "--config" || arg == "-config":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		case strings.HasPrefix(arg, "--config="):
+			return strings.TrimPrefix(arg, "--config=")
+		case strings.HasPrefix(arg, "-config="):
+			return strings.TrimPrefix(arg, "-config=")
+		}
+	}
+	return os.Getenv("AGENT_CONFIG")
+}
+
+// loadConfigFile reads path (a YAML document), merges in any fragments
+// named by its top-level "include" key - glob patterns resolved relative
+// to path's directory, e.g. /etc/deploybot/agent.d/*.yaml, letting
+// registries/CA pins/allowed volume roots live in drop-in files - and
+// flattens the result. Fragments are merged pattern by pattern, each
+// pattern's filepath.Glob matches in sorted order, and the top-level file's own keys are applied last so it always
+// wins over anything it includes.
+func loadConfigFile(path string) (fileDocument, error) {
+	doc := fileDocument{Values: map[string]string{}, Lists: map[string][]string{}}
+	if path == "" {
+		return doc, nil
+	}
+	raw, includes, err := readConfigYAML(path)
+	if err != nil {
+		return doc, err
+	}
+	dir := filepath.Dir(path)
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return doc, fmt.Errorf("include pattern %s: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			fragRaw, fragIncludes, err := readConfigYAML(match)
+			if err != nil {
+				return doc, err
+			}
+			if len(fragIncludes) > 0 {
+				return doc, fmt.Errorf("fragment %s: nested include: is not supported", match)
+			}
+			mergeConfigValues(&doc, fragRaw)
+		}
+	}
+	mergeConfigValues(&doc, raw)
+	return doc, nil
+}
+
+// readConfigYAML decodes a single YAML file into a generic map and pulls
+// its "include" key (a string or list of glob patterns) out separately.
+func readConfigYAML(path string) (map[string]interface{}, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read config file %s: %w", path, err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	var includes []string
+	switch v := raw["include"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				includes = append(includes, s)
+			}
+		}
+	case string:
+		includes = append(includes, v)
+	}
+	delete(raw, "include")
+	return raw, includes, nil
+}
+
+// mergeConfigValues flattens raw's top-level keys into doc, overwriting
+// anything already present there - later calls win, which is what gives
+// the main config file precedence over its own include: fragments.
+func mergeConfigValues(doc *fileDocument, raw map[string]interface{}) {
+	for key, val := range raw {
+		switch v := val.(type) {
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprintf("%v", item))
+			}
+			doc.Lists[key] = items
+			delete(doc.Values, key)
+		case nil:
+			continue
+		default:
+			doc.Values[key] = fmt.Sprintf("%v", v)
+			delete(doc.Lists, key)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deploybot-agent/internal/controller/errdefs"
+)
+
+// Client handles communication with the DeployBot controller.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	agentToken string
+
+	retry      retryPolicy
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+}
+
+// TLSConfig carries the TLS hardening and override parameters used when dialing the controller.
+type TLSConfig struct {
+	AllowInsecure bool
+	CAFile        string
+	CAPins        []string
+	ClientCert    string
+	ClientKey     string
+
+	// GetClientCertificate, if set, takes precedence over ClientCert/
+	// ClientKey and is consulted on every handshake, letting a background
+	// renewal process (see internal/pki) hot-swap the client certificate
+	// without reconstructing the Client.
+	GetClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+
+	// RootCAPool, if set, takes precedence over CAFile and is consulted on
+	// every handshake, letting internal/pki rotate trust anchors to match
+	// the CA that issued the current client certificate without
+	// reconstructing the Client.
+	RootCAPool func() *x509.CertPool
+}
+
+type clientOptions struct {
+	tls            TLSConfig
+	securityBypass bool
+}
+
+// Option customises controller client behaviour.
+type Option func(*clientOptions)
+
+// WithTLSConfig applies TLS hardening / override parameters.
+func WithTLSConfig(cfg TLSConfig) Option {
+	return func(o *clientOptions) {
+		o.tls = cfg
+	}
+}
+
+// WithSecurityBypass relaxes strict enforcement in trusted environments.
+func WithSecurityBypass() Option {
+	return func(o *clientOptions) {
+		o.securityBypass = true
+	}
+}
+
+// New creates a new controller client.
+func New(base, token string, opts ...Option) (*Client, error) {
+	cfg := clientOptions{tls: TLSConfig{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "https" && !cfg.tls.AllowInsecure && !cfg.securityBypass {
+		return nil, errors.New("controller URL must be https; override with allow-insecure-controller")
+	}
+
+	tlsConfig, err := buildTLSConfig(u.Hostname(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.ForceAttemptHTTP2 = true
+
+	return &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		agentToken: token,
+		retry:      defaultRetryPolicy,
+	}, nil
+}
+
+func buildTLSConfig(serverName string, opts clientOptions) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if serverName != "" {
+		tlsCfg.ServerName = serverName
+	}
+	if opts.tls.AllowInsecure || opts.securityBypass {
+		tlsCfg.InsecureSkipVerify = true
+	}
+	if opts.tls.RootCAPool != nil {
+		// Root trust is resolved per-handshake from the PKI manager, so
+		// disable the default verifier and do the chain check ourselves
+		// against whatever pool is current at dial time.
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyAgainstPool(opts.tls.RootCAPool(), cs)
+		}
+	} else if opts.tls.CAFile != "" {
+		data, err := os.ReadFile(opts.tls.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read controller CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("controller CA file is invalid")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if opts.tls.GetClientCertificate != nil {
+		tlsCfg.GetClientCertificate = opts.tls.GetClientCertificate
+	} else if opts.tls.ClientCert != "" || opts.tls.ClientKey != "" {
+		if opts.tls.ClientCert == "" || opts.tls.ClientKey == "" {
+			return nil, errors.New("client cert and key must both be provided")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.tls.ClientCert, opts.tls.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	pins, err := normalizePins(opts.tls.CAPins)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 {
+		tlsCfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			for _, der := range rawCerts {
+				hash := sha256.Sum256(der)
+				for _, pin := range pins {
+					if bytes.Equal(hash[:], pin) {
+						return nil
+					}
+				}
+			}
+			return errors.New("controller certificate did not match any configured pins")
+		}
+	}
+	return tlsCfg, nil
+}
+
+// verifyAgainstPool runs the standard chain verification cs.PeerCertificates
+// would otherwise get from crypto/tls, but against a pool resolved at
+// handshake time rather than one fixed at Client construction.
+func verifyAgainstPool(pool *x509.CertPool, cs tls.ConnectionState) error {
+	if pool == nil || len(cs.PeerCertificates) == 0 {
+		return errors.New("no root CA pool available to verify controller certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+func normalizePins(values []string) ([][]byte, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	result := make([][]byte, 0, len(values))
+	for _, v := range values {
+		trim := strings.TrimSpace(strings.ToLower(v))
+		if trim == "" {
+			continue
+		}
+		trim = strings.TrimPrefix(trim, "sha256:")
+		trim = strings.ReplaceAll(trim, ":", "")
+		decoded, err := hex.DecodeString(trim)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate pin %q: %w", v, err)
+		}
+		result = append(result, decoded)
+	}
+	return result, nil
+}
+
+// RegisterRequest contains the payload for registering the agent.
+type RegisterRequest struct {
+	Token         string   `json:"token"`
+	Metrics       Metrics  `json:"metrics"`
+	DockerVersion string   `json:"docker_version"`
+	Hostname      string   `json:"hostname"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+}
+
+// Metrics summarises host resource utilisation.
+type Metrics struct {
+	CPUPercent float64 `json:"cpu_percent"`
+	MemPercent float64 `json:"mem_percent"`
+	DiskFreeGB float64 `json:"disk_free_gb"`
+}
+
+// RegisterResponse returns the permanent agent credentials.
+type RegisterResponse struct {
+	AgentID    string `json:"agent_id"`
+	AgentToken string `json:"agent_token"`
+}
+
+// HeartbeatRequest is sent periodically with metrics and inventory.
+type HeartbeatRequest struct {
+	Metrics      Metrics             `json:"metrics"`
+	Inventory    []InventoryResource `json:"inventory"`
+	Capabilities []string            `json:"capabilities,omitempty"`
+	JobQueue     []JobQueueDepth     `json:"job_queue,omitempty"`
+}
+
+// JobQueueDepth mirrors metrics.JobQueueDepth for the heartbeat wire
+// format: a running/queued/retrying count for one job type, sourced from
+// the agent's job pool.
+type JobQueueDepth struct {
+	Type     string `json:"type"`
+	Running  int    `json:"running,omitempty"`
+	Queued   int    `json:"queued,omitempty"`
+	Retrying int    `json:"retrying,omitempty"`
+}
+
+// InventoryResource describes a running container.
+type InventoryResource struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Ports        map[string]string `json:"ports"`
+	Status       string            `json:"status"`
+	Health       string            `json:"health"`
+	RestartCount int               `json:"restart_count,omitempty"`
+}
+
+// Job mirrors jobs.Job's wire shape without importing the jobs package:
+// jobs imports dockerutil and audit, both of which push data to the
+// controller, so this package importing jobs back would create an
+// import cycle. Callers convert Job into a jobs.Job themselves.
+type Job struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// HeartbeatResponse conveys optional pending work.
+type HeartbeatResponse struct {
+	Job *Job `json:"job"`
+}
+
+// AckStatus is the result of running a job.
+type AckStatus string
+
+const (
+	AckSucceeded AckStatus = "succeeded"
+	AckFailed    AckStatus = "failed"
+	// AckUnclaimed tells the controller this agent never ran the job - it
+	// was still serialized behind another job for the same target when a
+	// graceful drain (SIGTERM) cut off new dispatch - so the controller is
+	// free to reschedule it elsewhere immediately.
+	AckUnclaimed AckStatus = "unclaimed"
+)
+
+// JobAckRequest acknowledges job completion. LogSeq is the highest log frame
+// sequence number shipped for the job, if any, so the controller can
+// truncate its own resumable-log storage once the job is done.
+type JobAckRequest struct {
+	Status AckStatus   `json:"status"`
+	Detail interface{} `json:"detail,omitempty"`
+	LogSeq uint64      `json:"log_seq,omitempty"`
+}
+
+// Register registers the agent with the controller. The request is
+// idempotent: retries (by us or by the controller, if it persists the key)
+// must not mint duplicate agent identities.
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (RegisterResponse, error) {
+	var resp RegisterResponse
+	key := idempotencyKey("register", req.Token, req.Hostname)
+	if err := c.do(ctx, http.MethodPost, "/v1/agents/register", req, &resp, key); err != nil {
+		return RegisterResponse{}, err
+	}
+	c.agentToken = resp.AgentToken
+	return resp, nil
+}
+
+// Heartbeat sends periodic state updates.
+func (c *Client) Heartbeat(ctx context.Context, agentID string, req HeartbeatRequest) (HeartbeatResponse, error) {
+	var resp HeartbeatResponse
+	endpoint := fmt.Sprintf("/v1/agents/%s/heartbeat", agentID)
+	if err := c.do(ctx, http.MethodPost, endpoint, req, &resp, ""); err != nil {
+		return HeartbeatResponse{}, err
+	}
+	return resp, nil
+}
+
+// AckJob notifies the controller that a job completed. The key is derived
+// from the job ID and status so a retried ack can't double-apply. logSeq is
+// the highest log frame shipped for the job (0 if the job produced no
+// resumable log stream) and lets the controller drop its per-job log buffer.
+func (c *Client) AckJob(ctx context.Context, agentID, jobID string, status AckStatus, detail interface{}, logSeq uint64) error {
+	endpoint := fmt.Sprintf("/v1/agents/%s/jobs/%s", agentID, jobID)
+	key := idempotencyKey("ack", jobID, string(status))
+	return c.do(ctx, http.MethodPost, endpoint, JobAckRequest{Status: status, Detail: detail, LogSeq: logSeq}, nil, key)
+}
+
+// ShipLogs streams NDJSON log frames to the controller via a chunked POST.
+// sinceSeq resumes a dropped connection: the controller is expected to
+// dedupe any frame with seq <= sinceSeq it already has on record.
+func (c *Client) ShipLogs(ctx context.Context, agentID, jobID string, sinceSeq uint64, reader io.Reader) error {
+	endpoint := fmt.Sprintf("/v1/agents/%s/jobs/%s/logs", agentID, jobID)
+	rel := *c.baseURL
+	rel.Path = path.Join(c.baseURL.Path, endpoint)
+	if sinceSeq > 0 {
+		q := rel.Query()
+		q.Set("since_seq", strconv.FormatUint(sinceSeq, 10))
+		rel.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rel.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.agentToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.agentToken)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return decodeAPIError(res)
+	}
+	return nil
+}
+
+// LogsAck tells the controller we've durably persisted frames up to seq
+// locally, allowing it to acknowledge (and the agent's ring buffer to later
+// truncate) without waiting for the job itself to finish.
+func (c *Client) LogsAck(ctx context.Context, agentID, jobID string, seq uint64) error {
+	endpoint := fmt.Sprintf("/v1/agents/%s/jobs/%s/logs/ack", agentID, jobID)
+	key := idempotencyKey("logs-ack", jobID, strconv.FormatUint(seq, 10))
+	return c.do(ctx, http.MethodPost, endpoint, logsAckRequest{Seq: seq}, nil, key)
+}
+
+type logsAckRequest struct {
+	Seq uint64 `json:"seq"`
+}
+
+// auditPushRequest batches pre-serialized audit records (already hashed,
+// redacted, and optionally signed by internal/audit) for durable,
+// centralized retention.
+type auditPushRequest struct {
+	Records []json.RawMessage `json:"records"`
+}
+
+// PushAudit ships a batch of audit records to the controller.
+func (c *Client) PushAudit(ctx context.Context, agentID string, records []json.RawMessage) error {
+	endpoint := fmt.Sprintf("/v1/agents/%s/audit", agentID)
+	return c.do(ctx, http.MethodPost, endpoint, auditPushRequest{Records: records}, nil, "")
+}
+
+// do issues a request against endpoint, retrying with decorrelated-jitter
+// backoff when the failure is classified as retriable by errdefs.IsRetriable
+// (5xx, 408, 429, or a dial/timeout error) and the endpoint's circuit breaker
+// is closed. A non-empty key is sent as an Idempotency-Key header so retries
+// of Register/AckJob are safe to replay on the controller side.
+func (c *Client) do(ctx context.Context, method, endpoint string, payload interface{}, out interface{}, key string) error {
+	breaker := c.breakerFor(endpoint)
+
+	var lastErr error
+	var delay time.Duration
+	attempts := c.retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 0; attempt < attempts; attempt++ {
+		if !breaker.Allow() {
+			return fmt.Errorf("controller endpoint %s: circuit breaker open: %w", endpoint, lastErr)
+		}
+
+		err := c.doOnce(ctx, method, endpoint, payload, out, key)
+		if err == nil {
+			breaker.RecordSuccess()
+			return nil
+		}
+		lastErr = err
+
+		if !errdefs.IsRetriable(err) || attempt == attempts-1 {
+			breaker.RecordFailure()
+			return err
+		}
+		breaker.RecordFailure()
+
+		wait := c.retry.nextDelay(delay)
+		if ra := retryAfterDelay(err); ra > 0 {
+			wait = ra
+		}
+		delay = wait
+		if sleepErr := sleepWithContext(ctx, wait); sleepErr != nil {
+			return sleepErr
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) doOnce(ctx context.Context, method, endpoint string, payload interface{}, out interface{}, key string) error {
+	rel := *c.baseURL
+	rel.Path = path.Join(c.baseURL.Path, endpoint)
+
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rel.String(), body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.agentToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.agentToken)
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return decodeAPIError(res)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// decodeAPIError turns a non-2xx response into an *errdefs.APIError, decoding
+// a JSON problem body when the controller sends one and falling back to the
+// raw response body otherwise.
+func decodeAPIError(res *http.Response) error {
+	data, _ := io.ReadAll(res.Body)
+	apiErr := &errdefs.APIError{StatusCode: res.StatusCode, RetryAfter: res.Header.Get("Retry-After")}
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = fmt.Sprintf("controller request failed (%d): %s", res.StatusCode, string(data))
+	}
+	return apiErr
+}
+
+// retryAfterDelay honors a Retry-After header (seconds or HTTP-date) carried
+// by an *errdefs.APIError, if present on the underlying response.
+func retryAfterDelay(err error) time.Duration {
+	var apiErr *errdefs.APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter == "" {
+		return 0
+	}
+	if secs, parseErr := strconv.Atoi(strings.TrimSpace(apiErr.RetryAfter)); parseErr == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, parseErr := http.ParseTime(apiErr.RetryAfter); parseErr == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// idempotencyKey derives a stable key for a retried request from its logical
+// parts so the controller can dedupe replays without us persisting any state.
+func idempotencyKey(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:16])
+}
@@ -0,0 +1,87 @@
+// Package errdefs defines the typed error taxonomy returned by the controller
+// client, modelled on containerd/moby's errdefs package: callers test for a
+// category via the Is* helpers rather than matching on error strings.
+package errdefs
+
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+
+// APIError is a structured error decoded from a controller problem-detail body.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id"`
+	// RetryAfter carries the response's Retry-After header verbatim (seconds
+	// or an HTTP-date), if any, so callers can honor it without re-parsing
+	// the original response.
+	RetryAfter string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return e.Message + " (request_id=" + e.RequestID + ")"
+	}
+	return e.Message
+}
+
+type notFound interface{ NotFound() bool }
+type unauthorized interface{ Unauthorized() bool }
+type conflict interface{ Conflict() bool }
+type retriable interface{ Retriable() bool }
+
+// NotFound returns true if the error represents an HTTP 404.
+func (e *APIError) NotFound() bool { return e.StatusCode == http.StatusNotFound }
+
+// Unauthorized returns true if the error represents an HTTP 401/403.
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// Conflict returns true if the error represents an HTTP 409.
+func (e *APIError) Conflict() bool { return e.StatusCode == http.StatusConflict }
+
+// Retriable returns true if the error is a transient server or network condition.
+func (e *APIError) Retriable() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+// IsNotFound reports whether err (or any error it wraps) represents a 404.
+func IsNotFound(err error) bool {
+	var n notFound
+	return errors.As(err, &n) && n.NotFound()
+}
+
+// IsUnauthorized reports whether err (or any error it wraps) represents a 401/403.
+func IsUnauthorized(err error) bool {
+	var u unauthorized
+	return errors.As(err, &u) && u.Unauthorized()
+}
+
+// IsConflict reports whether err (or any error it wraps) represents a 409.
+func IsConflict(err error) bool {
+	var c conflict
+	return errors.As(err, &c) && c.Conflict()
+}
+
+// IsRetriable reports whether err (or any error it wraps) is a transient
+// condition worth retrying: 5xx, 408, 429, or a network-level dial/timeout error.
+func IsRetriable(err error) bool {
+	var r retriable
+	if errors.As(err, &r) {
+		return r.Retriable()
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr interface{ Timeout() bool }
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// retryPolicy controls how `do` retries a request that errdefs.IsRetriable
+// classifies as transient.
+type retryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// nextDelay computes a decorrelated-jitter backoff delay: the next delay is a
+// random value between BaseDelay and 3x the previous delay, capped at MaxDelay.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+func (p retryPolicy) nextDelay(prev time.Duration) time.Duration {
+	if prev <= 0 {
+		prev = p.BaseDelay
+	}
+	upper := prev * 3
+	if upper > p.MaxDelay {
+		upper = p.MaxDelay
+	}
+	if upper <= p.BaseDelay {
+		return p.BaseDelay
+	}
+	span := upper - p.BaseDelay
+	delay := p.BaseDelay + time.Duration(rand.Int63n(int64(span)))
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// A circuitBreaker is "closed" (requests flow), "open" (requests are rejected
+// until the cooldown elapses) or, once the cooldown elapses, "half-open"
+// (the next request is let through as a probe).
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a request may proceed, transitioning an open breaker
+// to half-open once its cooldown has elapsed.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	return !time.Now().Before(b.openUntil)
+}
+
+// RecordSuccess closes the breaker and resets the failure count.
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// RecordFailure counts a failure, opening the breaker once the configured
+// consecutive-failure threshold is reached.
+func (b *circuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// breakerFor returns the circuit breaker for a given logical endpoint,
+// creating one on first use.
+func (c *Client) breakerFor(endpoint string) *circuitBreaker {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	if c.breakers == nil {
+		c.breakers = make(map[string]*circuitBreaker)
+	}
+	b, ok := c.breakers[endpoint]
+	if !ok {
+		b = newCircuitBreaker(5, 30*time.Second)
+		c.breakers[endpoint] = b
+	}
+	return b
+}
+
+// sleepWithContext waits for d or until ctx is cancelled, whichever comes first.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
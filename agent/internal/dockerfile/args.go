@@ -0,0 +1,70 @@
+package dockerfile
+
+// BuildArgValues carries the ARG name/value bindings visible while
+// evaluating one stage.
+type BuildArgValues map[string]string
+
+// Clone returns an independent copy, so a stage can inherit the global
+// ARG bindings without a later mutation leaking back into them or into a
+// sibling stage evaluated from the same starting point.
+func (b BuildArgValues) Clone() BuildArgValues {
+	out := make(BuildArgValues, len(b))
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// MergeReferencedArgs folds global's bindings for the given referenced ARG
+// names into a clone of b, without overwriting any value b already has.
+// This mirrors Dockerfile's ARG scoping: a global ARG is invisible inside a
+// stage until the stage bare-declares it (ARG FOO with no default), at
+// which point it inherits the global's value unless the stage already set
+// one of its own.
+func (b BuildArgValues) MergeReferencedArgs(global BuildArgValues, referenced []string) BuildArgValues {
+	out := b.Clone()
+	for _, name := range referenced {
+		if _, already := out[name]; already {
+			continue
+		}
+		if v, ok := global[name]; ok {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+// referencedGlobalArgs returns the names this stage bare-declares (ARG
+// FOO, no default) - these are exactly the global ARGs it brings into
+// scope.
+func (s *Stage) referencedGlobalArgs() []string {
+	var names []string
+	for _, instr := range s.Instructions {
+		if arg, ok := instr.(ArgInstr); ok && !arg.HasDefault {
+			names = append(names, arg.Name)
+		}
+	}
+	return names
+}
+
+// GlobalArgValues returns the global ARGs' default values as a
+// BuildArgValues, ready to Clone/MergeReferencedArgs per stage.
+func (a *AST) GlobalArgValues() BuildArgValues {
+	out := make(BuildArgValues, len(a.GlobalArgs))
+	for _, arg := range a.GlobalArgs {
+		out[arg.Name] = arg.Default
+	}
+	return out
+}
+
+// StageArgValues resolves the ARG bindings visible inside stage: its own
+// declarations, plus any global ARGs it bare-declared.
+func (a *AST) StageArgValues(stage *Stage) BuildArgValues {
+	local := BuildArgValues{}
+	for _, instr := range stage.Instructions {
+		if arg, ok := instr.(ArgInstr); ok && arg.HasDefault {
+			local[arg.Name] = arg.Default
+		}
+	}
+	return local.MergeReferencedArgs(a.GlobalArgValues(), stage.referencedGlobalArgs())
+}
@@ -0,0 +1,220 @@
+// Package dockerfile parses a Dockerfile into a typed instruction AST and
+// derives a per-stage dependency graph from it, as a pre-build analysis
+// pass ahead of the existing dockerutil.BuildImage call. It does not
+// reimplement image building: the daemon (via BuildKit) already builds
+// independent stages of a single ImageBuild call concurrently, so this
+// package's job is to surface that structure for warnings (dead stages,
+// unused build args) rather than to duplicate the builder.
+package dockerfile
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instruction is implemented by every typed Dockerfile instruction.
+type Instruction interface {
+	instruction()
+}
+
+// FromInstr is a FROM instruction, optionally naming its stage via "AS".
+type FromInstr struct {
+	Image    string
+	Stage    string
+	Platform string
+}
+
+func (FromInstr) instruction() {}
+
+// ArgInstr is an ARG instruction. Default is empty when the ARG is bare
+// (ARG FOO), which is how a stage re-declares a global ARG to bring it
+// into scope per Dockerfile's ARG scoping rules.
+type ArgInstr struct {
+	Name       string
+	Default    string
+	HasDefault bool
+}
+
+func (ArgInstr) instruction() {}
+
+// CopyInstr is a COPY instruction; From is the --from=<stage> value, empty
+// if the copy is from the build context rather than another stage.
+type CopyInstr struct {
+	From string
+	Src  []string
+	Dst  string
+}
+
+func (CopyInstr) instruction() {}
+
+// RunInstr is a RUN instruction.
+type RunInstr struct {
+	Command string
+}
+
+func (RunInstr) instruction() {}
+
+// GenericInstr is any instruction this package doesn't model more
+// specifically (WORKDIR, CMD, ENTRYPOINT, ENV, EXPOSE, LABEL, ...).
+type GenericInstr struct {
+	Directive string
+	Args      string
+}
+
+func (GenericInstr) instruction() {}
+
+// Stage is one FROM..until-the-next-FROM section of a Dockerfile.
+type Stage struct {
+	Index        int
+	Name         string
+	From         FromInstr
+	Instructions []Instruction
+}
+
+// AST is a parsed Dockerfile: any ARG instructions appearing before the
+// first FROM (global args, visible to FROM lines and to any stage that
+// re-declares them bare), followed by the build's stages in file order.
+type AST struct {
+	GlobalArgs []ArgInstr
+	Stages     []*Stage
+}
+
+// Parse parses the Dockerfile text in data into a typed instruction AST.
+// It supports line continuations (trailing "\") and "#"-comment lines, and
+// is intentionally forgiving of directives it doesn't model in detail
+// (those become GenericInstr) since this package's goal is dependency and
+// ARG-scope analysis, not full Dockerfile semantics.
+func Parse(data []byte) (*AST, error) {
+	lines, err := joinContinuations(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ast := &AST{}
+	var current *Stage
+
+	for _, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, rest := splitDirective(line)
+		switch directive {
+		case "FROM":
+			from, err := parseFrom(rest)
+			if err != nil {
+				return nil, err
+			}
+			if from.Stage == "" {
+				from.Stage = strconv.Itoa(len(ast.Stages))
+			}
+			current = &Stage{Index: len(ast.Stages), Name: from.Stage, From: from}
+			ast.Stages = append(ast.Stages, current)
+		case "ARG":
+			arg := parseArg(rest)
+			if current == nil {
+				ast.GlobalArgs = append(ast.GlobalArgs, arg)
+			} else {
+				current.Instructions = append(current.Instructions, arg)
+			}
+		case "COPY":
+			if current == nil {
+				return nil, fmt.Errorf("COPY before any FROM")
+			}
+			current.Instructions = append(current.Instructions, parseCopy(rest))
+		case "RUN":
+			if current == nil {
+				return nil, fmt.Errorf("RUN before any FROM")
+			}
+			current.Instructions = append(current.Instructions, RunInstr{Command: rest})
+		default:
+			if current == nil {
+				continue
+			}
+			current.Instructions = append(current.Instructions, GenericInstr{Directive: directive, Args: rest})
+		}
+	}
+	return ast, nil
+}
+
+// joinContinuations splits data into logical lines, folding any line
+// ending in an unescaped "\" into the next one the way the Dockerfile
+// parser does.
+func joinContinuations(data []byte) ([]string, error) {
+	var lines []string
+	var pending strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		text := scanner.Text()
+		trimmed := strings.TrimRight(text, " \t")
+		if strings.HasSuffix(trimmed, "\\") && !strings.HasPrefix(strings.TrimSpace(text), "#") {
+			pending.WriteString(strings.TrimSuffix(trimmed, "\\"))
+			pending.WriteString(" ")
+			continue
+		}
+		pending.WriteString(text)
+		lines = append(lines, pending.String())
+		pending.Reset()
+	}
+	if pending.Len() > 0 {
+		lines = append(lines, pending.String())
+	}
+	return lines, scanner.Err()
+}
+
+func splitDirective(line string) (directive, rest string) {
+	fields := strings.SplitN(line, " ", 2)
+	directive = strings.ToUpper(fields[0])
+	if len(fields) == 2 {
+		rest = strings.TrimSpace(fields[1])
+	}
+	return directive, rest
+}
+
+func parseFrom(rest string) (FromInstr, error) {
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return FromInstr{}, fmt.Errorf("FROM missing image")
+	}
+	from := FromInstr{}
+	for i := 0; i < len(fields); i++ {
+		switch {
+		case strings.HasPrefix(fields[i], "--platform="):
+			from.Platform = strings.TrimPrefix(fields[i], "--platform=")
+		case from.Image == "":
+			from.Image = fields[i]
+		case strings.EqualFold(fields[i], "AS") && i+1 < len(fields):
+			from.Stage = fields[i+1]
+			i++
+		}
+	}
+	return from, nil
+}
+
+func parseArg(rest string) ArgInstr {
+	name, value, hasDefault := strings.Cut(rest, "=")
+	return ArgInstr{Name: strings.TrimSpace(name), Default: value, HasDefault: hasDefault}
+}
+
+func parseCopy(rest string) CopyInstr {
+	fields := strings.Fields(rest)
+	instr := CopyInstr{}
+	var positional []string
+	for _, f := range fields {
+		if strings.HasPrefix(f, "--from=") {
+			instr.From = strings.TrimPrefix(f, "--from=")
+			continue
+		}
+		if strings.HasPrefix(f, "--") {
+			continue
+		}
+		positional = append(positional, f)
+	}
+	if len(positional) > 0 {
+		instr.Dst = positional[len(positional)-1]
+		instr.Src = positional[:len(positional)-1]
+	}
+	return instr
+}
@@ -0,0 +1,105 @@
+package dockerfile
+
+import "fmt"
+
+// stageByName indexes a.Stages by both their explicit/auto-assigned name
+// and their numeric index, since a COPY --from= or FROM can reference
+// either.
+func (a *AST) stageByName() map[string]*Stage {
+	byName := make(map[string]*Stage, len(a.Stages)*2)
+	for _, s := range a.Stages {
+		byName[s.Name] = s
+		byName[fmt.Sprint(s.Index)] = s
+	}
+	return byName
+}
+
+// DependsOn returns the names of the stages stage directly depends on: its
+// FROM <stage> (if the base is an earlier stage rather than a registry
+// image) and any COPY --from=<stage>.
+func (a *AST) DependsOn(stage *Stage) []string {
+	byName := a.stageByName()
+	var deps []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		if _, ok := byName[name]; !ok {
+			return
+		}
+		seen[name] = true
+		deps = append(deps, name)
+	}
+	if _, ok := byName[stage.From.Image]; ok {
+		add(stage.From.Image)
+	}
+	for _, instr := range stage.Instructions {
+		if cp, ok := instr.(CopyInstr); ok {
+			add(cp.From)
+		}
+	}
+	return deps
+}
+
+// StageGraph returns the full stage dependency graph as stage name ->
+// names of stages it depends on.
+func (a *AST) StageGraph() map[string][]string {
+	graph := make(map[string][]string, len(a.Stages))
+	for _, s := range a.Stages {
+		graph[s.Name] = a.DependsOn(s)
+	}
+	return graph
+}
+
+// DeadStages returns the names of stages that neither the final stage (the
+// one actually produced as the build's output) nor any stage it transitively
+// depends on ever references - build-time dead code that only costs build
+// time and cache space.
+func (a *AST) DeadStages() []string {
+	if len(a.Stages) == 0 {
+		return nil
+	}
+	final := a.Stages[len(a.Stages)-1]
+	graph := a.StageGraph()
+
+	reachable := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if reachable[name] {
+			return
+		}
+		reachable[name] = true
+		for _, dep := range graph[name] {
+			visit(dep)
+		}
+	}
+	visit(final.Name)
+
+	var dead []string
+	for _, s := range a.Stages {
+		if !reachable[s.Name] {
+			dead = append(dead, s.Name)
+		}
+	}
+	return dead
+}
+
+// UnusedGlobalArgs returns the names of global ARGs (declared before the
+// first FROM) that no stage ever bare-declares, and so can never actually
+// take effect - almost always a typo or leftover from a refactor.
+func (a *AST) UnusedGlobalArgs() []string {
+	used := map[string]bool{}
+	for _, s := range a.Stages {
+		for _, name := range s.referencedGlobalArgs() {
+			used[name] = true
+		}
+	}
+	var unused []string
+	for _, arg := range a.GlobalArgs {
+		if !used[arg.Name] {
+			unused = append(unused, arg.Name)
+		}
+	}
+	return unused
+}
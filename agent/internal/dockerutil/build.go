@@ -1,42 +1,349 @@
 package dockerutil
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	imagetypes "github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/pkg/archive"
 )
 
-// CreateBuildContext builds a tarball for Docker image builds.
+// BuildOptions customises an image build beyond the basic context/dockerfile/tag triple.
+type BuildOptions struct {
+	Target    string
+	BuildArgs map[string]*string
+	CacheFrom []string
+	Platform  string
+
+	// Builder selects the build backend: "" or "classic" uses the daemon's
+	// ImageBuild API (BuildImage, below); "buildkit" dials a standalone
+	// buildkitd (BuildImageWithBuildKit) for the features the daemon API
+	// doesn't expose - cache export, multi-platform manifest lists, build
+	// secrets and SBOM/provenance attestations.
+	Builder string
+	// CacheTo, when Builder is "buildkit", exports the build cache to these
+	// registry or local-dir refs (the mirror of CacheFrom) so a later build
+	// of the same Dockerfile can import it.
+	CacheTo []string
+	// Platforms, when Builder is "buildkit" and more than one entry is
+	// given, produces a single manifest list spanning all of them instead
+	// of one image for Platform.
+	Platforms []string
+	// Secrets mounts build secrets for RUN --mount=type=secret
+	// instructions, only honored by the buildkit builder.
+	Secrets []BuildSecretRef
+	// SBOM and Provenance attach the corresponding buildx-style
+	// attestations to the resulting image; only honored by the buildkit
+	// builder.
+	SBOM       bool
+	Provenance bool
+}
+
+// CreateBuildContext builds a tarball for Docker image builds, honoring a `.dockerignore`
+// file in the context root if one is present.
 func CreateBuildContext(contextDir, dockerfile string) (io.ReadCloser, error) {
 	if contextDir == "" {
 		contextDir = "."
 	}
-	options := &archive.TarOptions{IncludeFiles: []string{"."}}
+	excludes, err := readDockerignore(contextDir)
+	if err != nil {
+		return nil, err
+	}
+	options := &archive.TarOptions{IncludeFiles: []string{"."}, ExcludePatterns: excludes}
 	return archive.TarWithOptions(contextDir, options)
 }
 
-// BuildImage builds a Docker image from the supplied context and dockerfile.
-func (m *Manager) BuildImage(ctx context.Context, buildCtx io.ReadCloser, dockerfile, tag string) error {
+// readDockerignore parses a `.dockerignore` file in contextDir, returning patterns
+// suitable for archive.TarOptions.ExcludePatterns. It supports `**` globs, leading
+// `!` negations, comment lines (`#`) and blank lines, matching the Docker CLI's rules.
+func readDockerignore(contextDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(contextDir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, filepath.ToSlash(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// buildProgressLine mirrors one newline-delimited JSON frame emitted by the Docker
+// daemon while streaming an image build or push. Status is only populated by
+// push frames; build frames use Stream instead.
+type buildProgressLine struct {
+	Stream      string `json:"stream,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Aux         *struct {
+		ID string `json:"ID"`
+	} `json:"aux,omitempty"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// BuildProgressDecoder turns the newline-delimited JSON frames Docker emits
+// while building or pushing an image into plain human-readable lines, so a
+// caller that wants a readable log stream doesn't have to parse frames
+// itself. It implements io.WriteCloser so it can sit in front of the
+// io.Writer BuildImage/PushImage already accept.
+type BuildProgressDecoder struct {
+	out io.Writer
+	buf bytes.Buffer
+}
+
+// NewBuildProgressDecoder wraps out, decoding each JSON frame written to the
+// returned writer into a plain text line before forwarding it to out.
+func NewBuildProgressDecoder(out io.Writer) *BuildProgressDecoder {
+	return &BuildProgressDecoder{out: out}
+}
+
+// Write implements io.Writer, buffering until full lines are available.
+func (d *BuildProgressDecoder) Write(p []byte) (int, error) {
+	d.buf.Write(p)
+	for {
+		data := d.buf.Bytes()
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		line := append([]byte{}, data[:idx]...)
+		d.buf.Next(idx + 1)
+		if err := d.decodeLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (d *BuildProgressDecoder) decodeLine(raw []byte) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	var line buildProgressLine
+	if err := json.Unmarshal(raw, &line); err != nil {
+		return nil
+	}
+	text := line.Stream
+	if text == "" {
+		text = line.Status
+	}
+	if line.ErrorDetail != nil {
+		text = "ERROR: " + line.ErrorDetail.Message
+	} else if line.Error != "" {
+		text = "ERROR: " + line.Error
+	}
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return nil
+	}
+	_, err := fmt.Fprintln(d.out, text)
+	return err
+}
+
+// Close flushes any trailing partial line. Docker always newline-terminates
+// its frames, so this only matters if the stream was cut short.
+func (d *BuildProgressDecoder) Close() error {
+	if d.buf.Len() == 0 {
+		return nil
+	}
+	line := append([]byte{}, d.buf.Bytes()...)
+	d.buf.Reset()
+	return d.decodeLine(line)
+}
+
+// BuildImage builds a Docker image from the supplied context and dockerfile, streaming
+// the daemon's build progress to progress as it arrives and returning the resulting
+// image digest on success.
+func (m *Manager) BuildImage(ctx context.Context, buildCtx io.ReadCloser, dockerfile, tag string, opts BuildOptions, progress io.Writer) (string, error) {
 	defer buildCtx.Close()
 	tag = EnsureAgentImageTag(tag)
-	ops := types.ImageBuildOptions{
+
+	buildOpts := types.ImageBuildOptions{
+		Version:    types.BuilderBuildKit,
 		Dockerfile: filepath.ToSlash(dockerfile),
 		Tags:       []string{tag},
 		Labels:     DefaultImageLabels(),
 		Remove:     true,
+		Target:     opts.Target,
+		BuildArgs:  opts.BuildArgs,
+		CacheFrom:  opts.CacheFrom,
+		Platform:   opts.Platform,
 	}
-	response, err := m.cli.ImageBuild(ctx, buildCtx, opts)
+
+	response, err := m.cli.ImageBuild(ctx, buildCtx, buildOpts)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer response.Body.Close()
-	_, _ = io.Copy(io.Discard, response.Body)
-	return nil
+
+	var digest string
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		if progress != nil {
+			frame := append(append([]byte{}, raw...), '\n')
+			if _, writeErr := progress.Write(frame); writeErr != nil {
+				return "", writeErr
+			}
+		}
+
+		var line buildProgressLine
+		if jsonErr := json.Unmarshal(raw, &line); jsonErr != nil {
+			continue
+		}
+		if line.ErrorDetail != nil {
+			return "", fmt.Errorf("image build failed: %s", line.ErrorDetail.Message)
+		}
+		if line.Error != "" {
+			return "", fmt.Errorf("image build failed: %s", line.Error)
+		}
+		if line.Aux != nil && strings.HasPrefix(line.Aux.ID, "sha256:") {
+			digest = line.Aux.ID
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if digest == "" {
+		digest, err = m.ImageDigest(ctx, tag)
+		if err != nil {
+			return "", err
+		}
+	}
+	return digest, nil
+}
+
+// pushProgressLine mirrors one newline-delimited JSON frame emitted by the
+// Docker daemon while streaming an image push.
+type pushProgressLine struct {
+	Status      string `json:"status,omitempty"`
+	Aux         *struct {
+		Tag    string `json:"Tag"`
+		Digest string `json:"Digest"`
+		Size   int    `json:"Size"`
+	} `json:"aux,omitempty"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PushImage pushes tag to its registry, streaming the daemon's push progress
+// to progress as it arrives (if non-nil) and returning the pushed manifest's
+// digest on success. Like pullIfMissing in trust.go, this plumbs no registry
+// authentication, so it only reaches registries that allow anonymous pushes.
+func (m *Manager) PushImage(ctx context.Context, tag string, progress io.Writer) (string, error) {
+	response, err := m.cli.ImagePush(ctx, tag, imagetypes.PushOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer response.Close()
+
+	var digest string
+	scanner := bufio.NewScanner(response)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		if progress != nil {
+			frame := append(append([]byte{}, raw...), '\n')
+			if _, writeErr := progress.Write(frame); writeErr != nil {
+				return "", writeErr
+			}
+		}
+
+		var line pushProgressLine
+		if jsonErr := json.Unmarshal(raw, &line); jsonErr != nil {
+			continue
+		}
+		if line.ErrorDetail != nil {
+			return "", fmt.Errorf("image push failed: %s", line.ErrorDetail.Message)
+		}
+		if line.Error != "" {
+			return "", fmt.Errorf("image push failed: %s", line.Error)
+		}
+		if line.Aux != nil && line.Aux.Digest != "" {
+			digest = line.Aux.Digest
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return "", fmt.Errorf("image push did not report a digest for %s", tag)
+	}
+	return digest, nil
+}
+
+// PullImage pulls image from its registry, streaming the daemon's pull
+// progress to progress as it arrives (if non-nil). Unlike pullIfMissing in
+// trust.go, this always pulls rather than skipping when the image is
+// already present locally, matching what a client driving /images/create
+// expects. Like pullIfMissing, this plumbs no registry authentication, so it
+// only reaches registries that allow anonymous pulls.
+func (m *Manager) PullImage(ctx context.Context, image string, progress io.Writer) error {
+	reader, err := m.cli.ImagePull(ctx, image, imagetypes.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Bytes()
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		if progress != nil {
+			frame := append(append([]byte{}, raw...), '\n')
+			if _, writeErr := progress.Write(frame); writeErr != nil {
+				return writeErr
+			}
+		}
+
+		var line pushProgressLine
+		if jsonErr := json.Unmarshal(raw, &line); jsonErr != nil {
+			continue
+		}
+		if line.ErrorDetail != nil {
+			return fmt.Errorf("image pull failed: %s", line.ErrorDetail.Message)
+		}
+		if line.Error != "" {
+			return fmt.Errorf("image pull failed: %s", line.Error)
+		}
+	}
+	return scanner.Err()
 }
 
 // SanitizeTag returns a docker-friendly tag name.
@@ -8,10 +8,9 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	imagetypes "github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 )
 
@@ -32,6 +31,7 @@ type VolumeBinding struct {
 type DeploySingleOptions struct {
 	Name          string
 	Image         string
+	TrustPolicy   ImageTrustPolicy
 	Environment   map[string]string
 	Ports         []PortBinding
 	Volumes       []VolumeBinding
@@ -42,11 +42,15 @@ type DeploySingleOptions struct {
 }
 
 // DeploySingle creates (or replaces) a single container according to options.
+// The container is pinned to the digest EnsureImage resolved rather than the
+// original (possibly mutable) tag, so a later registry push can't change
+// what's actually running.
 func (m *Manager) DeploySingle(ctx context.Context, opts DeploySingleOptions) (string, error) {
 	if opts.RestartPolicy == "" {
 		opts.RestartPolicy = "unless-stopped"
 	}
-	if err := m.EnsureImage(ctx, opts.Image); err != nil {
+	pinnedImage, err := m.EnsureImage(ctx, opts.Image, opts.TrustPolicy)
+	if err != nil {
 		return "", err
 	}
 
@@ -55,9 +59,9 @@ func (m *Manager) DeploySingle(ctx context.Context, opts DeploySingleOptions) (s
 		networking.EndpointsConfig = map[string]*network.EndpointSettings{opts.Network: {}}
 	}
 
-	ops.Labels = WithAgentLabels(opts.Labels)
+	opts.Labels = WithAgentLabels(opts.Labels)
 
-	containerConfig := &container.Config{Image: opts.Image, Env: mapToEnv(opts.Environment), Labels: opts.Labels, Healthcheck: opts.Healthcheck}
+	containerConfig := &container.Config{Image: pinnedImage, Env: mapToEnv(opts.Environment), Labels: opts.Labels, Healthcheck: opts.Healthcheck}
 	hostConfig := &container.HostConfig{RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyMode(opts.RestartPolicy)}}
 
 	if len(opts.Volumes) > 0 {
@@ -96,8 +100,18 @@ func (m *Manager) DeploySingle(ctx context.Context, opts DeploySingleOptions) (s
 	return resp.ID, nil
 }
 
-// WaitHealthy waits for container health until timeout.
+// WaitHealthy waits for container health until timeout. It honors the
+// container's own configured StartPeriod (set from a ProbeSpec's
+// InitialDelaySeconds at create time) by sleeping it out before the first
+// probe, so a slow-booting app isn't falsely failed and rolled back.
 func (m *Manager) WaitHealthy(ctx context.Context, containerID string, timeout time.Duration) error {
+	if delay := m.healthStartPeriod(ctx, containerID); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	dl := time.Now().Add(timeout)
 	for time.Now().Before(dl) {
 		ins, err := m.cli.ContainerInspect(ctx, containerID)
@@ -126,21 +140,48 @@ func (m *Manager) WaitHealthy(ctx context.Context, containerID string, timeout t
 	return fmt.Errorf("container %s did not become healthy within timeout", containerID)
 }
 
-func (m *Manager) EnsureImage(ctx context.Context, image string) error {
-	_, _, err := m.cli.ImageInspectWithRaw(ctx, image)
-	if err == nil {
-		return nil
+// WaitExit blocks until containerID stops running and returns its exit
+// code, for one-shot containers (compose's "service_completed_successfully"
+// depends_on condition) rather than the long-running services WaitHealthy
+// checks.
+func (m *Manager) WaitExit(ctx context.Context, containerID string) (int64, error) {
+	statusCh, errCh := m.cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return 0, err
+	case status := <-statusCh:
+		return status.StatusCode, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
-	if client.IsErrNotFound(err) {
-		reader, pullErr := m.cli.ImagePull(ctx, image, imagetypes.PullOptions{})
-		if pullErr != nil {
-			return pullErr
-		}
-		defer reader.Close()
-		_, _ = io.Copy(io.Discard, reader)
-		return nil
+}
+
+// healthStartPeriod returns containerID's configured healthcheck
+// StartPeriod, or 0 if it has none.
+func (m *Manager) healthStartPeriod(ctx context.Context, containerID string) time.Duration {
+	ins, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil || ins.Config == nil || ins.Config.Healthcheck == nil {
+		return 0
 	}
-	return err
+	return ins.Config.Healthcheck.StartPeriod
+}
+
+// ContainerHealthy reports a single point-in-time health snapshot, in
+// contrast to WaitHealthy's poll-until-healthy-or-timeout - used by canary
+// rollouts to check an already-healthy replica hasn't regressed partway
+// through its bake window.
+func (m *Manager) ContainerHealthy(ctx context.Context, containerID string) (bool, error) {
+	ins, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return false, err
+	}
+	if ins.State == nil {
+		return false, fmt.Errorf("container has no state information")
+	}
+	if ins.State.Health == nil {
+		return ins.State.Running, nil
+	}
+	return ins.State.Health.Status == "healthy", nil
 }
 
 func mapToEnv(env map[string]string) []string {
@@ -154,6 +195,24 @@ func mapToEnv(env map[string]string) []string {
 	return out
 }
 
+// EnsureNetwork creates a user-defined bridge network named name if one
+// doesn't already exist, so a group of related containers (e.g. the
+// services in a deploy bundle) can reach each other by container name via
+// Docker's embedded DNS.
+func (m *Manager) EnsureNetwork(ctx context.Context, name string) error {
+	existing, err := m.cli.NetworkList(ctx, types.NetworkListOptions{Filters: filters.NewArgs(filters.Arg("name", name))})
+	if err != nil {
+		return err
+	}
+	for _, n := range existing {
+		if n.Name == name {
+			return nil
+		}
+	}
+	_, err = m.cli.NetworkCreate(ctx, name, types.NetworkCreate{Driver: "bridge", Labels: WithAgentLabels(nil)})
+	return err
+}
+
 // RemoveContainer removes container by ID.
 func (m *Manager) RemoveContainer(ctx context.Context, id string, force bool) error {
 	return m.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: force, RemoveVolumes: true})
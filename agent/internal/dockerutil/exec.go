@@ -0,0 +1,70 @@
+package dockerutil
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ExecConfig describes a one-off command to run inside an already-running
+// container, mirroring the subset of the Docker Engine API's ExecConfig the
+// agent needs.
+type ExecConfig struct {
+	Cmd          []string
+	Env          []string
+	WorkingDir   string
+	Tty          bool
+	AttachStdout bool
+	AttachStderr bool
+}
+
+// ExecCreate registers a new exec instance against containerName, returning
+// its ID. Pair with ExecAttach to run it and stream output, mirroring the
+// Engine API's two-step POST /containers/{id}/exec then POST /exec/{id}/start
+// flow.
+func (m *Manager) ExecCreate(ctx context.Context, containerName string, cfg ExecConfig) (string, error) {
+	resp, err := m.cli.ContainerExecCreate(ctx, containerName, types.ExecConfig{
+		Cmd:          cfg.Cmd,
+		Env:          cfg.Env,
+		WorkingDir:   cfg.WorkingDir,
+		Tty:          cfg.Tty,
+		AttachStdout: cfg.AttachStdout,
+		AttachStderr: cfg.AttachStderr,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// ExecAttach starts execID and returns a reader over its multiplexed
+// stdout/stderr stream (the same framing Logs uses), open until the command
+// exits or ctx is cancelled. Callers should follow up with ExecInspect once
+// the reader reaches EOF to learn the exit code.
+func (m *Manager) ExecAttach(ctx context.Context, execID string, tty bool) (io.ReadCloser, error) {
+	resp, err := m.cli.ContainerExecAttach(ctx, execID, types.ExecStartCheck{Tty: tty})
+	if err != nil {
+		return nil, err
+	}
+	return &hijackedReader{Reader: resp.Reader, hijacked: resp}, nil
+}
+
+// hijackedReader adapts the hijacked connection ContainerExecAttach returns
+// (a *bufio.Reader plus a net.Conn with its own Close) to io.ReadCloser.
+type hijackedReader struct {
+	*bufio.Reader
+	hijacked types.HijackedResponse
+}
+
+func (r *hijackedReader) Close() error {
+	r.hijacked.Close()
+	return nil
+}
+
+// ExecInspect reports whether execID is still running and, once it has
+// exited, its exit code.
+func (m *Manager) ExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	return m.cli.ContainerExecInspect(ctx, execID)
+}
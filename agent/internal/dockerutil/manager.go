@@ -0,0 +1,184 @@
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Manager wraps the Docker SDK operations needed by the agent.
+type Manager struct {
+	cli *client.Client
+
+	digestCacheMu sync.Mutex
+	digestCache   map[string]remoteDigestEntry
+}
+
+// NewManager initialises the Docker client using environment configuration.
+func NewManager() (*Manager, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{cli: cli}, nil
+}
+
+// Close releases resources associated with the Docker client.
+func (m *Manager) Close() error {
+	return m.cli.Close()
+}
+
+// Version returns the Docker engine version.
+func (m *Manager) Version(ctx context.Context) (string, error) {
+	ver, err := m.cli.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return ver.Version, nil
+}
+
+// InventoryResource describes a running container for heartbeat payloads.
+// It mirrors controller.InventoryResource's wire shape field-for-field;
+// callers convert between the two at the package boundary rather than
+// dockerutil importing controller directly, which would otherwise pull
+// the agent's job payload types (imported by controller for
+// HeartbeatResponse.Job) into an import cycle through dockerutil.
+type InventoryResource struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Ports        map[string]string `json:"ports"`
+	Status       string            `json:"status"`
+	Health       string            `json:"health"`
+	RestartCount int               `json:"restart_count,omitempty"`
+}
+
+// Inventory fetches metadata about running containers for heartbeat payloads.
+func (m *Manager) Inventory(ctx context.Context) ([]InventoryResource, error) {
+	containers, err := m.cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]InventoryResource, 0, len(containers))
+	for _, c := range containers {
+		ports := map[string]string{}
+		for _, port := range c.Ports {
+			key := fmt.Sprintf("%s/%s", port.PrivatePort, port.Type)
+			ports[key] = fmt.Sprintf("%s:%d", port.IP, port.PublicPort)
+		}
+
+		health := ""
+		restartCount := 0
+		if c.State == "running" {
+			ins, err := m.cli.ContainerInspect(ctx, c.ID)
+			if err == nil {
+				if ins.State != nil && ins.State.Health != nil {
+					health = ins.State.Health.Status
+				}
+				restartCount = ins.RestartCount
+			}
+		}
+
+		resources = append(resources, InventoryResource{
+			Name:         trimLeadingSlash(c.Names),
+			Image:        c.Image,
+			Ports:        ports,
+			Status:       c.Status,
+			Health:       health,
+			RestartCount: restartCount,
+		})
+	}
+	return resources, nil
+}
+
+// Start starts an already-created container by name or ID.
+func (m *Manager) Start(ctx context.Context, name string) error {
+	return m.cli.ContainerStart(ctx, name, types.ContainerStartOptions{})
+}
+
+// Restart restarts a container by name or ID.
+func (m *Manager) Restart(ctx context.Context, name string) error {
+	return m.cli.ContainerRestart(ctx, name, container.StopOptions{})
+}
+
+// Stop stops a container by name or ID.
+func (m *Manager) Stop(ctx context.Context, name string) error {
+	return m.cli.ContainerStop(ctx, name, container.StopOptions{})
+}
+
+// Remove removes a container by name or ID.
+func (m *Manager) Remove(ctx context.Context, name string, volumes bool) error {
+	return m.cli.ContainerRemove(ctx, name, container.RemoveOptions{Force: true, RemoveVolumes: volumes})
+}
+
+// Logs returns a reader for streaming logs.
+func (m *Manager) Logs(ctx context.Context, containerName string, tail int, follow bool) (io.ReadCloser, error) {
+	options := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: follow, Tail: fmt.Sprintf("%d", tail)}
+	return m.cli.ContainerLogs(ctx, containerName, options)
+}
+
+// Stats returns a reader over the Docker daemon's /containers/{id}/stats
+// endpoint, either a single JSON sample (stream false) or a continuous
+// stream of one JSON object per update (stream true) until ctx is done.
+func (m *Manager) Stats(ctx context.Context, containerName string, stream bool) (io.ReadCloser, error) {
+	resp, err := m.cli.ContainerStats(ctx, containerName, stream)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// CopyFromContainer streams a tar archive of srcPath out of the container.
+func (m *Manager) CopyFromContainer(ctx context.Context, containerName, srcPath string) (io.ReadCloser, error) {
+	reader, _, err := m.cli.CopyFromContainer(ctx, containerName, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// TagImage tags the local image source as target, e.g. to give a
+// freshly-built image the repository reference it will be pushed under.
+func (m *Manager) TagImage(ctx context.Context, source, target string) error {
+	return m.cli.ImageTag(ctx, source, target)
+}
+
+// FindContainerByLabel locates container IDs by label.
+func (m *Manager) FindContainerByLabel(ctx context.Context, key, value string) ([]types.Container, error) {
+	args := filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", key, value)))
+	return m.cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+}
+
+func trimLeadingSlash(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	name := names[0]
+	for len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	return name
+}
+
+// ImageDigest resolves the digest associated with an image reference.
+func (m *Manager) ImageDigest(ctx context.Context, ref string) (string, error) {
+	inspect, _, err := m.cli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(inspect.RepoDigests) > 0 {
+		digest := inspect.RepoDigests[0]
+		if idx := strings.Index(digest, "@"); idx >= 0 {
+			return digest[idx+1:], nil
+		}
+		return digest, nil
+	}
+	return inspect.ID, nil
+}
@@ -0,0 +1,86 @@
+package dockerutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ErrNoMatchingPlatform is returned when a manifest list has no entry for
+// the requested (or host) platform, rather than silently falling back to
+// whatever entry the registry happens to list first.
+var ErrNoMatchingPlatform = errors.New("no manifest list entry matches the requested platform")
+
+// ResolvePlatformDigest inspects image and pins it to a single platform's
+// digest. If image is already a plain single-arch manifest its own digest
+// is returned unchanged; if it's a manifest list / OCI index, the entry
+// matching platform (an "os/arch" or "os/arch/variant" string, e.g.
+// "linux/arm64/v8") is selected, or the agent host's own
+// runtime.GOOS/GOARCH when platform is empty.
+func (m *Manager) ResolvePlatformDigest(ctx context.Context, image, platform string) (string, error) {
+	wantOS, wantArch, wantVariant, err := parsePlatform(platform)
+	if err != nil {
+		return "", err
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	desc, err := remote.Get(ref, remote.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	if !desc.MediaType.IsIndex() {
+		return desc.Digest.String(), nil
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range manifest.Manifests {
+		if entry.Platform == nil {
+			continue
+		}
+		if entry.Platform.OS != wantOS || entry.Platform.Architecture != wantArch {
+			continue
+		}
+		if wantVariant != "" && entry.Platform.Variant != wantVariant {
+			continue
+		}
+		return entry.Digest.String(), nil
+	}
+	return "", fmt.Errorf("%w: %s/%s%s", ErrNoMatchingPlatform, wantOS, wantArch, variantSuffix(wantVariant))
+}
+
+// parsePlatform splits a "os/arch" or "os/arch/variant" string, defaulting
+// to the agent host's own runtime.GOOS/GOARCH when platform is empty.
+func parsePlatform(platform string) (os, arch, variant string, err error) {
+	if platform == "" {
+		return runtime.GOOS, runtime.GOARCH, "", nil
+	}
+	parts := strings.Split(platform, "/")
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], "", nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	default:
+		return "", "", "", fmt.Errorf("invalid platform %q, expected os/arch or os/arch/variant", platform)
+	}
+}
+
+func variantSuffix(variant string) string {
+	if variant == "" {
+		return ""
+	}
+	return "/" + variant
+}
@@ -0,0 +1,118 @@
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// remoteDigestCacheTTL bounds how long ResolveRemoteDigest trusts a
+// previously resolved digest before repeating the registry round trip, so an
+// admission check run on every heartbeat doesn't hammer the registry for an
+// image whose tag hasn't moved since the last check.
+const remoteDigestCacheTTL = 2 * time.Minute
+
+type remoteDigestEntry struct {
+	digest    string
+	expiresAt time.Time
+}
+
+// ResolveRemoteDigest resolves ref's current digest directly against its
+// registry - an authenticated HEAD against /v2/<name>/manifests/<tag>,
+// following the WWW-Authenticate bearer challenge and negotiating both the
+// Docker v2 manifest and OCI index media types - without ever pulling the
+// image locally, via the same go-containerregistry client trust.go already
+// uses for cosign signature lookups. This lets a RequireImageDigest-style
+// gate reject a bad image before EnsureImage would spend any bandwidth
+// pulling it.
+//
+// ref is normalized with the same rules distribution/reference applies (a
+// bare "nginx" becomes docker.io/library/nginx:latest); unparsable or
+// ambiguous references are rejected before any network call. Credentials
+// come from ~/.docker/config.json via the default keychain. allowedRegistries,
+// mirroring Handler.enforceImagePolicy's RegistryAllowList check, is
+// consulted before the round trip so this function never contacts a
+// registry the agent wouldn't otherwise be willing to pull from; an empty
+// allowedRegistries disables that check. A ref already pinned by digest is
+// returned as-is with no network call. Results are cached in-memory for a
+// short TTL keyed by registry/repository/tag.
+func (m *Manager) ResolveRemoteDigest(ctx context.Context, ref string, allowedRegistries []string) (string, error) {
+	parsed, err := name.ParseReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("parse image reference %q: %w", ref, err)
+	}
+	if digested, ok := parsed.(name.Digest); ok {
+		return digested.DigestStr(), nil
+	}
+	tagged, ok := parsed.(name.Tag)
+	if !ok {
+		return "", fmt.Errorf("image reference %q is neither tagged nor pinned by digest", ref)
+	}
+
+	registry := registryHost(ref)
+	if len(allowedRegistries) > 0 && !registryAllowlisted(registry, allowedRegistries) {
+		return "", fmt.Errorf("image registry %s not allowlisted", registry)
+	}
+
+	cacheKey := tagged.Context().RegistryStr() + "/" + tagged.Context().RepositoryStr() + ":" + tagged.TagStr()
+	if digest, ok := m.cachedRemoteDigest(cacheKey); ok {
+		return digest, nil
+	}
+
+	desc, err := remote.Head(tagged, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return "", fmt.Errorf("resolve remote digest for %s: %w", ref, err)
+	}
+	digest := desc.Digest.String()
+	m.storeRemoteDigest(cacheKey, digest)
+	return digest, nil
+}
+
+func (m *Manager) cachedRemoteDigest(key string) (string, bool) {
+	m.digestCacheMu.Lock()
+	defer m.digestCacheMu.Unlock()
+	entry, ok := m.digestCache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.digest, true
+}
+
+func (m *Manager) storeRemoteDigest(key, digest string) {
+	m.digestCacheMu.Lock()
+	defer m.digestCacheMu.Unlock()
+	if m.digestCache == nil {
+		m.digestCache = make(map[string]remoteDigestEntry)
+	}
+	m.digestCache[key] = remoteDigestEntry{digest: digest, expiresAt: time.Now().Add(remoteDigestCacheTTL)}
+}
+
+// registryHost extracts the registry host ref would be pulled from,
+// mirroring jobs.imageRegistry's heuristic (a first path segment containing
+// a "." or ":", or literally "localhost", is a registry host; otherwise the
+// image is assumed to be a Docker Hub library/user image). Deliberately
+// duplicated rather than imported: dockerutil must not depend on the jobs
+// package, the same layering already kept between controller's wire types
+// and their internal-package counterparts.
+func registryHost(ref string) string {
+	parts := strings.SplitN(ref, "/", 2)
+	candidate := parts[0]
+	if strings.Contains(candidate, ":") || strings.Contains(candidate, ".") || candidate == "localhost" {
+		return candidate
+	}
+	return "docker.io"
+}
+
+func registryAllowlisted(registry string, allowlist []string) bool {
+	for _, candidate := range allowlist {
+		if strings.EqualFold(registry, strings.TrimSpace(candidate)) {
+			return true
+		}
+	}
+	return false
+}
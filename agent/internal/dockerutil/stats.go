@@ -0,0 +1,86 @@
+package dockerutil
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ContainerStats is a single point-in-time sample of a container's resource
+// usage, derived from the Docker stats API the same way `docker stats`
+// computes its columns.
+type ContainerStats struct {
+	CPUPercent      float64
+	MemUsageBytes   uint64
+	MemLimitBytes   uint64
+	NetworkRxBytes  uint64
+	NetworkTxBytes  uint64
+	BlkioReadBytes  uint64
+	BlkioWriteBytes uint64
+}
+
+// ContainerStatsSnapshot takes one non-streaming sample of containerName's
+// resource usage.
+func (m *Manager) ContainerStatsSnapshot(ctx context.Context, containerName string) (ContainerStats, error) {
+	reader, err := m.Stats(ctx, containerName, false)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	defer reader.Close()
+
+	var raw types.StatsJSON
+	if err := json.NewDecoder(reader).Decode(&raw); err != nil {
+		return ContainerStats{}, err
+	}
+	return ContainerStats{
+		CPUPercent:      cpuPercent(raw),
+		MemUsageBytes:   raw.MemoryStats.Usage,
+		MemLimitBytes:   raw.MemoryStats.Limit,
+		NetworkRxBytes:  networkBytes(raw, func(n types.NetworkStats) uint64 { return n.RxBytes }),
+		NetworkTxBytes:  networkBytes(raw, func(n types.NetworkStats) uint64 { return n.TxBytes }),
+		BlkioReadBytes:  blkioBytes(raw, "Read"),
+		BlkioWriteBytes: blkioBytes(raw, "Write"),
+	}, nil
+}
+
+// cpuPercent reproduces the CLI's "docker stats" CPU% calculation: the
+// container's share of host CPU time consumed since the previous sample,
+// scaled by the number of online CPUs.
+func cpuPercent(s types.StatsJSON) float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if systemDelta <= 0 || cpuDelta <= 0 {
+		return 0
+	}
+	onlineCPUs := float64(s.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if onlineCPUs == 0 {
+		onlineCPUs = 1
+	}
+	return (cpuDelta / systemDelta) * onlineCPUs * 100.0
+}
+
+// networkBytes sums extract across every network interface Docker reports
+// for the container (there is one entry per interface, not one aggregate).
+func networkBytes(s types.StatsJSON, extract func(types.NetworkStats) uint64) uint64 {
+	var total uint64
+	for _, n := range s.Networks {
+		total += extract(n)
+	}
+	return total
+}
+
+// blkioBytes sums the recursive block I/O entries matching op ("Read" or
+// "Write"), the same field docker stats' BLOCK I/O column reads.
+func blkioBytes(s types.StatsJSON, op string) uint64 {
+	var total uint64
+	for _, entry := range s.BlkioStats.IoServiceBytesRecursive {
+		if entry.Op == op {
+			total += entry.Value
+		}
+	}
+	return total
+}
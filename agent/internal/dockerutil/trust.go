@@ -0,0 +1,264 @@
+package dockerutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"deploybot-agent/internal/imagepolicy"
+
+	imagetypes "github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// cosignSignatureAnnotation is the annotation cosign attaches to the layer of
+// a signature image that carries the base64 signature over that layer's
+// (unmodified) simple-signing payload.
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+var (
+	// ErrMutableReference is returned when RequireDigest is set and the
+	// caller supplied a tag instead of a digest reference.
+	ErrMutableReference = errors.New("image reference is not pinned to a digest")
+	// ErrDigestNotAllowed is returned when the resolved digest is not on the
+	// policy's allow-list for the image's registry/repository prefix.
+	ErrDigestNotAllowed = errors.New("image digest is not on the trust allow-list")
+	// ErrSignatureMissing is returned when a signer key set is configured
+	// but no signature artifact could be found for the image.
+	ErrSignatureMissing = errors.New("image signature artifact not found")
+	// ErrSignatureInvalid is returned when a signature artifact was found
+	// but did not verify against any configured signer key.
+	ErrSignatureInvalid = errors.New("image signature verification failed")
+)
+
+// ImageTrustPolicy governs which images EnsureImage is willing to run.
+type ImageTrustPolicy struct {
+	// AllowedDigests maps a registry/repository prefix (e.g.
+	// "registry.example.com/team/") to the sha256 digests permitted for
+	// images under that prefix. A nil/empty map disables allow-list
+	// enforcement.
+	AllowedDigests map[string][]string
+	// SignerKeys, when non-empty, makes EnsureImage additionally require a
+	// valid OCI signature artifact signed by one of them. Callers populate
+	// this from the same imagepolicy.TrustedKey set (TrustedSignerKeys)
+	// imagepolicy.VerifyImage checks controller-supplied signatures
+	// against, rather than this package loading its own separate signer
+	// key file - one key source for both verification paths.
+	SignerKeys []imagepolicy.TrustedKey
+	// RequireDigest rejects mutable tag references outright, before any
+	// resolution is attempted.
+	RequireDigest bool
+}
+
+// LoadImageTrustPolicy builds an ImageTrustPolicy from an on-disk digest
+// allow-list: a JSON object of registry/repo prefix to allowed digests.
+// digestsFile may be empty to skip digest allow-listing entirely. Signer
+// keys are not loaded here - set ImageTrustPolicy.SignerKeys from
+// imagepolicy.LoadTrustedKeys/ParseTrustedKeys instead.
+func LoadImageTrustPolicy(digestsFile string) (ImageTrustPolicy, error) {
+	var policy ImageTrustPolicy
+	if digestsFile != "" {
+		data, err := os.ReadFile(digestsFile)
+		if err != nil {
+			return ImageTrustPolicy{}, fmt.Errorf("read image digest allow-list: %w", err)
+		}
+		if err := json.Unmarshal(data, &policy.AllowedDigests); err != nil {
+			return ImageTrustPolicy{}, fmt.Errorf("parse image digest allow-list: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+// EnsureImage makes sure image is present locally, pulling it if needed, then
+// enforces policy against the resolved digest and returns the image pinned
+// to that digest (repo@sha256:...) so callers never run a mutable tag.
+func (m *Manager) EnsureImage(ctx context.Context, image string, policy ImageTrustPolicy) (string, error) {
+	if policy.RequireDigest && !strings.Contains(image, "@sha256:") {
+		return "", fmt.Errorf("%w: %s", ErrMutableReference, image)
+	}
+	if err := m.pullIfMissing(ctx, image); err != nil {
+		return "", err
+	}
+	digest, err := m.resolveDigest(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if len(policy.AllowedDigests) > 0 && !digestAllowed(policy.AllowedDigests, image, digest) {
+		return "", fmt.Errorf("%w: %s@%s", ErrDigestNotAllowed, image, digest)
+	}
+	if len(policy.SignerKeys) > 0 {
+		if err := verifyCosignSignature(ctx, image, digest, policy.SignerKeys); err != nil {
+			return "", err
+		}
+	}
+	return repositoryName(image) + "@" + digest, nil
+}
+
+func (m *Manager) pullIfMissing(ctx context.Context, image string) error {
+	_, _, err := m.cli.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return err
+	}
+	reader, pullErr := m.cli.ImagePull(ctx, image, imagetypes.PullOptions{})
+	if pullErr != nil {
+		return pullErr
+	}
+	defer reader.Close()
+	_, _ = io.Copy(io.Discard, reader)
+	return nil
+}
+
+// resolveDigest returns the sha256 digest (as "sha256:...") that image
+// currently refers to, preferring the locally recorded RepoDigests and
+// falling back to a registry round trip via DistributionInspect.
+func (m *Manager) resolveDigest(ctx context.Context, image string) (string, error) {
+	if idx := strings.Index(image, "@sha256:"); idx >= 0 {
+		return image[idx+len("@"):], nil
+	}
+	repo := repositoryName(image)
+	inspect, _, inspectErr := m.cli.ImageInspectWithRaw(ctx, image)
+	if inspectErr == nil {
+		for _, rd := range inspect.RepoDigests {
+			if at := strings.LastIndex(rd, "@"); at >= 0 && rd[:at] == repo {
+				return rd[at+1:], nil
+			}
+		}
+	}
+	dist, err := m.cli.DistributionInspect(ctx, image, "")
+	if err != nil {
+		if inspectErr != nil {
+			return "", inspectErr
+		}
+		return "", err
+	}
+	return dist.Descriptor.Digest.String(), nil
+}
+
+func digestAllowed(allow map[string][]string, image, digest string) bool {
+	for prefix, digests := range allow {
+		if !strings.HasPrefix(image, prefix) {
+			continue
+		}
+		for _, d := range digests {
+			if d == digest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func repositoryName(image string) string {
+	ref := image
+	if at := strings.Index(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	return ref
+}
+
+// signatureTag is cosign's default simple-signing tag convention for a
+// signed digest: "sha256-<hex>.sig".
+func signatureTag(digest string) string {
+	return strings.ReplaceAll(digest, ":", "-") + ".sig"
+}
+
+// verifyCosignSignature pulls the cosign-style signature artifact for
+// image@digest from the registry directly (the signature lives as an
+// annotated layer on a side manifest, which the docker engine API has no way
+// to surface) and checks it against one of keys - the same
+// imagepolicy.TrustedKey set (ECDSA or Ed25519) that VerifyImage checks
+// controller-supplied signature blobs against, so both verification paths
+// trust the same keys. The artifact's repository binding is established by
+// where it was fetched from (the image's own sha256-<digest>.sig tag), so
+// unlike imagepolicy.VerifySignature this only needs to match the digest,
+// not a signed docker-reference identity field.
+func verifyCosignSignature(ctx context.Context, image, digest string, keys []imagepolicy.TrustedKey) error {
+	ref, err := name.ParseReference(repositoryName(image) + ":" + signatureTag(digest))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureMissing, err)
+	}
+	desc, err := remote.Get(ref, remote.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureMissing, err)
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureMissing, err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureMissing, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		sigB64 := layer.Annotations[cosignSignatureAnnotation]
+		if sigB64 == "" {
+			continue
+		}
+		l, err := img.LayerByDigest(layer.Digest)
+		if err != nil {
+			continue
+		}
+		rc, err := l.Uncompressed()
+		if err != nil {
+			continue
+		}
+		payload, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		if !payloadMatchesDigest(payload, digest) {
+			continue
+		}
+		sigBytes, err := base64.StdEncoding.DecodeString(sigB64)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(payload)
+		for _, key := range keys {
+			switch {
+			case key.ECDSA != nil && ecdsa.VerifyASN1(key.ECDSA, sum[:], sigBytes):
+				return nil
+			case key.Ed25519 != nil && ed25519.Verify(key.Ed25519, payload, sigBytes):
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrSignatureInvalid, image)
+}
+
+// simpleSigningPayload is the "simple signing" JSON document cosign embeds
+// as the signature image's layer: it binds the signature to a specific
+// manifest digest so a signature can't be replayed against another image.
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+func payloadMatchesDigest(payload []byte, digest string) bool {
+	var doc simpleSigningPayload
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return false
+	}
+	return doc.Critical.Image.DockerManifestDigest == digest
+}
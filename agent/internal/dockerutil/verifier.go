@@ -0,0 +1,35 @@
+package dockerutil
+
+import (
+	"context"
+	"errors"
+
+	"deploybot-agent/internal/imagepolicy"
+)
+
+// SignatureVerifier checks that image@digest carries a valid signature
+// artifact, behind an interface so an alternative signing scheme (Notary
+// v2, an in-house signer) can be substituted for CosignVerifier without
+// touching callers, which only ever see this interface.
+type SignatureVerifier interface {
+	VerifySignature(ctx context.Context, image, digest string) error
+}
+
+// CosignVerifier is the default SignatureVerifier, backed by the same
+// cosign simple-signing convention EnsureImage already checks: a side
+// image tagged sha256-<digest>.sig, carrying a layer annotated with a
+// base64 signature over that layer's payload, verified against one of
+// Keys - the same imagepolicy.TrustedKey set (ECDSA or Ed25519) used to
+// check controller-supplied signature blobs, so there is one key type and
+// one key-loading path for both.
+type CosignVerifier struct {
+	Keys []imagepolicy.TrustedKey
+}
+
+// VerifySignature implements SignatureVerifier.
+func (v CosignVerifier) VerifySignature(ctx context.Context, image, digest string) error {
+	if len(v.Keys) == 0 {
+		return errors.New("cosign verifier: no signer keys configured")
+	}
+	return verifyCosignSignature(ctx, image, digest, v.Keys)
+}
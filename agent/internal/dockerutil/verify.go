@@ -0,0 +1,46 @@
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+
+	"deploybot-agent/internal/imagepolicy"
+)
+
+// VerificationResult reports the signature-verification outcome for one
+// image, including which trusted key IDs actually matched, so callers can
+// audit exactly what verified without re-deriving it from the raw
+// signature blobs.
+type VerificationResult struct {
+	ResolvedRef    string   `json:"resolved_ref"`
+	ResolvedDigest string   `json:"resolved_digest"`
+	MatchedKeyIDs  []string `json:"matched_key_ids"`
+	Verified       bool     `json:"verified"`
+}
+
+// VerifyImage resolves ref to its canonical name@digest form and checks
+// sigs (controller-supplied signature blobs, distinct from the
+// registry-fetched cosign artifact EnsureImage already checks) against
+// keys, succeeding only once at least threshold distinct keys verify a
+// signature bound to both digest and ref's repository identity.
+func (m *Manager) VerifyImage(ctx context.Context, ref, digest string, sigs []string, keys []imagepolicy.TrustedKey, threshold int) (VerificationResult, error) {
+	canonical, err := imagepolicy.ParseReference(ref)
+	if err != nil {
+		return VerificationResult{}, fmt.Errorf("parse image reference: %w", err)
+	}
+	result := VerificationResult{ResolvedRef: canonical.String(), ResolvedDigest: digest}
+	seen := map[string]bool{}
+	for _, sig := range sigs {
+		keyID, ok := imagepolicy.VerifySignature([]byte(sig), digest, canonical.Name(), keys)
+		if !ok || seen[keyID] {
+			continue
+		}
+		seen[keyID] = true
+		result.MatchedKeyIDs = append(result.MatchedKeyIDs, keyID)
+	}
+	result.Verified = len(result.MatchedKeyIDs) >= threshold
+	if !result.Verified {
+		return result, fmt.Errorf("only %d/%d required signatures verified for %s", len(result.MatchedKeyIDs), threshold, canonical.String())
+	}
+	return result, nil
+}
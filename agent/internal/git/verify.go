@@ -0,0 +1,362 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrUnsigned is returned when the commit carries no signature at all.
+	ErrUnsigned = errors.New("commit is not signed")
+	// ErrUnknownSigner is returned when the signature is well-formed but
+	// does not match any key in the trusted bundle.
+	ErrUnknownSigner = errors.New("commit signature does not match any trusted key")
+	// ErrBadSignature is returned when a matching key's signature fails
+	// cryptographic verification, or the signature is malformed.
+	ErrBadSignature = errors.New("commit signature failed verification")
+)
+
+const sshSigNamespace = "git"
+
+// SignatureOptions carries the trusted-key material used to verify a commit's signature.
+type SignatureOptions struct {
+	// ArmoredKeyring is a PGP keyring in armored form, used to verify
+	// "-----BEGIN PGP SIGNATURE-----" commits.
+	ArmoredKeyring []byte
+	// AllowedSigners holds `ssh-keygen -Y verify` allowed_signers lines
+	// ("principal [options] key-type key-base64"), used to verify
+	// "-----BEGIN SSH SIGNATURE-----" commits.
+	AllowedSigners []string
+}
+
+// SignatureInfo describes the key that produced a verified signature.
+type SignatureInfo struct {
+	Method      string // "pgp" or "ssh"
+	Fingerprint string
+	Identity    string
+}
+
+// VerifySignature verifies the signature on workdir's current HEAD commit
+// against opts and returns the signer's identity on success. It returns
+// ErrUnsigned, ErrUnknownSigner or ErrBadSignature on failure so callers can
+// decide how to react (e.g. reject the deploy) without string matching.
+func VerifySignature(workdir string, opts SignatureOptions) (*SignatureInfo, error) {
+	repo, err := git.PlainOpen(workdir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if commit.PGPSignature == "" {
+		return nil, ErrUnsigned
+	}
+	if strings.Contains(commit.PGPSignature, "BEGIN SSH SIGNATURE") {
+		return verifySSHSignature(commit, opts)
+	}
+	return verifyPGPSignature(commit, opts)
+}
+
+func verifyPGPSignature(commit *object.Commit, opts SignatureOptions) (*SignatureInfo, error) {
+	if len(opts.ArmoredKeyring) == 0 {
+		return nil, ErrUnknownSigner
+	}
+	entity, err := commit.Verify(string(opts.ArmoredKeyring))
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			return nil, ErrUnknownSigner
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	info := &SignatureInfo{
+		Method:      "pgp",
+		Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+	}
+	for _, id := range entity.Identities {
+		info.Identity = id.Name
+		break
+	}
+	return info, nil
+}
+
+// sshSignature is the decoded form of a "-----BEGIN SSH SIGNATURE-----"
+// block, per OpenSSH's PROTOCOL.sshsig.
+type sshSignature struct {
+	publicKeyBlob []byte
+	namespace     string
+	hashAlgorithm string
+	sigFormat     string
+	sigBlob       []byte
+}
+
+func verifySSHSignature(commit *object.Commit, opts SignatureOptions) (*SignatureInfo, error) {
+	if len(opts.AllowedSigners) == 0 {
+		return nil, ErrUnknownSigner
+	}
+	sig, err := parseSSHArmor(commit.PGPSignature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if sig.namespace != sshSigNamespace {
+		return nil, fmt.Errorf("%w: unexpected signature namespace %q", ErrBadSignature, sig.namespace)
+	}
+
+	pubKey, err := ssh.ParsePublicKey(sig.publicKeyBlob)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := hashPayload(sig.hashAlgorithm, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	toVerify := sshSigWrapper(sig.namespace, sig.hashAlgorithm, digest)
+	if err := pubKey.Verify(toVerify, &ssh.Signature{Format: sig.sigFormat, Blob: sig.sigBlob}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+
+	principal, ok := matchAllowedSigner(opts.AllowedSigners, pubKey, sig.namespace)
+	if !ok {
+		return nil, ErrUnknownSigner
+	}
+	return &SignatureInfo{
+		Method:      "ssh",
+		Fingerprint: ssh.FingerprintSHA256(pubKey),
+		Identity:    principal,
+	}, nil
+}
+
+// parseSSHArmor decodes a "-----BEGIN SSH SIGNATURE-----" armored block into
+// its constituent fields, per OpenSSH's PROTOCOL.sshsig.
+func parseSSHArmor(armored string) (*sshSignature, error) {
+	const (
+		beginMarker = "-----BEGIN SSH SIGNATURE-----"
+		endMarker   = "-----END SSH SIGNATURE-----"
+		magic       = "SSHSIG"
+	)
+	start := strings.Index(armored, beginMarker)
+	end := strings.Index(armored, endMarker)
+	if start < 0 || end < 0 || end < start {
+		return nil, errors.New("malformed SSH signature armor")
+	}
+	body := armored[start+len(beginMarker) : end]
+	raw, err := base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, body))
+	if err != nil {
+		return nil, fmt.Errorf("decode SSH signature: %w", err)
+	}
+	if len(raw) < len(magic) || string(raw[:len(magic)]) != magic {
+		return nil, errors.New("SSH signature missing SSHSIG magic preamble")
+	}
+	r := bytes.NewReader(raw[len(magic):])
+
+	var version uint32
+	if err := readUint32(r, &version); err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", version)
+	}
+	pubKeyBlob, err := readSSHString(r)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := readSSHString(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readSSHString(r); err != nil { // reserved
+		return nil, err
+	}
+	hashAlg, err := readSSHString(r)
+	if err != nil {
+		return nil, err
+	}
+	sigBlob, err := readSSHString(r)
+	if err != nil {
+		return nil, err
+	}
+	sigFormat, sigValue, err := splitSSHSignatureBlob(sigBlob)
+	if err != nil {
+		return nil, err
+	}
+	return &sshSignature{
+		publicKeyBlob: pubKeyBlob,
+		namespace:     string(namespace),
+		hashAlgorithm: string(hashAlg),
+		sigFormat:     sigFormat,
+		sigBlob:       sigValue,
+	}, nil
+}
+
+func splitSSHSignatureBlob(blob []byte) (format string, value []byte, err error) {
+	r := bytes.NewReader(blob)
+	f, err := readSSHString(r)
+	if err != nil {
+		return "", nil, err
+	}
+	v, err := readSSHString(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(f), v, nil
+}
+
+func readUint32(r *bytes.Reader, out *uint32) error {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	*out = binary.BigEndian.Uint32(buf[:])
+	return nil
+}
+
+func readSSHString(r *bytes.Reader) ([]byte, error) {
+	var length uint32
+	if err := readUint32(r, &length); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// sshSigWrapper reconstructs the "to-be-signed" blob described by
+// PROTOCOL.sshsig: the magic preamble followed by the namespace, an empty
+// reserved field, the hash algorithm name and the digest of the payload —
+// all as SSH wire-format strings.
+func sshSigWrapper(namespace, hashAlgorithm string, digest []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("SSHSIG")
+	writeSSHString(&buf, []byte(namespace))
+	writeSSHString(&buf, nil)
+	writeSSHString(&buf, []byte(hashAlgorithm))
+	writeSSHString(&buf, digest)
+	return buf.Bytes()
+}
+
+func writeSSHString(buf *bytes.Buffer, v []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(v)))
+	buf.Write(length[:])
+	buf.Write(v)
+}
+
+func hashPayload(algorithm string, payload []byte) ([]byte, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported signature hash algorithm %q", algorithm)
+	}
+	h.Write(payload)
+	return h.Sum(nil), nil
+}
+
+// matchAllowedSigner looks up pubKey among the allowed_signers lines,
+// honoring a "namespaces=..." option when present, and returns the
+// matching principal.
+func matchAllowedSigner(lines []string, pubKey ssh.PublicKey, namespace string) (string, bool) {
+	target := pubKey.Marshal()
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		principals := fields[0]
+		rest := fields[1:]
+		if ns, ok := findOption(rest, "namespaces"); ok && !namespaceAllowed(ns, namespace) {
+			continue
+		}
+		keyFields := keyPortion(rest)
+		if keyFields == "" {
+			continue
+		}
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyFields))
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(parsed.Marshal(), target) {
+			return principals, true
+		}
+	}
+	return "", false
+}
+
+// findOption extracts the value of a comma-separated "key=value" or
+// "key=\"value\"" option from an allowed_signers field list.
+func findOption(fields []string, key string) (string, bool) {
+	prefix := key + "="
+	for _, f := range fields {
+		if strings.HasPrefix(f, prefix) {
+			return strings.Trim(f[len(prefix):], `"`), true
+		}
+	}
+	return "", false
+}
+
+func namespaceAllowed(allowed, namespace string) bool {
+	for _, ns := range strings.Split(strings.Trim(allowed, `"`), ",") {
+		if strings.TrimSpace(ns) == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// keyPortion returns the "key-type key-base64[ comment]" suffix of an
+// allowed_signers field list, skipping any leading "opt=value" options.
+func keyPortion(fields []string) string {
+	for i, f := range fields {
+		if !strings.Contains(f, "=") {
+			return strings.Join(fields[i:], " ")
+		}
+	}
+	return ""
+}
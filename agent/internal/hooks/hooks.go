@@ -0,0 +1,261 @@
+// Package hooks implements pluggable pre/post-deploy hooks, borrowing the
+// shape of Podman's hooks package: hook definitions are JSON files dropped
+// into well-known directories, matched against a container's stage,
+// labels, and image, and executed with the container's state piped to
+// stdin as JSON - the same contract OCI runtime hooks use.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage identifies one of the points in a deploy deployContainerWithRollback
+// invokes hooks at.
+const (
+	StagePrePull      = "prePull"
+	StagePreStart     = "preStart"
+	StagePostStart    = "postStart"
+	StagePostRollback = "postRollback"
+)
+
+// defaultDirs is scanned when a Manager is constructed with no directories
+// of its own, mirroring Podman's system + per-user hooks.d layout.
+var defaultDirs = []string{"/etc/deploybot/hooks.d", "$HOME/.config/deploybot/hooks.d"}
+
+// defaultTimeout bounds a hook's run time when its definition doesn't set
+// one.
+const defaultTimeout = 30 * time.Second
+
+// Spec is the command a hook definition runs.
+type Spec struct {
+	Path    string   `json:"path"`
+	Args    []string `json:"args"`
+	Env     []string `json:"env"`
+	Timeout int      `json:"timeout"`
+}
+
+// When gates whether a hook fires for a given container: Always bypasses
+// Labels/Images entirely; otherwise every configured Labels key must match
+// exactly and, if Images is non-empty, the container's image must match at
+// least one of its regexps. A Definition with no Labels, Images, or Always
+// set fires for every container at its listed Stages.
+type When struct {
+	Labels map[string]string `json:"labels"`
+	Images []string          `json:"images"`
+	Always bool              `json:"always"`
+}
+
+// Definition is a single hooks.d/*.json file.
+type Definition struct {
+	Version string   `json:"version"`
+	Hook    Spec     `json:"hook"`
+	When    When     `json:"when"`
+	Stages  []string `json:"stages"`
+
+	file         string
+	imageMatches []*regexp.Regexp
+}
+
+// State is the container state piped to a hook's stdin as JSON, mirroring
+// the OCI runtime hook contract's container-state-on-stdin convention.
+type State struct {
+	Stage  string            `json:"stage"`
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Image  string            `json:"image"`
+	Labels map[string]string `json:"labels"`
+	Env    []string          `json:"env"`
+}
+
+// Manager loads and runs the hook definitions found under its configured
+// directories, caching the parsed set for the lifetime of the process -
+// hooks.d is operator-managed and isn't expected to change while the agent
+// is running.
+type Manager struct {
+	dirs []string
+
+	once         sync.Once
+	defs         []Definition
+	loadWarnings []string
+}
+
+// NewManager builds a Manager that scans dirs (or, if empty, the built-in
+// system + per-user hooks.d locations) for hook definitions on first use.
+func NewManager(dirs []string) *Manager {
+	if len(dirs) == 0 {
+		dirs = defaultDirs
+	}
+	return &Manager{dirs: dirs}
+}
+
+func (m *Manager) load() {
+	m.once.Do(func() {
+		var defs []Definition
+		for _, dir := range m.dirs {
+			dir = expandHome(dir)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				// A missing hooks.d directory is the common case (most
+				// agents configure none of them), not a load failure.
+				continue
+			}
+			for _, entry := range entries {
+				if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+					continue
+				}
+				path := filepath.Join(dir, entry.Name())
+				data, err := os.ReadFile(path)
+				if err != nil {
+					m.loadWarnings = append(m.loadWarnings, fmt.Sprintf("read hook %s: %v", path, err))
+					continue
+				}
+				var def Definition
+				if err := json.Unmarshal(data, &def); err != nil {
+					m.loadWarnings = append(m.loadWarnings, fmt.Sprintf("parse hook %s: %v", path, err))
+					continue
+				}
+				def.file = entry.Name()
+				var badPattern error
+				for _, pattern := range def.When.Images {
+					re, err := regexp.Compile(pattern)
+					if err != nil {
+						badPattern = err
+						break
+					}
+					def.imageMatches = append(def.imageMatches, re)
+				}
+				if badPattern != nil {
+					m.loadWarnings = append(m.loadWarnings, fmt.Sprintf("hook %s: invalid image pattern: %v", path, badPattern))
+					continue
+				}
+				defs = append(defs, def)
+			}
+		}
+		sort.Slice(defs, func(i, j int) bool { return defs[i].file < defs[j].file })
+		m.defs = defs
+	})
+}
+
+// LoadWarnings reports any hook definitions that failed to load or parse,
+// for the caller to audit; loading itself never fails a deploy.
+func (m *Manager) LoadWarnings() []string {
+	m.load()
+	return m.loadWarnings
+}
+
+// Run executes every loaded hook matching stage against state, in filename
+// order, piping state as JSON to each hook's stdin. If fatal is true, Run
+// stops and returns the first hook failure (preStart aborts and rolls
+// back); otherwise every matching hook runs regardless of earlier
+// failures and their errors are combined into one (postStart/postRollback
+// are logged but non-fatal).
+func (m *Manager) Run(ctx context.Context, stage string, state State, fatal bool) error {
+	m.load()
+	state.Stage = stage
+	var failures []string
+	for _, def := range m.defs {
+		if !def.matches(stage, state) {
+			continue
+		}
+		if err := def.run(ctx, state); err != nil {
+			msg := fmt.Sprintf("%s: %v", def.file, err)
+			if fatal {
+				return fmt.Errorf("hook %s", msg)
+			}
+			failures = append(failures, msg)
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("hook failures at %s: %s", stage, strings.Join(failures, "; "))
+}
+
+func (d Definition) matches(stage string, state State) bool {
+	staged := false
+	for _, s := range d.Stages {
+		if s == stage {
+			staged = true
+			break
+		}
+	}
+	if !staged {
+		return false
+	}
+	if d.When.Always {
+		return true
+	}
+	for k, v := range d.When.Labels {
+		if state.Labels[k] != v {
+			return false
+		}
+	}
+	if len(d.imageMatches) > 0 {
+		matched := false
+		for _, re := range d.imageMatches {
+			if re.MatchString(state.Image) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Definition) run(ctx context.Context, state State) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(d.Hook.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, d.Hook.Path, d.Hook.Args...)
+	if len(d.Hook.Env) > 0 {
+		cmd.Env = append(os.Environ(), d.Hook.Env...)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	// WaitDelay bounds how long Wait can be stuck on I/O after the hook's
+	// own process exits or is killed: a hook that backgrounds or forks a
+	// child inheriting stdout/stderr would otherwise keep CombinedOutput
+	// blocked until that child exits on its own, well past runCtx's
+	// deadline.
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if runCtx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s: %s", timeout, strings.TrimSpace(string(output)))
+		}
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func expandHome(dir string) string {
+	if !strings.HasPrefix(dir, "$HOME") {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir
+	}
+	return home + strings.TrimPrefix(dir, "$HOME")
+}
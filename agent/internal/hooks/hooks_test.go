@@ -0,0 +1,174 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDefinitionMatchesLabelsAndImages(t *testing.T) {
+	def := Definition{
+		Stages: []string{StagePreStart},
+		When: When{
+			Labels: map[string]string{"env": "prod"},
+			Images: []string{`^registry\.example\.com/.*`},
+		},
+		// imageMatches is normally compiled by Manager.load from When.Images;
+		// populate it directly since this test builds the Definition by hand.
+		imageMatches: []*regexp.Regexp{regexp.MustCompile(`^registry\.example\.com/.*`)},
+	}
+
+	cases := []struct {
+		name  string
+		stage string
+		state State
+		want  bool
+	}{
+		{
+			name:  "label and image match",
+			stage: StagePreStart,
+			state: State{Labels: map[string]string{"env": "prod"}, Image: "registry.example.com/app:1"},
+			want:  true,
+		},
+		{
+			name:  "wrong stage",
+			stage: StagePostStart,
+			state: State{Labels: map[string]string{"env": "prod"}, Image: "registry.example.com/app:1"},
+			want:  false,
+		},
+		{
+			name:  "label mismatch",
+			stage: StagePreStart,
+			state: State{Labels: map[string]string{"env": "staging"}, Image: "registry.example.com/app:1"},
+			want:  false,
+		},
+		{
+			name:  "label missing entirely",
+			stage: StagePreStart,
+			state: State{Image: "registry.example.com/app:1"},
+			want:  false,
+		},
+		{
+			name:  "image doesn't match any pattern",
+			stage: StagePreStart,
+			state: State{Labels: map[string]string{"env": "prod"}, Image: "other.example.com/app:1"},
+			want:  false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := def.matches(tc.stage, tc.state); got != tc.want {
+				t.Errorf("matches() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefinitionMatchesAlwaysBypassesLabelsAndImages(t *testing.T) {
+	def := Definition{
+		Stages: []string{StagePreStart},
+		When: When{
+			Always: true,
+			Labels: map[string]string{"env": "prod"},
+			Images: []string{`^registry\.example\.com/.*`},
+		},
+	}
+	state := State{Labels: map[string]string{"env": "staging"}, Image: "unrelated:latest"}
+	if !def.matches(StagePreStart, state) {
+		t.Error("matches() = false, want true: always should bypass Labels/Images")
+	}
+}
+
+// writeHookScript writes an executable shell script to dir/name and returns
+// its path, for use as a Spec.Path in tests.
+func writeHookScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatalf("write hook script: %v", err)
+	}
+	return path
+}
+
+// writeHookDef marshals def to dir/name as a hook definition file, the way
+// Manager.load expects to find it under a hooks.d directory.
+func writeHookDef(t *testing.T, dir, name string, def Definition) {
+	t.Helper()
+	data, err := json.Marshal(def)
+	if err != nil {
+		t.Fatalf("marshal hook definition %s: %v", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		t.Fatalf("write hook definition %s: %v", name, err)
+	}
+}
+
+func TestDefinitionRunTimeoutEnforcement(t *testing.T) {
+	dir := t.TempDir()
+	path := writeHookScript(t, dir, "slow.sh", "sleep 20 &\nwait\n")
+	def := Definition{Hook: Spec{Path: path, Timeout: 1}}
+
+	start := time.Now()
+	err := def.run(context.Background(), State{})
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("run() = nil error, want timeout error")
+	}
+	if elapsed >= 10*time.Second {
+		t.Errorf("run() took %s, want well under the script's 20s sleep (timeout should have killed it)", elapsed)
+	}
+}
+
+// TestManagerRunFatalStopsOnFirstFailure exercises the fatal=true path
+// deployContainerWithRollback relies on at preStart: the first failing hook
+// aborts the run (so the caller can roll back) instead of letting later
+// hooks fire.
+func TestManagerRunFatalStopsOnFirstFailure(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "c-ran")
+	ok := writeHookScript(t, dir, "a-ok.sh", "exit 0\n")
+	fail := writeHookScript(t, dir, "b-fail.sh", "exit 1\n")
+	never := writeHookScript(t, dir, "c-never.sh", "touch "+marker+"\n")
+
+	writeHookDef(t, dir, "a.json", Definition{Hook: Spec{Path: ok}, Stages: []string{StagePreStart}, When: When{Always: true}})
+	writeHookDef(t, dir, "b.json", Definition{Hook: Spec{Path: fail}, Stages: []string{StagePreStart}, When: When{Always: true}})
+	writeHookDef(t, dir, "c.json", Definition{Hook: Spec{Path: never}, Stages: []string{StagePreStart}, When: When{Always: true}})
+
+	m := NewManager([]string{dir})
+	err := m.Run(context.Background(), StagePreStart, State{}, true)
+	if err == nil {
+		t.Fatal("Run(fatal=true) = nil error, want error from the failing hook")
+	}
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Error("Run(fatal=true) ran a hook after the first failure, want it to stop there")
+	}
+}
+
+// TestManagerRunNonFatalRunsAllAndCombinesFailures exercises the fatal=false
+// path postStart/postRollback use: every matching hook runs regardless of
+// an earlier failure, and the failures are combined into one error.
+func TestManagerRunNonFatalRunsAllAndCombinesFailures(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "c-ran")
+	ok := writeHookScript(t, dir, "a-ok.sh", "exit 0\n")
+	fail := writeHookScript(t, dir, "b-fail.sh", "exit 1\n")
+	alsoRuns := writeHookScript(t, dir, "c-also-runs.sh", "touch "+marker+"\n")
+
+	writeHookDef(t, dir, "a.json", Definition{Hook: Spec{Path: ok}, Stages: []string{StagePostStart}, When: When{Always: true}})
+	writeHookDef(t, dir, "b.json", Definition{Hook: Spec{Path: fail}, Stages: []string{StagePostStart}, When: When{Always: true}})
+	writeHookDef(t, dir, "c.json", Definition{Hook: Spec{Path: alsoRuns}, Stages: []string{StagePostStart}, When: When{Always: true}})
+
+	m := NewManager([]string{dir})
+	err := m.Run(context.Background(), StagePostStart, State{}, false)
+	if err == nil {
+		t.Fatal("Run(fatal=false) = nil error, want the combined failure from b-fail")
+	}
+	if _, statErr := os.Stat(marker); statErr != nil {
+		t.Error("Run(fatal=false) should run every matching hook despite an earlier failure")
+	}
+}
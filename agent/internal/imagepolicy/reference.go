@@ -0,0 +1,111 @@
+// Package imagepolicy resolves image references to their canonical form
+// and verifies Sigstore-style signature blobs against a set of trusted
+// public keys, ahead of dockerutil.Manager.VerifyImage gating a deploy.
+package imagepolicy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrMalformedReference is returned when a reference doesn't parse under
+// the same domain/path/tag/digest rules as Docker's distribution/reference
+// library.
+var ErrMalformedReference = errors.New("malformed image reference")
+
+const (
+	defaultDomain      = "docker.io"
+	officialRepoPrefix = "library"
+)
+
+var (
+	namePattern   = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+)
+
+// Reference is a normalized image reference: domain/path, optionally with
+// a tag and/or digest, following Docker's "familiar name" normalization -
+// a bare name like "nginx" expands to domain "docker.io", path
+// "library/nginx".
+type Reference struct {
+	Domain string
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// Name returns the domain/path portion without tag or digest - the
+// repository identity a signature's docker-reference field is checked
+// against.
+func (r Reference) Name() string { return r.Domain + "/" + r.Path }
+
+// String renders the full canonical reference.
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// ParseReference splits ref into a Reference, normalizing a familiar
+// (Docker Hub shorthand) name and rejecting anything that isn't a
+// well-formed domain/path[:tag][@digest].
+func ParseReference(ref string) (Reference, error) {
+	if ref == "" {
+		return Reference{}, ErrMalformedReference
+	}
+	remainder := ref
+	digest := ""
+	if at := strings.LastIndex(remainder, "@"); at >= 0 {
+		digest = remainder[at+1:]
+		remainder = remainder[:at]
+		if !digestPattern.MatchString(digest) {
+			return Reference{}, fmt.Errorf("%w: invalid digest %q", ErrMalformedReference, digest)
+		}
+	}
+	tag := ""
+	if colon := strings.LastIndex(remainder, ":"); colon > strings.LastIndex(remainder, "/") {
+		tag = remainder[colon+1:]
+		remainder = remainder[:colon]
+		if !tagPattern.MatchString(tag) {
+			return Reference{}, fmt.Errorf("%w: invalid tag %q", ErrMalformedReference, tag)
+		}
+	}
+	if remainder == "" {
+		return Reference{}, ErrMalformedReference
+	}
+	domain, path := splitDomain(remainder)
+	if !namePattern.MatchString(path) {
+		return Reference{}, fmt.Errorf("%w: invalid repository name %q", ErrMalformedReference, path)
+	}
+	return Reference{Domain: domain, Path: path, Tag: tag, Digest: digest}, nil
+}
+
+// splitDomain separates the registry domain from the repository path,
+// defaulting to Docker Hub and the "library/" official-image prefix the
+// same way "nginx" expands to "docker.io/library/nginx".
+func splitDomain(name string) (domain, path string) {
+	i := strings.Index(name, "/")
+	if i == -1 {
+		return defaultDomain, officialRepoPrefix + "/" + name
+	}
+	candidate := name[:i]
+	if !looksLikeDomain(candidate) {
+		return defaultDomain, name
+	}
+	return candidate, name[i+1:]
+}
+
+// looksLikeDomain reports whether the first path segment of a reference is
+// a registry domain (contains a "." or ":", or is exactly "localhost")
+// rather than the first component of a repository path.
+func looksLikeDomain(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
@@ -0,0 +1,167 @@
+package imagepolicy
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNoVerifyingKey is returned when a signature doesn't validate against
+// any of the configured trusted keys.
+var ErrNoVerifyingKey = errors.New("signature does not verify against any trusted key")
+
+// TrustedKey is a public key loaded from an operator-managed PEM file,
+// identified by a short fingerprint so an "image.verification" audit event
+// can record which key actually matched without dumping the whole PEM.
+type TrustedKey struct {
+	ID      string
+	ECDSA   *ecdsa.PublicKey
+	Ed25519 ed25519.PublicKey
+}
+
+// LoadTrustedKeys reads every PEM-encoded public key across paths,
+// accepting both Ed25519 and ECDSA-P256 keys (cosign's two common signing
+// key types), the same key set dockerutil's registry-fetched trust.go
+// verifier checks against.
+func LoadTrustedKeys(paths []string) ([]TrustedKey, error) {
+	var keys []TrustedKey
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read signer key %s: %w", path, err)
+		}
+		parsed, err := parsePEMKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse signer key %s: %w", path, err)
+		}
+		keys = append(keys, parsed...)
+	}
+	return keys, nil
+}
+
+// ParseTrustedKeys parses PEM-encoded public keys supplied inline - e.g. a
+// deploy job's per-service "image_signers" hint, which arrives over the
+// wire from the controller rather than as a path on the agent's own
+// filesystem - using the same Ed25519/ECDSA-P256 support as LoadTrustedKeys.
+func ParseTrustedKeys(pemBlocks []string) ([]TrustedKey, error) {
+	var keys []TrustedKey
+	for _, block := range pemBlocks {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		parsed, err := parsePEMKeys([]byte(block))
+		if err != nil {
+			return nil, fmt.Errorf("parse inline signer key: %w", err)
+		}
+		keys = append(keys, parsed...)
+	}
+	return keys, nil
+}
+
+func parsePEMKeys(data []byte) ([]TrustedKey, error) {
+	var keys []TrustedKey
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		id := fingerprint(block.Bytes)
+		switch key := pub.(type) {
+		case *ecdsa.PublicKey:
+			keys = append(keys, TrustedKey{ID: id, ECDSA: key})
+		case ed25519.PublicKey:
+			keys = append(keys, TrustedKey{ID: id, Ed25519: key})
+		default:
+			return nil, fmt.Errorf("unsupported key type %T", pub)
+		}
+	}
+	return keys, nil
+}
+
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// sigEnvelope is cosign's simple-signing bundle shape: a base64 JSON
+// payload plus a base64 signature over that payload's raw bytes.
+type sigEnvelope struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// simpleSigningPayload is the signed document cosign produces for
+// container images - the "critical" fields are the ones a verifier must
+// check to avoid accepting a signature for a different image or repo.
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+	} `json:"critical"`
+}
+
+// VerifySignature checks sigBlob (a JSON-encoded sigEnvelope) against
+// digest and repoName, trying each of keys in turn, and reports the ID of
+// whichever key verified it. repoName must match the signed payload's
+// docker-reference exactly, so a signature minted for one repository can't
+// be replayed against another that happens to share a digest.
+func VerifySignature(sigBlob []byte, digest, repoName string, keys []TrustedKey) (string, bool) {
+	var envelope sigEnvelope
+	if err := json.Unmarshal(sigBlob, &envelope); err != nil {
+		return "", false
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return "", false
+	}
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return "", false
+	}
+	var signed simpleSigningPayload
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return "", false
+	}
+	if signed.Critical.Image.DockerManifestDigest != digest {
+		return "", false
+	}
+	if signed.Critical.Identity.DockerReference != repoName {
+		return "", false
+	}
+	sum := sha256.Sum256(payload)
+	for _, key := range keys {
+		switch {
+		case key.ECDSA != nil:
+			if ecdsa.VerifyASN1(key.ECDSA, sum[:], sig) {
+				return key.ID, true
+			}
+		case key.Ed25519 != nil:
+			if ed25519.Verify(key.Ed25519, payload, sig) {
+				return key.ID, true
+			}
+		}
+	}
+	return "", false
+}
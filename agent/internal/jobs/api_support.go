@@ -0,0 +1,31 @@
+package jobs
+
+import "context"
+
+// EnforceImagePolicy applies the same registry-allowlist/require-digest/
+// require-signature checks handleDeploy applies to every deploy, exported
+// so internal/api's Docker/Podman-compatible HTTP surface can gate an
+// images/create pull or a container start the same way a controller-driven
+// deploy job is gated.
+func (h *Handler) EnforceImagePolicy(ctx context.Context, image string) error {
+	return h.enforceImagePolicy(ctx, image)
+}
+
+// ValidateVolumeSource applies the same AllowedVolumeRoots check deploy jobs
+// apply, exported for internal/api's compatible HTTP surface.
+func (h *Handler) ValidateVolumeSource(source string) error {
+	return h.validateVolumeSource(source)
+}
+
+// VerifyImageDigest applies the same RequireImageDigest verification deploy
+// jobs apply, exported for internal/api's compatible HTTP surface.
+func (h *Handler) VerifyImageDigest(ctx context.Context, image, expected string) error {
+	return h.verifyImageDigest(ctx, image, expected)
+}
+
+// Audit appends an audit record through the handler's configured Audit
+// logger, exported so internal/api's HTTP surface lands in the same audit
+// trail as controller-driven jobs rather than a separate, untracked path.
+func (h *Handler) Audit(event string, fields map[string]interface{}) {
+	h.audit(event, fields)
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	dockerfileast "deploybot-agent/internal/dockerfile"
+	"deploybot-agent/internal/dockerutil"
+	"deploybot-agent/internal/git"
+)
+
+// handleBuild clones a repository, builds an image from it and optionally
+// pushes the result to a registry, without deploying anything. This lets a
+// CI-style flow build once and hand the resulting digest to JobDeploy's
+// image strategy for rollout across many agents.
+func (h *Handler) handleBuild(ctx context.Context, jobID string, payload BuildJobPayload) (interface{}, error) {
+	if payload.RepositoryURL == "" {
+		return nil, errors.New("build job missing repository_url")
+	}
+	if payload.Ref == "" {
+		payload.Ref = "main"
+	}
+	workspace := git.WorkspacePath(h.Cfg.WorkDir, payload.RepositoryURL, payload.Ref)
+	if err := os.MkdirAll(filepath.Dir(workspace), 0o755); err != nil {
+		return nil, err
+	}
+	cleanupWorkspace := h.Cfg.CleanupWorkspaces && h.securityEnabled()
+	if cleanupWorkspace {
+		defer h.cleanupWorkspace(workspace)
+	}
+	cloneCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	if err := git.ShallowClone(cloneCtx, payload.RepositoryURL, payload.Ref, workspace); err != nil {
+		return nil, fmt.Errorf("clone failed: %w", err)
+	}
+
+	dockerfile := payload.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	contextDir := workspace
+	if payload.Context != "" {
+		contextDir = filepath.Join(workspace, payload.Context)
+	}
+	tag := payload.Tag
+	if tag == "" {
+		tag = dockerutil.SanitizeTag("deploybot/" + sanitizeName(filepath.Base(workspace)))
+	}
+
+	buildOpts := dockerutil.BuildOptions{
+		Target:     payload.Target,
+		BuildArgs:  stringPtrMap(payload.BuildArgs),
+		CacheFrom:  payload.CacheFrom,
+		Platform:   payload.Platform,
+		Builder:    payload.Builder,
+		CacheTo:    payload.CacheTo,
+		Platforms:  payload.Platforms,
+		Secrets:    buildSecretRefs(payload.Secrets),
+		SBOM:       payload.SBOM,
+		Provenance: payload.Provenance,
+	}
+	h.analyzeDockerfile(jobID, contextDir, dockerfile)
+	digest, err := h.buildImageDecoded(ctx, jobID, contextDir, dockerfile, tag, buildOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	image := tag
+	if payload.PushTo != "" {
+		if err := h.enforceImagePolicy(ctx, payload.PushTo); err != nil {
+			return nil, err
+		}
+		if err := h.Docker.TagImage(ctx, tag, payload.PushTo); err != nil {
+			return nil, fmt.Errorf("tagging %s as %s: %w", tag, payload.PushTo, err)
+		}
+		pushDigest, err := h.pushImageDecoded(ctx, jobID, payload.PushTo)
+		if err != nil {
+			return nil, err
+		}
+		image, digest = payload.PushTo, pushDigest
+	}
+	return map[string]string{"image": image, "digest": digest}, nil
+}
+
+// buildImageDecoded builds contextDir/dockerfile, streaming the daemon's
+// progress to the job's LogPublisher as decoded human-readable lines rather
+// than raw JSON frames.
+func (h *Handler) buildImageDecoded(ctx context.Context, jobID, contextDir, dockerfile, tag string, opts dockerutil.BuildOptions) (string, error) {
+	if h.LogPublisher == nil {
+		return h.buildWithFallback(ctx, contextDir, dockerfile, tag, opts, nil)
+	}
+
+	pr, pw := io.Pipe()
+	publishErr := make(chan error, 1)
+	go func() {
+		publishErr <- h.LogPublisher.Publish(ctx, jobID, pr, LogStreamLines)
+	}()
+
+	// The classic builder's progress is raw JSON frames that need
+	// decoding into human-readable lines; BuildKit's own log stream is
+	// already plain lines, so it writes straight to pw instead. If
+	// BuildKit turns out unavailable mid-build, buildWithFallback's retry
+	// against the classic builder then writes undecoded JSON frames
+	// through that same raw pw for the remainder of the build - noisier
+	// output on a rare fallback path, not a functional failure.
+	var progress io.Writer = pw
+	var decoder *dockerutil.BuildProgressDecoder
+	if opts.Builder != "buildkit" || h.Cfg.BuildKitAddr == "" {
+		decoder = dockerutil.NewBuildProgressDecoder(pw)
+		progress = decoder
+	}
+	digest, buildErr := h.buildWithFallback(ctx, contextDir, dockerfile, tag, opts, progress)
+	if decoder != nil {
+		_ = decoder.Close()
+	}
+	_ = pw.Close()
+	if err := <-publishErr; err != nil && buildErr == nil {
+		h.audit("build.log_publish_failed", map[string]interface{}{"job_id": jobID, "error": err.Error()})
+	}
+	return digest, buildErr
+}
+
+// buildWithFallback runs opts's configured Builder, centralizing the
+// buildkit-unavailable-falls-back-to-classic logic shared by
+// buildImageDecoded (standalone build jobs) and buildImage
+// (strategyDockerfile deploys). progress receives raw bytes either way:
+// BuildKit's own log lines for the buildkit builder, or the classic
+// builder's JSON progress frames for the (default, or fallback) path.
+func (h *Handler) buildWithFallback(ctx context.Context, contextDir, dockerfile, tag string, opts dockerutil.BuildOptions, progress io.Writer) (string, error) {
+	if opts.Builder == "buildkit" {
+		if h.Cfg.BuildKitAddr == "" {
+			h.audit("build.buildkit_unconfigured", map[string]interface{}{"tag": tag})
+		} else {
+			digest, err := h.Docker.BuildImageWithBuildKit(ctx, h.Cfg.BuildKitAddr, contextDir, dockerfile, tag, opts, progress)
+			if err == nil {
+				return digest, nil
+			}
+			var unavailable *dockerutil.BuildKitUnavailableError
+			if !errors.As(err, &unavailable) {
+				return "", err
+			}
+			h.audit("build.buildkit_unavailable", map[string]interface{}{"tag": tag, "error": err.Error()})
+		}
+	}
+	tar, err := dockerutil.CreateBuildContext(contextDir, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	defer tar.Close()
+	return h.Docker.BuildImage(ctx, tar, dockerfile, tag, opts, progress)
+}
+
+// analyzeDockerfile parses contextDir/dockerfile into a typed instruction
+// AST and audits any dead-stage or unused-ARG findings ahead of handing the
+// build off to the daemon. This is analysis only, not a second builder:
+// BuildKit already builds the independent stages of a single ImageBuild
+// call concurrently, so there's nothing for the agent itself to
+// parallelize - the AST's value here is the warnings it can surface before
+// spending build time on them.
+func (h *Handler) analyzeDockerfile(jobID, contextDir, dockerfile string) {
+	data, err := os.ReadFile(filepath.Join(contextDir, dockerfile))
+	if err != nil {
+		return
+	}
+	ast, err := dockerfileast.Parse(data)
+	if err != nil {
+		h.audit("build.dockerfile_parse_failed", map[string]interface{}{"job_id": jobID, "error": err.Error()})
+		return
+	}
+	if dead := ast.DeadStages(); len(dead) > 0 {
+		h.audit("build.dead_stages", map[string]interface{}{"job_id": jobID, "stages": dead})
+	}
+	if unused := ast.UnusedGlobalArgs(); len(unused) > 0 {
+		h.audit("build.unused_args", map[string]interface{}{"job_id": jobID, "args": unused})
+	}
+}
+
+// pushImageDecoded pushes tag, streaming decoded human-readable progress to
+// the job's LogPublisher the same way buildImageDecoded does for builds.
+func (h *Handler) pushImageDecoded(ctx context.Context, jobID, tag string) (string, error) {
+	if h.LogPublisher == nil {
+		return h.Docker.PushImage(ctx, tag, nil)
+	}
+
+	pr, pw := io.Pipe()
+	publishErr := make(chan error, 1)
+	go func() {
+		publishErr <- h.LogPublisher.Publish(ctx, jobID, pr, LogStreamLines)
+	}()
+
+	decoder := dockerutil.NewBuildProgressDecoder(pw)
+	digest, pushErr := h.Docker.PushImage(ctx, tag, decoder)
+	_ = decoder.Close()
+	_ = pw.Close()
+	if err := <-publishErr; err != nil && pushErr == nil {
+		h.audit("build.log_publish_failed", map[string]interface{}{"job_id": jobID, "error": err.Error()})
+	}
+	return digest, pushErr
+}
@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"deploybot-agent/internal/dockerutil"
+)
+
+// deployBundle is a multi-service descriptor analogous to a Docker
+// Application Bundle / bundlefile: several related services declared in
+// one deploy.json, connected by a shared user-defined bridge network and
+// started in depends_on order, so a full app (api+worker+db) can ship as
+// one descriptor instead of one deploy.json per container.
+type deployBundle struct {
+	Network  string                    `json:"network"`
+	Services map[string]*bundleService `json:"services"`
+}
+
+// bundleService is one service within a deployBundle; its map key in
+// deployBundle.Services is the service name.
+type bundleService struct {
+	Image       string            `json:"image"`
+	ImageDigest string            `json:"image_digest"`
+	Environment map[string]string `json:"environment"`
+	Volumes     []VolumeMapping   `json:"volumes"`
+	Ports       []PortMapping     `json:"ports"`
+	Restart     string            `json:"restart_policy"`
+	Health      *DeployHealth     `json:"health"`
+	Labels      map[string]string `json:"labels"`
+	DependsOn   []string          `json:"depends_on"`
+}
+
+// looksLikeBundle reports whether data is a multi-service bundle rather
+// than a plain single-service deploy.json.
+func looksLikeBundle(data []byte) bool {
+	var probe struct {
+		Services json.RawMessage `json:"services"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return len(probe.Services) > 0
+}
+
+func loadDeployBundle(data []byte) (*deployBundle, error) {
+	bundle := &deployBundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, err
+	}
+	if len(bundle.Services) == 0 {
+		return nil, fmt.Errorf("bundle descriptor has no services")
+	}
+	return bundle, nil
+}
+
+// serviceOrder topologically sorts the bundle's services by depends_on, so
+// a database comes up before the api service that depends on it. Service
+// names are visited in sorted order so the result is deterministic.
+func (b *deployBundle) serviceOrder() ([]string, error) {
+	const (
+		unvisited = 0
+		visiting  = 1
+		done      = 2
+	)
+	state := map[string]int{}
+	var order []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("circular depends_on involving service %q", name)
+		}
+		svc, ok := b.Services[name]
+		if !ok {
+			return fmt.Errorf("depends_on references unknown service %q", name)
+		}
+		state[name] = visiting
+		for _, dep := range svc.DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	names := make([]string, 0, len(b.Services))
+	for name := range b.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// deployBundle resolves bundle's depends_on ordering, allocates a shared
+// user-defined bridge network, and deploys each service through the same
+// deployContainerWithRollback path a standalone deploy.json uses.
+func (h *Handler) deployBundle(ctx context.Context, payload DeployJobPayload, bundle *deployBundle) (interface{}, error) {
+	order, err := bundle.serviceOrder()
+	if err != nil {
+		return nil, err
+	}
+	network := bundle.Network
+	if network == "" {
+		network = sanitizeName(payload.Name) + "-net"
+	}
+	if err := h.Docker.EnsureNetwork(ctx, network); err != nil {
+		return nil, fmt.Errorf("bundle network %s: %w", network, err)
+	}
+
+	results := map[string]string{}
+	for _, name := range order {
+		svc := bundle.Services[name]
+		if svc.Image == "" {
+			return nil, fmt.Errorf("bundle service %s missing image", name)
+		}
+		if err := h.enforceImagePolicy(ctx, svc.Image); err != nil {
+			return nil, err
+		}
+		ports, err := h.preparePorts(svc.Ports)
+		if err != nil {
+			return nil, err
+		}
+		volumes := make([]dockerutil.VolumeBinding, 0, len(svc.Volumes))
+		for _, vol := range svc.Volumes {
+			sourceClean := filepath.Clean(vol.Source)
+			if err := h.validateVolumeSource(sourceClean); err != nil {
+				return nil, err
+			}
+			volumes = append(volumes, dockerutil.VolumeBinding{Source: sourceClean, Target: vol.Target})
+		}
+		labels := dockerutil.WithAgentLabels(svc.Labels)
+		labels["deploybot.job"] = payload.Name
+		labels["deploybot.bundle_service"] = name
+		labels["deploybot.image"] = svc.Image
+		containerName := fmt.Sprintf("%s-%s", sanitizeName(payload.Name), name)
+		env := mergeEnv(payload.Environment, svc.Environment)
+		health := svc.Health.toDocker()
+		restart := svc.Restart
+		if restart == "" {
+			restart = payload.RestartPolicy
+		}
+		recordKey := fmt.Sprintf("%s/%s", payload.Name, name)
+		req := deployRequest{ContainerName: containerName, Image: svc.Image, Environment: env, Ports: ports, Volumes: volumes, Labels: labels, Health: health, Restart: restart, Network: network, Signatures: payload.ImageSignatures}
+		res, err := h.deployContainerWithRollback(ctx, recordKey, req, svc.ImageDigest, rolloutFromPayload(payload))
+		if err != nil {
+			return nil, fmt.Errorf("bundle service %s: %w", name, err)
+		}
+		if m, ok := res.(map[string]string); ok {
+			results[name] = m["container_id"]
+		} else {
+			results[name] = fmt.Sprintf("%v", res)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	copyDirectionToContainer   = "to_container"
+	copyDirectionFromContainer = "from_container"
+
+	defaultMaxCopyBytes = 100 * 1024 * 1024
+)
+
+// handleCopy routes a cp-style job between the host and a container,
+// covering "push a config file" / "grab a crash dump" workflows that would
+// otherwise need a JobExec shell trick.
+func (h *Handler) handleCopy(ctx context.Context, payload CopyJobPayload) (interface{}, error) {
+	if !h.Cfg.AllowUnsafeCommands && h.securityEnabled() {
+		return nil, errors.New("copy jobs disabled by configuration")
+	}
+	if payload.Container == "" || payload.Source == "" || payload.Destination == "" {
+		return nil, errors.New("copy job missing container, source, or destination")
+	}
+	switch payload.Direction {
+	case copyDirectionToContainer:
+		return h.copyToContainer(ctx, payload)
+	case copyDirectionFromContainer:
+		return h.copyFromContainer(ctx, payload)
+	default:
+		return nil, fmt.Errorf("copy job direction must be %q or %q", copyDirectionToContainer, copyDirectionFromContainer)
+	}
+}
+
+func (h *Handler) maxCopyBytes() int64 {
+	if h.Cfg.MaxCopyBytes > 0 {
+		return h.Cfg.MaxCopyBytes
+	}
+	return defaultMaxCopyBytes
+}
+
+func (h *Handler) copyToContainer(ctx context.Context, payload CopyJobPayload) (interface{}, error) {
+	sourceClean := filepath.Clean(payload.Source)
+	if err := h.validateVolumeSource(sourceClean); err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(sourceClean)
+	if err != nil {
+		return nil, fmt.Errorf("copy source: %w", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("copy source %s is a symlink", sourceClean)
+	}
+
+	var buf bytes.Buffer
+	counted := &byteCountWriter{w: &buf, max: h.maxCopyBytes()}
+	tw := tar.NewWriter(counted)
+	var files int
+	destDir := payload.Destination
+	if info.IsDir() {
+		files, err = addTarDir(tw, sourceClean)
+	} else {
+		destDir = filepath.Dir(payload.Destination)
+		files, err = addTarFile(tw, sourceClean, filepath.Base(payload.Destination), info)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Docker.CopyToContainer(ctx, payload.Container, destDir, &buf); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"bytes_transferred": counted.written, "files": files}, nil
+}
+
+func (h *Handler) copyFromContainer(ctx context.Context, payload CopyJobPayload) (interface{}, error) {
+	destClean := filepath.Clean(payload.Destination)
+	if err := h.validateVolumeSource(destClean); err != nil {
+		return nil, err
+	}
+	reader, err := h.Docker.CopyFromContainer(ctx, payload.Container, payload.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if err := os.MkdirAll(destClean, 0o755); err != nil {
+		return nil, err
+	}
+	return extractTar(reader, destClean, h.maxCopyBytes())
+}
+
+// byteCountWriter enforces MaxCopyBytes while an archive is being built, so
+// an oversized source is rejected before anything is sent to the daemon.
+type byteCountWriter struct {
+	w       io.Writer
+	max     int64
+	written int64
+}
+
+func (b *byteCountWriter) Write(p []byte) (int, error) {
+	if b.written+int64(len(p)) > b.max {
+		return 0, fmt.Errorf("copy exceeds max-copy-bytes limit of %d", b.max)
+	}
+	n, err := b.w.Write(p)
+	b.written += int64(n)
+	return n, err
+}
+
+func addTarFile(tw *tar.Writer, hostPath, nameInArchive string, info os.FileInfo) (int, error) {
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return 0, err
+	}
+	hdr.Name = nameInArchive
+	if err := tw.WriteHeader(hdr); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(tw, f); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// addTarDir archives root's contents, refusing to follow symlinks so a copy
+// job can't be used to exfiltrate files outside the validated source root.
+func addTarDir(tw *tar.Writer, root string) (int, error) {
+	files := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to copy symlink %s", path)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name + "/"
+			return tw.WriteHeader(hdr)
+		}
+		n, err := addTarFile(tw, path, name, info)
+		files += n
+		return err
+	})
+	return files, err
+}
+
+// extractTar unpacks a container's tar stream under destRoot, rejecting any
+// entry whose cleaned path would escape destRoot (the classic tar-slip
+// vulnerability) and any symlink/hardlink entry outright, since a
+// compromised container could otherwise use either to write outside the
+// destination the operator approved.
+func extractTar(r io.Reader, destRoot string, maxBytes int64) (map[string]interface{}, error) {
+	tr := tar.NewReader(r)
+	var files int
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(destRoot, filepath.Clean(string(os.PathSeparator)+hdr.Name))
+		if target != destRoot && !strings.HasPrefix(target, destRoot+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("tar entry %q escapes destination", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			return nil, fmt.Errorf("tar entry %q is a symlink, refusing to extract", hdr.Name)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return nil, err
+			}
+			total += hdr.Size
+			if total > maxBytes {
+				return nil, fmt.Errorf("copy exceeds max-copy-bytes limit of %d", maxBytes)
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			_, copyErr := io.CopyN(out, tr, hdr.Size)
+			closeErr := out.Close()
+			if copyErr != nil {
+				return nil, copyErr
+			}
+			if closeErr != nil {
+				return nil, closeErr
+			}
+			files++
+		default:
+			// Skip fifos, device nodes, etc. - nothing a container archive
+			// should legitimately contain for this workflow.
+		}
+	}
+	return map[string]interface{}{"bytes_transferred": total, "files": files}, nil
+}
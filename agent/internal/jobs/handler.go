@@ -3,6 +3,8 @@ package jobs
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,12 +15,15 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"deploybot-agent/internal/audit"
 	"deploybot-agent/internal/config"
 	"deploybot-agent/internal/dockerutil"
 	"deploybot-agent/internal/git"
+	"deploybot-agent/internal/hooks"
+	"deploybot-agent/internal/imagepolicy"
 	"deploybot-agent/internal/state"
 
 	"github.com/compose-spec/compose-go/loader"
@@ -26,9 +31,23 @@ import (
 	"github.com/docker/docker/api/types/container"
 )
 
+// LogStreamFormat tells a LogPublisher how to interpret the reader passed to
+// Publish.
+type LogStreamFormat int
+
+const (
+	// LogStreamDockerMultiplex is Docker's multiplexed ContainerLogs/attach
+	// stream, where each frame starts with an 8-byte header encoding the
+	// stream (stdout/stderr) and payload length.
+	LogStreamDockerMultiplex LogStreamFormat = iota
+	// LogStreamLines is plain newline-delimited text with no framing,
+	// shipped as a single "status" stream.
+	LogStreamLines
+)
+
 // LogPublisher streams logs back to the controller.
 type LogPublisher interface {
-	Publish(ctx context.Context, jobID string, reader io.Reader) error
+	Publish(ctx context.Context, jobID string, reader io.Reader, format LogStreamFormat) error
 }
 
 // Handler executes controller jobs.
@@ -38,6 +57,108 @@ type Handler struct {
 	Docker       *dockerutil.Manager
 	LogPublisher LogPublisher
 	Audit        *audit.Logger
+	Hooks        *hooks.Manager
+
+	trustPolicyOnce sync.Once
+	trustPolicy     dockerutil.ImageTrustPolicy
+	trustPolicyErr  error
+
+	signerKeysOnce sync.Once
+	signerKeys     []imagepolicy.TrustedKey
+	signerKeysErr  error
+
+	// sigVerifyCache caches verifySignatureForDigest's outcome per
+	// "image@digest" for the lifetime of the handler, so a digest-pinned
+	// image redeployed repeatedly (e.g. a blue/green or canary rollout
+	// re-checking the same image on every step) doesn't re-fetch and
+	// re-verify its cosign signature artifact from the registry each time.
+	sigVerifyCache sync.Map
+}
+
+// imageTrustPolicy lazily loads the image content-trust policy from the
+// configured digest allow-list, caching it for the lifetime of the handler.
+// Its SignerKeys come from trustedSignerKeys - the same TrustedSignerKeys
+// set verifyImageSignatures checks controller-supplied signatures against
+// when a deploy supplies no image_signers of its own - so EnsureImage's
+// registry-fetched cosign check and the deploy-job-level inline signature
+// check trust the same keys unless that per-deploy override is given.
+func (h *Handler) imageTrustPolicy() dockerutil.ImageTrustPolicy {
+	h.trustPolicyOnce.Do(func() {
+		h.trustPolicy, h.trustPolicyErr = dockerutil.LoadImageTrustPolicy(h.Cfg.ImageDigestAllowListFile)
+		if h.trustPolicyErr != nil {
+			h.audit("trust_policy.load_failed", map[string]interface{}{"error": h.trustPolicyErr.Error()})
+		}
+	})
+	h.trustPolicy.RequireDigest = h.Cfg.RequireImageDigest && h.securityEnabled()
+	h.trustPolicy.SignerKeys = nil
+	if h.signaturePolicyActive() {
+		if keys, err := h.trustedSignerKeys(); err == nil {
+			h.trustPolicy.SignerKeys = keys
+		}
+	}
+	return h.trustPolicy
+}
+
+// signaturePolicyActive reports whether SignaturePolicyMode requires any
+// signature checking at all ("warn" or "enforce"); "off" (or unset) means
+// neither the inline nor the registry-fetched signature check should run.
+func (h *Handler) signaturePolicyActive() bool {
+	return h.Cfg.SignaturePolicyMode != "" && h.Cfg.SignaturePolicyMode != "off"
+}
+
+// trustedSignerKeys lazily loads and caches the PEM-encoded signer keys
+// configured via TrustedSignerKeys, mirroring imageTrustPolicy's
+// load-once-per-handler-lifetime pattern.
+func (h *Handler) trustedSignerKeys() ([]imagepolicy.TrustedKey, error) {
+	h.signerKeysOnce.Do(func() {
+		h.signerKeys, h.signerKeysErr = imagepolicy.LoadTrustedKeys(h.Cfg.TrustedSignerKeys)
+		if h.signerKeysErr != nil {
+			h.audit("trust_policy.signer_keys_load_failed", map[string]interface{}{"error": h.signerKeysErr.Error()})
+		}
+	})
+	return h.signerKeys, h.signerKeysErr
+}
+
+// signersOrTrustedKeys parses signers (a deploy's inline image_signers
+// hint) if any were supplied, otherwise falls back to the agent-wide
+// trustedSignerKeys.
+func (h *Handler) signersOrTrustedKeys(signers []string) ([]imagepolicy.TrustedKey, error) {
+	if len(signers) == 0 {
+		return h.trustedSignerKeys()
+	}
+	return imagepolicy.ParseTrustedKeys(signers)
+}
+
+// verifyImageSignatures enforces SignaturePolicyMode against image's
+// ImageSignatures, gating the deploy before any container starts. "off"
+// skips verification entirely; "warn" audits the outcome but never blocks;
+// "enforce" refuses the deploy if fewer than RequiredSignatureCount
+// signatures verify against TrustedSignerKeys, or against signers if the
+// deploy (or one of its compose services/descriptor) supplied its own
+// image_signers hint overriding the agent-wide trusted keys.
+func (h *Handler) verifyImageSignatures(ctx context.Context, image, digest string, sigs, signers []string) error {
+	mode := h.Cfg.SignaturePolicyMode
+	if mode == "" || mode == "off" {
+		return nil
+	}
+	keys, err := h.signersOrTrustedKeys(signers)
+	if err != nil {
+		h.audit("image.verification", map[string]interface{}{"image": image, "digest": digest, "mode": mode, "outcome": "key_load_failed", "error": err.Error()})
+		if mode == "enforce" {
+			return fmt.Errorf("load trusted signer keys: %w", err)
+		}
+		return nil
+	}
+	result, verifyErr := h.Docker.VerifyImage(ctx, image, digest, sigs, keys, h.Cfg.RequiredSignatureCount)
+	outcome := "verified"
+	if verifyErr != nil {
+		outcome = "failed"
+	}
+	h.audit("image.verification", map[string]interface{}{"image": image, "digest": result.ResolvedDigest, "resolved_ref": result.ResolvedRef, "matched_key_ids": result.MatchedKeyIDs, "mode": mode, "outcome": outcome})
+	if verifyErr != nil && mode == "enforce" {
+		return fmt.Errorf("image signature verification: %w", verifyErr)
+	}
+	return nil
 }
 
 // Handle executes a job and returns optional detail for acknowledgements.
@@ -69,16 +190,38 @@ func (h *Handler) Handle(ctx context.Context, job *Job) (interface{}, error) {
 		}
 	case JobLogs:
 		result, err = h.handleLogs(ctx, job)
+	case JobStats:
+		result, err = h.handleStats(ctx, job)
+	case JobCopy:
+		var payload CopyJobPayload
+		if err = json.Unmarshal(job.Payload, &payload); err == nil {
+			result, err = h.handleCopy(ctx, payload)
+		}
+	case JobBuild:
+		var payload BuildJobPayload
+		if err = json.Unmarshal(job.Payload, &payload); err == nil {
+			result, err = h.handleBuild(ctx, job.ID, payload)
+		}
 	case JobExec:
 		var payload ExecJobPayload
 		if err = json.Unmarshal(job.Payload, &payload); err == nil {
-			result, err = h.handleExec(ctx, payload)
+			result, err = h.handleExec(ctx, job.ID, payload)
 		}
 	case JobQueryEnv:
 		var payload EnvQueryPayload
 		if err = json.Unmarshal(job.Payload, &payload); err == nil {
 			result, err = h.handleEnvQuery(payload)
 		}
+	case JobVerify:
+		var payload VerifyJobPayload
+		if err = json.Unmarshal(job.Payload, &payload); err == nil {
+			result, err = h.handleVerify(ctx, payload)
+		}
+	case JobRollback:
+		var payload RollbackJobPayload
+		if err = json.Unmarshal(job.Payload, &payload); err == nil {
+			result, err = h.handleRollback(ctx, payload)
+		}
 	default:
 		err = fmt.Errorf("unsupported job type: %s", job.Type)
 	}
@@ -141,6 +284,14 @@ func (h *Handler) handleDeploy(ctx context.Context, jobID string, payload Deploy
 			return nil, err
 		}
 	}
+	if payload.RequireSignedCommit {
+		if _, err := git.VerifySignature(workspace, git.SignatureOptions{
+			ArmoredKeyring: payload.TrustedSigners.ArmoredKeyring,
+			AllowedSigners: payload.TrustedSigners.AllowedSigners,
+		}); err != nil {
+			return nil, fmt.Errorf("commit signature verification failed: %w", err)
+		}
+	}
 	strategy, err := determineStrategy(workspace, payload)
 	if err != nil {
 		return nil, err
@@ -151,9 +302,11 @@ func (h *Handler) handleDeploy(ctx context.Context, jobID string, payload Deploy
 	case strategyDeployJSON:
 		return h.deployDescriptor(ctx, workspace, payload, strategy)
 	case strategyDockerfile:
-		return h.deployDockerfile(ctx, workspace, payload, strategy)
+		return h.deployDockerfile(ctx, jobID, workspace, payload, strategy)
 	case strategyImage:
 		return h.deployImage(ctx, workspace, payload, strategy)
+	case strategyKube:
+		return h.deployKube(ctx, workspace, payload, strategy)
 	default:
 		return nil, fmt.Errorf("strategy %v not supported", strategy.kind)
 	}
@@ -184,13 +337,13 @@ func (h *Handler) handleLogs(ctx context.Context, job *Job) (interface{}, error)
 		return nil, err
 	}
 	defer reader.Close()
-	if err := h.LogPublisher.Publish(ctxLogs, job.ID, reader); err != nil {
+	if err := h.LogPublisher.Publish(ctxLogs, job.ID, reader, LogStreamDockerMultiplex); err != nil {
 		return nil, err
 	}
 	return map[string]any{"followed_minutes": followDuration.Minutes()}, nil
 }
 
-func (h *Handler) handleExec(ctx context.Context, payload ExecJobPayload) (interface{}, error) {
+func (h *Handler) handleExec(ctx context.Context, jobID string, payload ExecJobPayload) (interface{}, error) {
 	if !h.Cfg.AllowUnsafeCommands && h.securityEnabled() {
 		return nil, errors.New("exec jobs disabled by configuration")
 	}
@@ -210,24 +363,70 @@ func (h *Handler) handleExec(ctx context.Context, payload ExecJobPayload) (inter
 	if len(payload.Environment) > 0 {
 		cmd.Env = append(os.Environ(), mapToEnvSlice(payload.Environment)...)
 	}
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout, cmd.Stderr = &stdout, &stderr
-	err := cmd.Run()
-	exitCode := 0
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
+
+	if h.LogPublisher == nil {
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		runErr := cmd.Run()
+		exitCode, err := exitCodeOf(runErr)
+		if err != nil {
 			return nil, err
 		}
+		result := map[string]interface{}{"exit_code": exitCode, "stdout": limitOutput(stdout.String()), "stderr": limitOutput(stderr.String())}
+		if runErr != nil {
+			return result, runErr
+		}
+		return result, nil
 	}
-	result := map[string]interface{}{"exit_code": exitCode, "stdout": limitOutput(stdout.String()), "stderr": limitOutput(stderr.String())}
+
+	// Stream stdout/stderr live rather than buffering the whole run, framed
+	// as LogStreamDockerMultiplex so the controller can interleave the two
+	// streams as they arrive instead of waiting on a capped, buffered
+	// result. A final status frame carries the exit code once the command
+	// has finished, the same way buildImage's status frame carries a
+	// build's digest.
+	pr, pw := io.Pipe()
+	mux := newMultiplexWriter(pw)
+	cmd.Stdout, cmd.Stderr = mux.Stdout(), mux.Stderr()
+	publishErr := make(chan error, 1)
+	go func() {
+		publishErr <- h.LogPublisher.Publish(ctx, jobID, pr, LogStreamDockerMultiplex)
+	}()
+
+	runErr := cmd.Run()
+	exitCode, err := exitCodeOf(runErr)
 	if err != nil {
-		return result, err
+		_ = pw.CloseWithError(err)
+		<-publishErr
+		return nil, err
+	}
+	statusJSON, _ := json.Marshal(map[string]int{"exit_code": exitCode})
+	_ = mux.WriteStatus(statusJSON)
+	_ = pw.Close()
+	if err := <-publishErr; err != nil {
+		h.audit("exec.log_publish_failed", map[string]interface{}{"job_id": jobID, "error": err.Error()})
+	}
+	result := map[string]interface{}{"exit_code": exitCode}
+	if runErr != nil {
+		return result, runErr
 	}
 	return result, nil
 }
 
+// exitCodeOf extracts a command's exit code from the error cmd.Run()
+// returned, distinguishing a normal non-zero exit (reported as an exit
+// code, no error) from a failure to run the command at all (returned as an
+// error).
+func exitCodeOf(runErr error) (int, error) {
+	if runErr == nil {
+		return 0, nil
+	}
+	if exitErr, ok := runErr.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, runErr
+}
+
 func (h *Handler) handleEnvQuery(payload EnvQueryPayload) (interface{}, error) {
 	if !h.Cfg.AllowUnsafeCommands && h.securityEnabled() {
 		return nil, errors.New("environment queries disabled by configuration")
@@ -262,7 +461,7 @@ func (h *Handler) audit(event string, fields map[string]interface{}) {
 
 func (h *Handler) securityEnabled() bool { return !h.Cfg.SecurityBypass }
 
-func (h *Handler) enforceImagePolicy(image string) error {
+func (h *Handler) enforceImagePolicy(ctx context.Context, image string) error {
 	if !h.securityEnabled() || image == "" {
 		return nil
 	}
@@ -282,9 +481,80 @@ func (h *Handler) enforceImagePolicy(image string) error {
 	if h.Cfg.RequireImageDigest && digestFromReference(image) == "" {
 		return fmt.Errorf("image %s must be pinned by digest", image)
 	}
+	if h.signaturePolicyActive() {
+		if err := h.verifyImageSignatureArtifact(ctx, image); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// signatureVerifier builds the dockerutil.SignatureVerifier used to check
+// an image's registry-published signature artifact, backed by the same
+// trustedSignerKeys set verifyImageSignatures checks controller-supplied
+// signatures against.
+func (h *Handler) signatureVerifier() dockerutil.SignatureVerifier {
+	keys, _ := h.trustedSignerKeys()
+	return dockerutil.CosignVerifier{Keys: keys}
+}
+
+// verifyImageSignatureArtifact resolves image's digest (without requiring
+// it to be present locally, unlike EnsureImage) and verifies a signature
+// artifact exists for it in the registry. Used by enforceImagePolicy,
+// before deployCompose/deployImage pull anything; verifyImageDigest calls
+// verifySignatureForDigest directly since it already has a resolved
+// digest. Respects SignaturePolicyMode's warn/enforce semantics the same
+// way verifyImageSignatures does, so both signature checks block a deploy
+// under the same config knob.
+func (h *Handler) verifyImageSignatureArtifact(ctx context.Context, image string) error {
+	digest := digestFromReference(image)
+	if digest == "" {
+		resolved, err := h.Docker.ResolveRemoteDigest(ctx, image, h.Cfg.RegistryAllowList)
+		if err != nil {
+			h.audit("image.verification", map[string]interface{}{"image": image, "mode": h.Cfg.SignaturePolicyMode, "outcome": "digest_resolve_failed", "error": err.Error()})
+			if h.Cfg.SignaturePolicyMode == "enforce" {
+				return fmt.Errorf("resolve digest for signature verification: %w", err)
+			}
+			return nil
+		}
+		digest = resolved
+	}
+	return h.verifySignatureForDigest(ctx, image, digest)
+}
+
+// verifySignatureForDigest checks image@digest's signature artifact,
+// auditing an image.verification event and, under SignaturePolicyMode
+// "enforce", returning an error that aborts the caller's deploy if it
+// doesn't verify ("warn" audits the same outcome but never blocks). The
+// outcome is cached per image@digest for the handler's lifetime, since the
+// same pinned digest is commonly re-verified across blue/green or canary
+// rollout steps and each check otherwise costs a registry round trip.
+func (h *Handler) verifySignatureForDigest(ctx context.Context, image, digest string) error {
+	cacheKey := image + "@" + digest
+	if cached, ok := h.sigVerifyCache.Load(cacheKey); ok {
+		if cached == nil {
+			return nil
+		}
+		return cached.(error)
+	}
+	verifyErr := h.signatureVerifier().VerifySignature(ctx, image, digest)
+	outcome := "verified"
+	if verifyErr != nil {
+		outcome = "failed"
+	}
+	h.audit("image.verification", map[string]interface{}{"image": image, "digest": digest, "mode": h.Cfg.SignaturePolicyMode, "outcome": outcome})
+	if verifyErr == nil {
+		h.sigVerifyCache.Store(cacheKey, (error)(nil))
+		return nil
+	}
+	var err error
+	if h.Cfg.SignaturePolicyMode == "enforce" {
+		err = fmt.Errorf("image signature verification failed for %s: %w", image, verifyErr)
+	}
+	h.sigVerifyCache.Store(cacheKey, err)
+	return err
+}
+
 func (h *Handler) validateVolumeSource(source string) error {
 	if !h.securityEnabled() || len(h.Cfg.AllowedVolumeRoots) == 0 || source == "" {
 		return nil
@@ -310,7 +580,13 @@ func (h *Handler) validateVolumeSource(source string) error {
 }
 
 func (h *Handler) verifyImageDigest(ctx context.Context, image, expected string) error {
-	if !h.securityEnabled() || !h.Cfg.RequireImageDigest {
+	if !h.securityEnabled() {
+		return nil
+	}
+	if !h.Cfg.RequireImageDigest {
+		if h.signaturePolicyActive() {
+			return h.verifyImageSignatureArtifact(ctx, image)
+		}
 		return nil
 	}
 	normalizedExpected := normalizeDigest(expected)
@@ -320,7 +596,7 @@ func (h *Handler) verifyImageDigest(ctx context.Context, image, expected string)
 	if normalizedExpected == "" {
 		return fmt.Errorf("image digest required for %s", image)
 	}
-	if err := h.Docker.EnsureImage(ctx, image); err != nil {
+	if _, err := h.Docker.EnsureImage(ctx, image, h.imageTrustPolicy()); err != nil {
 		return err
 	}
 	digest, err := h.Docker.ImageDigest(ctx, image)
@@ -334,6 +610,11 @@ func (h *Handler) verifyImageDigest(ctx context.Context, image, expected string)
 	if actual != normalizedExpected {
 		return fmt.Errorf("image digest mismatch: expected %s got %s", normalizedExpected, actual)
 	}
+	if h.signaturePolicyActive() {
+		if err := h.verifySignatureForDigest(ctx, image, actual); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -353,6 +634,31 @@ func mapToEnvSlice(env map[string]string) []string {
 	return out
 }
 
+func stringPtrMap(in map[string]string) map[string]*string {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]*string, len(in))
+	for k, v := range in {
+		val := v
+		out[k] = &val
+	}
+	return out
+}
+
+// buildSecretRefs converts a job payload's BuildSecretMapping list into the
+// dockerutil.BuildSecretRef shape BuildImageWithBuildKit expects.
+func buildSecretRefs(in []BuildSecretMapping) []dockerutil.BuildSecretRef {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make([]dockerutil.BuildSecretRef, 0, len(in))
+	for _, s := range in {
+		out = append(out, dockerutil.BuildSecretRef{ID: s.ID, EnvVar: s.EnvVar})
+	}
+	return out
+}
+
 func limitOutput(value string) string {
 	const max = 16384
 	if len(value) <= max {
@@ -415,6 +721,7 @@ const (
 	strategyDeployJSON
 	strategyDockerfile
 	strategyImage
+	strategyKube
 )
 
 type strategySelection struct {
@@ -423,6 +730,7 @@ type strategySelection struct {
 	descriptor  string
 	dockerfile  string
 	image       string
+	manifest    string
 }
 
 func determineStrategy(workdir string, payload DeployJobPayload) (strategySelection, error) {
@@ -444,6 +752,12 @@ func determineStrategy(workdir string, payload DeployJobPayload) (strategySelect
 			return strategySelection{}, fmt.Errorf("strategy image selected but image is empty")
 		}
 		return strategySelection{kind: strategyImage, image: payload.Image}, nil
+	case "kube":
+		manifest := payload.KubeManifest
+		if manifest == "" {
+			manifest = "deploy.kube.yaml"
+		}
+		return strategySelection{kind: strategyKube, manifest: manifest}, nil
 	}
 	if payload.ComposeFile != "" {
 		return strategySelection{kind: strategyCompose, composeFile: payload.ComposeFile}, nil
@@ -455,6 +769,13 @@ func determineStrategy(workdir string, payload DeployJobPayload) (strategySelect
 			return strategySelection{kind: strategyCompose, composeFile: candidate}, nil
 		}
 	}
+	kubeCandidates := []string{"deploy.kube.yaml", "kube.yaml"}
+	for _, candidate := range kubeCandidates {
+		path := filepath.Join(workdir, candidate)
+		if fileExists(path) {
+			return strategySelection{kind: strategyKube, manifest: candidate}, nil
+		}
+	}
 	desc := filepath.Join(workdir, "deploy.json")
 	if fileExists(desc) {
 		return strategySelection{kind: strategyDeployJSON, descriptor: "deploy.json"}, nil
@@ -472,6 +793,15 @@ func determineStrategy(workdir string, payload DeployJobPayload) (strategySelect
 	return strategySelection{}, fmt.Errorf("no deployment artefact found in %s", workdir)
 }
 
+// deployCompose deploys project's services in depends_on order: services
+// with no depends_on go first, then each subsequent wave once every
+// service it depends_on is either running (service_started/
+// service_healthy - deployContainerWithRollback already blocks on
+// WaitHealthy, so "started" and "healthy" are indistinguishable by the
+// time a wave finishes) or, for service_completed_successfully, has
+// exited 0. Any failure tears down every service already started, in
+// reverse wave order, restoring each one's previous generation where one
+// existed.
 func (h *Handler) deployCompose(ctx context.Context, workdir string, payload DeployJobPayload, selection strategySelection) (interface{}, error) {
 	details := composetypes.ConfigDetails{
 		WorkingDir:  workdir,
@@ -485,59 +815,265 @@ func (h *Handler) deployCompose(ctx context.Context, workdir string, payload Dep
 	if project.Name == "" {
 		project.Name = strings.TrimSuffix(filepath.Base(workdir), filepath.Ext(workdir))
 	}
-	results := map[string]string{}
+	waves, err := composeDeployWaves(project.Services)
+	if err != nil {
+		return nil, err
+	}
+	oneShot := composeOneShotServices(project.Services)
+	byName := make(map[string]composetypes.ServiceConfig, len(project.Services))
 	for _, svc := range project.Services {
-		containerName := fmt.Sprintf("%s_%s", project.Name, svc.Name)
-		recordKey := fmt.Sprintf("%s/%s", payload.Name, svc.Name)
-		if svc.Image == "" {
-			return nil, fmt.Errorf("compose service %s missing image reference", svc.Name)
-		}
-		if err := h.enforceImagePolicy(svc.Image); err != nil {
-			return nil, err
-		}
-		expectedDigest := digestFromReference(svc.Image)
-		ports, err := h.resolveServicePorts(payload.Name, svc.Name, svc.Ports)
-		if err != nil {
-			return nil, err
+		byName[svc.Name] = svc
+	}
+
+	type startedService struct {
+		containerName string
+		containerID   string
+		oneShot       bool
+		prev          state.DeploymentRecord
+		hasPrev       bool
+	}
+	var started []startedService
+	rollback := func(cause error) (interface{}, error) {
+		for i := len(started) - 1; i >= 0; i-- {
+			s := started[i]
+			if s.containerID == "" {
+				continue
+			}
+			_ = h.Docker.StopContainer(ctx, s.containerID, nil)
+			_ = h.Docker.RemoveContainer(ctx, s.containerID, true)
+			if !s.oneShot && s.hasPrev {
+				_ = h.recoverPrevious(ctx, s.prev, s.containerName)
+			}
 		}
-		volumes := make([]dockerutil.VolumeBinding, 0, len(svc.Volumes))
-		for _, vol := range svc.Volumes {
-			if vol.Source == "" || vol.Target == "" {
+		return nil, cause
+	}
+
+	results := map[string]string{}
+	for _, wave := range waves {
+		for _, name := range wave {
+			svc := byName[name]
+			containerName := fmt.Sprintf("%s_%s", project.Name, svc.Name)
+			recordKey := fmt.Sprintf("%s/%s", payload.Name, svc.Name)
+			if svc.Image == "" {
+				return rollback(fmt.Errorf("compose service %s missing image reference", svc.Name))
+			}
+			if err := h.enforceImagePolicy(ctx, svc.Image); err != nil {
+				return rollback(err)
+			}
+			expectedDigest := digestFromReference(svc.Image)
+			ports, err := h.resolveServicePorts(payload.Name, svc.Name, svc.Ports)
+			if err != nil {
+				return rollback(err)
+			}
+			volumes := make([]dockerutil.VolumeBinding, 0, len(svc.Volumes))
+			for _, vol := range svc.Volumes {
+				if vol.Source == "" || vol.Target == "" {
+					continue
+				}
+				sourceClean := filepath.Clean(vol.Source)
+				if err := h.validateVolumeSource(sourceClean); err != nil {
+					return rollback(err)
+				}
+				volumes = append(volumes, dockerutil.VolumeBinding{Source: sourceClean, Target: vol.Target})
+			}
+			env := map[string]string{}
+			for k, v := range svc.Environment {
+				if v != nil {
+					env[k] = *v
+				}
+			}
+			labels := dockerutil.WithAgentLabels(svc.Labels)
+			labels["deploybot.job"] = payload.Name
+			labels["deploybot.service"] = svc.Name
+			labels["deploybot.image"] = svc.Image
+
+			if oneShot[svc.Name] {
+				if err := h.verifyImageDigest(ctx, svc.Image, expectedDigest); err != nil {
+					return rollback(err)
+				}
+				if err := h.verifyImageSignatures(ctx, svc.Image, expectedDigest, payload.ImageSignatures, payload.ImageSigners); err != nil {
+					return rollback(err)
+				}
+				id, err := h.Docker.DeploySingle(ctx, dockerutil.DeploySingleOptions{Name: containerName, Image: svc.Image, TrustPolicy: h.imageTrustPolicy(), Environment: env, Ports: ports, Volumes: volumes, Labels: labels, RestartPolicy: "no"})
+				if err != nil {
+					return rollback(fmt.Errorf("service %s: %w", svc.Name, err))
+				}
+				started = append(started, startedService{containerName: containerName, containerID: id, oneShot: true})
+				code, err := h.Docker.WaitExit(ctx, id)
+				if err != nil {
+					return rollback(fmt.Errorf("service %s: wait for completion: %w", svc.Name, err))
+				}
+				if code != 0 {
+					return rollback(fmt.Errorf("service %s exited %d, want 0 for service_completed_successfully", svc.Name, code))
+				}
+				results[containerName] = id
 				continue
 			}
-			sourceClean := filepath.Clean(vol.Source)
-			if err := h.validateVolumeSource(sourceClean); err != nil {
-				return nil, err
+
+			restart := payload.RestartPolicy
+			health := composeHealthToDocker(svc.HealthCheck)
+			if health == nil {
+				health = payload.HealthCheck.toDocker()
+			}
+			req := deployRequest{ContainerName: containerName, Image: svc.Image, Environment: env, Ports: ports, Volumes: volumes, Labels: labels, Health: health, Restart: restart, Signatures: payload.ImageSignatures, Signers: payload.ImageSigners, Replicas: payload.Replicas}
+			prev, hasPrev := h.State.LastDeployment(recordKey)
+			res, err := h.deployContainerWithRollback(ctx, recordKey, req, expectedDigest, rolloutFromPayload(payload))
+			if err != nil {
+				return rollback(err)
+			}
+			containerID := ""
+			if m, ok := res.(map[string]string); ok {
+				containerID = m["container_id"]
+				results[containerName] = containerID
+			} else {
+				results[containerName] = fmt.Sprintf("%v", res)
 			}
-			volumes = append(volumes, dockerutil.VolumeBinding{Source: sourceClean, Target: vol.Target})
+			started = append(started, startedService{containerName: containerName, containerID: containerID, prev: prev, hasPrev: hasPrev})
 		}
-		env := map[string]string{}
-		for k, v := range svc.Environment {
-			if v != nil {
-				env[k] = *v
+	}
+	return results, nil
+}
+
+// composeDeployWaves groups svcs into dependency waves via Kahn's
+// algorithm over svc.DependsOn: wave 0 has no depends_on, wave 1 depends
+// only on wave 0, and so on. An unresolvable depends_on (an unknown
+// service, or a cycle) is reported as an error rather than silently
+// deploying in map order.
+func composeDeployWaves(svcs composetypes.Services) ([][]string, error) {
+	byName := make(map[string]composetypes.ServiceConfig, len(svcs))
+	for _, svc := range svcs {
+		byName[svc.Name] = svc
+	}
+	indegree := make(map[string]int, len(svcs))
+	dependents := make(map[string][]string, len(svcs))
+	for name := range byName {
+		indegree[name] = 0
+	}
+	for _, svc := range svcs {
+		for dep := range svc.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("service %s depends_on unknown service %s", svc.Name, dep)
 			}
+			indegree[svc.Name]++
+			dependents[dep] = append(dependents[dep], svc.Name)
 		}
-		labels := dockerutil.WithAgentLabels(svc.Labels)
-		labels["deploybot.job"] = payload.Name
-		labels["deploybot.service"] = svc.Name
-		labels["deploybot.image"] = svc.Image
-		restart := payload.RestartPolicy
-		res, err := h.deployContainerWithRollback(ctx, recordKey, containerName, svc.Image, expectedDigest, env, ports, volumes, labels, nil, restart)
-		if err != nil {
-			return nil, err
+	}
+
+	var waves [][]string
+	remaining := len(byName)
+	var current []string
+	for name, deg := range indegree {
+		if deg == 0 {
+			current = append(current, name)
 		}
-		if m, ok := res.(map[string]string); ok {
-			results[containerName] = m["container_id"]
-		} else {
-			results[containerName] = fmt.Sprintf("%v", res)
+	}
+	for len(current) > 0 {
+		sort.Strings(current)
+		waves = append(waves, current)
+		remaining -= len(current)
+		var next []string
+		for _, name := range current {
+			for _, dependent := range dependents[name] {
+				indegree[dependent]--
+				if indegree[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
 		}
+		current = next
 	}
-	return results, nil
+	if remaining > 0 {
+		return nil, fmt.Errorf("depends_on cycle detected: %s", strings.Join(composeDependsOnCycle(byName), " -> "))
+	}
+	return waves, nil
+}
+
+// composeOneShotServices returns the set of service names that at least
+// one other service depends_on with condition "service_completed_successfully"
+// - compose's way of saying "run this to completion before starting me",
+// as opposed to the default "service_started"/"service_healthy"
+// conditions, which describe an ordinary long-running service.
+func composeOneShotServices(svcs composetypes.Services) map[string]bool {
+	oneShot := map[string]bool{}
+	for _, svc := range svcs {
+		for dep, cond := range svc.DependsOn {
+			if cond.Condition == "service_completed_successfully" {
+				oneShot[dep] = true
+			}
+		}
+	}
+	return oneShot
+}
+
+// composeDependsOnCycle finds one cycle in byName's depends_on graph via
+// DFS, for composeDeployWaves' error message - just enough to point an
+// operator at the loop, not every cycle if there happen to be several.
+func composeDependsOnCycle(byName map[string]composetypes.ServiceConfig) []string {
+	const (
+		white = iota
+		gray
+		black
+	)
+	color := make(map[string]int, len(byName))
+	var stack []string
+	var cycle []string
+
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		color[name] = gray
+		stack = append(stack, name)
+		deps := make([]string, 0, len(byName[name].DependsOn))
+		for dep := range byName[name].DependsOn {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			switch color[dep] {
+			case white:
+				if visit(dep) {
+					return true
+				}
+			case gray:
+				for i, n := range stack {
+					if n == dep {
+						cycle = append(append([]string{}, stack[i:]...), dep)
+						return true
+					}
+				}
+			}
+		}
+		color[name] = black
+		stack = stack[:len(stack)-1]
+		return false
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if color[name] == white && visit(name) {
+			break
+		}
+	}
+	return cycle
 }
 
 func (h *Handler) deployDescriptor(ctx context.Context, workdir string, payload DeployJobPayload, selection strategySelection) (interface{}, error) {
 	path := filepath.Join(workdir, selection.descriptor)
-	descriptor, err := loadDeployDescriptor(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if looksLikeBundle(data) {
+		bundle, err := loadDeployBundle(data)
+		if err != nil {
+			return nil, err
+		}
+		return h.deployBundle(ctx, payload, bundle)
+	}
+	descriptor, err := parseDeployDescriptor(data)
 	if err != nil {
 		return nil, err
 	}
@@ -545,13 +1081,23 @@ func (h *Handler) deployDescriptor(ctx context.Context, workdir string, payload
 	if image == "" {
 		return nil, fmt.Errorf("deploy.json missing image")
 	}
-	if err := h.enforceImagePolicy(image); err != nil {
+	if err := h.enforceImagePolicy(ctx, image); err != nil {
 		return nil, err
 	}
 	expectedDigest := descriptor.ImageDigest
 	if expectedDigest == "" {
 		expectedDigest = payload.ImageDigest
 	}
+	if expectedDigest == "" {
+		resolved, err := h.Docker.ResolvePlatformDigest(ctx, image, descriptor.Platform)
+		if err != nil {
+			return nil, fmt.Errorf("resolve platform digest: %w", err)
+		}
+		if prev, ok := h.State.LastDeployment(payload.Name); ok && prev.Image == image && prev.PinnedDigest != "" && prev.PinnedDigest != resolved && !descriptor.AllowTagDrift {
+			return nil, fmt.Errorf("image %s resolved to %s but was pinned to %s on a previous deploy; bump image_digest or set allow_tag_drift to accept it", image, resolved, prev.PinnedDigest)
+		}
+		expectedDigest = resolved
+	}
 	ports, err := h.preparePorts(descriptor.Ports)
 	if err != nil {
 		return nil, err
@@ -577,24 +1123,60 @@ func (h *Handler) deployDescriptor(ctx context.Context, workdir string, payload
 	if restart == "" {
 		restart = payload.RestartPolicy
 	}
-	return h.deployContainerWithRollback(ctx, payload.Name, containerName, image, expectedDigest, env, ports, volumes, labels, health, restart)
+	replicas := descriptor.Replicas
+	if replicas == 0 {
+		replicas = payload.Replicas
+	}
+	signers := descriptor.ImageSigners
+	if len(signers) == 0 {
+		signers = payload.ImageSigners
+	}
+	req := deployRequest{ContainerName: containerName, Image: image, Environment: env, Ports: ports, Volumes: volumes, Labels: labels, Health: health, Restart: restart, Signatures: payload.ImageSignatures, Signers: signers, Replicas: replicas}
+	// deployContainerWithRollback's rollout functions stamp Image/PinnedDigest
+	// onto the record themselves now, for every mode - no post-patch needed
+	// here the way there used to be when only deployRecreate did so.
+	return h.deployContainerWithRollback(ctx, payload.Name, req, expectedDigest, rolloutFromPayload(payload))
 }
 
-func (h *Handler) deployDockerfile(ctx context.Context, workdir string, payload DeployJobPayload, selection strategySelection) (interface{}, error) {
+func (h *Handler) deployDockerfile(ctx context.Context, jobID, workdir string, payload DeployJobPayload, selection strategySelection) (interface{}, error) {
 	tagBase := sanitizeName(payload.Name)
 	if tagBase == "" {
 		tagBase = sanitizeName(filepath.Base(workdir))
 	}
 	imageTag := dockerutil.SanitizeTag("deploybot/" + tagBase)
-	if err := h.buildImage(ctx, workdir, selection.dockerfile, imageTag); err != nil {
+	buildOpts := dockerutil.BuildOptions{
+		Target:     payload.BuildTarget,
+		BuildArgs:  stringPtrMap(payload.BuildArgs),
+		CacheFrom:  payload.BuildCacheFrom,
+		CacheTo:    payload.BuildCacheTo,
+		Platform:   payload.BuildPlatform,
+		Platforms:  payload.BuildPlatforms,
+		Builder:    payload.Builder,
+		Secrets:    buildSecretRefs(payload.BuildSecrets),
+		SBOM:       payload.BuildSBOM,
+		Provenance: payload.BuildProvenance,
+	}
+	h.analyzeDockerfile(jobID, workdir, selection.dockerfile)
+	digest, err := h.buildImage(ctx, jobID, workdir, selection.dockerfile, imageTag, buildOpts)
+	if err != nil {
 		return nil, err
 	}
-	expectedDigest := ""
-	if h.securityEnabled() && h.Cfg.RequireImageDigest {
-		digest, err := h.Docker.ImageDigest(ctx, imageTag)
+	if len(payload.BuildPlatforms) > 1 {
+		// A multi-platform buildkit export produces a manifest list, not a
+		// single image the local daemon can load - imageTag must already
+		// be a real, pushable registry reference for BuildImageWithBuildKit's
+		// push to have landed anywhere (the same assumption handleBuild's
+		// PushTo makes). Pin to the child manifest matching this agent's
+		// own host platform, same as a deploy descriptor's per-service
+		// Platform hint does in deployDescriptor.
+		resolved, err := h.Docker.ResolvePlatformDigest(ctx, imageTag, "")
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("resolve host-platform manifest: %w", err)
 		}
+		digest = resolved
+	}
+	expectedDigest := ""
+	if h.securityEnabled() && h.Cfg.RequireImageDigest {
 		expectedDigest = digest
 	}
 	ports, err := h.preparePorts(payload.Ports)
@@ -620,11 +1202,12 @@ func (h *Handler) deployDockerfile(ctx context.Context, workdir string, payload
 	if containerName == "" {
 		containerName = sanitizeName(filepath.Base(workdir))
 	}
-	return h.deployContainerWithRollback(ctx, payload.Name, containerName, imageTag, expectedDigest, payload.Environment, ports, volumes, labels, health, restart)
+	req := deployRequest{ContainerName: containerName, Image: imageTag, Environment: payload.Environment, Ports: ports, Volumes: volumes, Labels: labels, Health: health, Restart: restart, Signatures: payload.ImageSignatures, Signers: payload.ImageSigners, Replicas: payload.Replicas}
+	return h.deployContainerWithRollback(ctx, payload.Name, req, expectedDigest, rolloutFromPayload(payload))
 }
 
 func (h *Handler) deployImage(ctx context.Context, _ string, payload DeployJobPayload, selection strategySelection) (interface{}, error) {
-	if err := h.enforceImagePolicy(selection.image); err != nil {
+	if err := h.enforceImagePolicy(ctx, selection.image); err != nil {
 		return nil, err
 	}
 	expectedDigest := payload.ImageDigest
@@ -654,23 +1237,141 @@ func (h *Handler) deployImage(ctx context.Context, _ string, payload DeployJobPa
 	if containerName == "" {
 		containerName = sanitizeName(selection.image)
 	}
-	return h.deployContainerWithRollback(ctx, payload.Name, containerName, selection.image, expectedDigest, payload.Environment, ports, volumes, labels, health, restart)
+	req := deployRequest{ContainerName: containerName, Image: selection.image, Environment: payload.Environment, Ports: ports, Volumes: volumes, Labels: labels, Health: health, Restart: restart, Signatures: payload.ImageSignatures, Signers: payload.ImageSigners, Replicas: payload.Replicas}
+	return h.deployContainerWithRollback(ctx, payload.Name, req, expectedDigest, rolloutFromPayload(payload))
 }
 
-func (h *Handler) deployContainerWithRollback(ctx context.Context, recordKey, containerName, image string, expectedDigest string, env map[string]string, ports []dockerutil.PortBinding, volumes []dockerutil.VolumeBinding, labels map[string]string, health *container.HealthConfig, restart string) (interface{}, error) {
-	if err := h.enforceImagePolicy(image); err != nil {
+// DeploymentMode selects how deployContainerWithRollback transitions from
+// any previous deployment under the same record key to the new one.
+type DeploymentMode string
+
+const (
+	// ModeRecreate stops the previous container before the new one is
+	// confirmed healthy; it's the cheapest mode but has a brief window with
+	// no running instance if the new container never comes up healthy.
+	ModeRecreate DeploymentMode = "recreate"
+	// ModeBlueGreen starts the new container alongside the old one under a
+	// temporary name and only tears down the old one once the new one is
+	// healthy, so there's never a window with zero healthy instances.
+	ModeBlueGreen DeploymentMode = "blue_green"
+	// ModeCanary ramps traffic to the new version across a weighted
+	// schedule, bailing out to the previous replica set if health
+	// deteriorates at any step.
+	ModeCanary DeploymentMode = "canary"
+)
+
+// rolloutOptions carries a deploy job's rollout-mode configuration through
+// to deployContainerWithRollback, independent of which strategy (compose,
+// descriptor, Dockerfile, image) produced the container spec.
+type rolloutOptions struct {
+	Mode              DeploymentMode
+	CanaryReplicas    int
+	CanaryBakeSeconds int
+}
+
+func rolloutFromPayload(payload DeployJobPayload) rolloutOptions {
+	return rolloutOptions{
+		Mode:              DeploymentMode(strings.ToLower(payload.DeploymentMode)),
+		CanaryReplicas:    payload.CanaryReplicas,
+		CanaryBakeSeconds: payload.CanaryBakeSeconds,
+	}
+}
+
+// deployRequest bundles the container spec every rollout mode needs,
+// independent of which deploy strategy produced it.
+type deployRequest struct {
+	ContainerName string
+	Image         string
+	Environment   map[string]string
+	Ports         []dockerutil.PortBinding
+	Volumes       []dockerutil.VolumeBinding
+	Labels        map[string]string
+	Health        *container.HealthConfig
+	Restart       string
+	Network       string
+	Signatures    []string
+	// Signers, if set, overrides the agent-wide TrustedSignerKeys for this
+	// request's Signatures check (see DeployJobPayload.ImageSigners).
+	Signers []string
+	// Replicas, if greater than 1, tells deployContainerWithRollback to
+	// deploy a replica set (see deployReplicaSet) instead of a single
+	// container, except in canary mode, where deployCanary sizes the
+	// rollout from CanaryReplicas instead. <=1 is normalized to 1 there.
+	Replicas int
+}
+
+// deployContainerWithRollback is where hooks are invoked: prePull before
+// anything touches the registry or Docker, preStart once the container's
+// final spec (image, labels, env) is settled but before deployRecreate/
+// deployBlueGreen/deployCanary/deployReplicaSet create it, and postStart/
+// postRollback once the mode-specific function returns. DeploySingle
+// creates and starts a container as one call with no gap to hook into
+// between "created" and "started", so preStart here fires just before
+// creation rather than strictly between create and start.
+func (h *Handler) deployContainerWithRollback(ctx context.Context, recordKey string, req deployRequest, expectedDigest string, rollout rolloutOptions) (interface{}, error) {
+	hookState := hooks.State{ID: recordKey, Name: req.ContainerName, Image: req.Image, Labels: req.Labels, Env: mapToEnvSlice(req.Environment)}
+	if err := h.runHooks(ctx, hooks.StagePrePull, hookState, true); err != nil {
 		return nil, err
 	}
-	if err := h.verifyImageDigest(ctx, image, expectedDigest); err != nil {
+	if err := h.enforceImagePolicy(ctx, req.Image); err != nil {
 		return nil, err
 	}
-	labels = dockerutil.WithAgentLabels(labels)
-	labels["deploybot.container"] = containerName
-	labels["deploybot.image"] = image
+	if err := h.verifyImageDigest(ctx, req.Image, expectedDigest); err != nil {
+		return nil, err
+	}
+	if err := h.verifyImageSignatures(ctx, req.Image, expectedDigest, req.Signatures, req.Signers); err != nil {
+		return nil, err
+	}
+	req.Labels = dockerutil.WithAgentLabels(req.Labels)
+	req.Labels["deploybot.container"] = req.ContainerName
+	req.Labels["deploybot.image"] = req.Image
+	if req.Restart == "" {
+		req.Restart = "unless-stopped"
+	}
+	hookState.Labels = req.Labels
+	if err := h.runHooks(ctx, hooks.StagePreStart, hookState, true); err != nil {
+		return nil, err
+	}
+	if req.Replicas <= 0 {
+		req.Replicas = 1
+	}
 	prev, hasPrev := h.State.LastDeployment(recordKey)
+	var result interface{}
+	var err error
+	switch {
+	case req.Replicas > 1 && rollout.Mode != ModeCanary:
+		result, err = h.deployReplicaSet(ctx, recordKey, req, expectedDigest, rollout, prev, hasPrev)
+	case rollout.Mode == ModeBlueGreen:
+		result, err = h.deployBlueGreen(ctx, recordKey, req, expectedDigest, prev, hasPrev)
+	case rollout.Mode == ModeCanary:
+		result, err = h.deployCanary(ctx, recordKey, req, expectedDigest, rollout, prev, hasPrev)
+	default:
+		result, err = h.deployRecreate(ctx, recordKey, req, expectedDigest, prev, hasPrev)
+	}
+	if err != nil {
+		_ = h.runHooks(ctx, hooks.StagePostRollback, hookState, false)
+		return nil, err
+	}
+	if m, ok := result.(map[string]string); ok {
+		hookState.ID = m["container_id"]
+	}
+	_ = h.runHooks(ctx, hooks.StagePostStart, hookState, false)
+	return result, nil
+}
+
+// runHooks is a nil-safe wrapper around Handler.Hooks.Run; a Handler with
+// no Hooks manager configured (the common case) runs no hooks at all.
+func (h *Handler) runHooks(ctx context.Context, stage string, state hooks.State, fatal bool) error {
+	if h.Hooks == nil {
+		return nil
+	}
+	return h.Hooks.Run(ctx, stage, state, fatal)
+}
+
+func (h *Handler) deployRecreate(ctx context.Context, recordKey string, req deployRequest, expectedDigest string, prev state.DeploymentRecord, hasPrev bool) (interface{}, error) {
 	var prevRename string
 	if hasPrev {
-		prevRename = fmt.Sprintf("%s-previous-%d", containerName, time.Now().Unix())
+		prevRename = fmt.Sprintf("%s-previous-%d", req.ContainerName, time.Now().Unix())
 		stopCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 		_ = h.Docker.StopContainer(stopCtx, prev.ContainerID, nil)
@@ -678,13 +1379,10 @@ func (h *Handler) deployContainerWithRollback(ctx context.Context, recordKey, co
 			return nil, err
 		}
 	}
-	if restart == "" {
-		restart = "unless-stopped"
-	}
-	id, err := h.Docker.DeploySingle(ctx, dockerutil.DeploySingleOptions{Name: containerName, Image: image, Environment: env, Ports: ports, Volumes: volumes, Labels: labels, Healthcheck: health, RestartPolicy: restart})
+	id, err := h.Docker.DeploySingle(ctx, dockerutil.DeploySingleOptions{Name: req.ContainerName, Image: req.Image, TrustPolicy: h.imageTrustPolicy(), Environment: req.Environment, Ports: req.Ports, Volumes: req.Volumes, Labels: req.Labels, Healthcheck: req.Health, RestartPolicy: req.Restart, Network: req.Network})
 	if err != nil {
 		if hasPrev {
-			_ = h.recoverPrevious(ctx, prev.ContainerID, containerName)
+			_ = h.recoverPrevious(ctx, prev, req.ContainerName)
 		}
 		return nil, err
 	}
@@ -692,21 +1390,418 @@ func (h *Handler) deployContainerWithRollback(ctx context.Context, recordKey, co
 		_ = h.Docker.StopContainer(ctx, id, nil)
 		_ = h.Docker.RemoveContainer(ctx, id, true)
 		if hasPrev {
-			_ = h.recoverPrevious(ctx, prev.ContainerID, containerName)
+			_ = h.recoverPrevious(ctx, prev, req.ContainerName)
+		}
+		return nil, err
+	}
+	// prevRename is kept stopped rather than removed: it becomes prev's
+	// rollback-history generation below, so a later "rollback" job can
+	// rename it back to req.ContainerName and start it. Only generations
+	// beyond HistoryDepth are actually pruned, by PushHistory.
+	record := state.DeploymentRecord{Name: req.ContainerName, ContainerID: id, Mode: string(ModeRecreate), Image: req.Image, PinnedDigest: expectedDigest, EnvHash: hashEnvironment(req.Environment), Ports: portList(req.Ports), DeployedAt: time.Now()}
+	_ = h.State.RecordDeployment(recordKey, record)
+	if hasPrev {
+		gen := state.DeploymentGeneration{ContainerID: prev.ContainerID, Image: prev.Image, PinnedDigest: prev.PinnedDigest, EnvHash: prev.EnvHash, Ports: prev.Ports, DeployedAt: prev.DeployedAt}
+		if err := h.State.PushHistory(recordKey, gen, h.Cfg.HistoryDepth); err != nil {
+			h.audit("rollback.history_error", map[string]interface{}{"name": recordKey, "error": err.Error()})
+		}
+		h.pruneHistory(ctx, recordKey)
+	}
+	return map[string]string{"container_id": id}, nil
+}
+
+// pruneHistory removes the Docker container behind any generation that
+// PushHistory has already trimmed out of a record's History, so a
+// stopped-and-renamed "-previous-<ts>" container from deployRecreate
+// doesn't linger forever once it ages past HistoryDepth.
+func (h *Handler) pruneHistory(ctx context.Context, recordKey string) {
+	history, ok := h.State.ListDeploymentHistory(recordKey)
+	if !ok {
+		return
+	}
+	kept := make(map[string]bool, len(history))
+	for _, gen := range history {
+		kept[gen.ContainerID] = true
+		for _, id := range gen.ReplicaIDs {
+			kept[id] = true
+		}
+	}
+	rec, ok := h.State.LastDeployment(recordKey)
+	if !ok {
+		return
+	}
+	if rec.ContainerID != "" {
+		kept[rec.ContainerID] = true
+	}
+	for _, id := range rec.ReplicaIDs {
+		kept[id] = true
+	}
+	containers, err := h.Docker.FindContainerByLabel(ctx, "deploybot.container", rec.Name)
+	if err != nil {
+		return
+	}
+	for _, c := range containers {
+		if kept[c.ID] {
+			continue
+		}
+		_ = h.Docker.RemoveContainer(ctx, c.ID, true)
+	}
+}
+
+// hashEnvironment fingerprints a deploy's resolved environment for
+// DeploymentRecord/DeploymentGeneration, independent of map iteration
+// order.
+func hashEnvironment(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, env[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// portList extracts the published host ports from a deploy's port
+// bindings, for display via ListDeploymentHistory.
+func portList(ports []dockerutil.PortBinding) []int {
+	if len(ports) == 0 {
+		return nil
+	}
+	out := make([]int, 0, len(ports))
+	for _, p := range ports {
+		out = append(out, p.HostPort)
+	}
+	return out
+}
+
+// handleRollback reverses a deployRecreate swap: stop the current
+// container, rename the target History generation's container back to the
+// canonical name, start it, wait healthy, and make it the new current
+// record (pushing the deposed current onto History in turn, so a rollback
+// is itself rollback-able).
+func (h *Handler) handleRollback(ctx context.Context, payload RollbackJobPayload) (interface{}, error) {
+	if payload.Name == "" {
+		return nil, errors.New("rollback job missing name")
+	}
+	current, ok := h.State.LastDeployment(payload.Name)
+	if !ok {
+		return nil, fmt.Errorf("no deployment recorded for %s", payload.Name)
+	}
+	history, ok := h.State.ListDeploymentHistory(payload.Name)
+	if !ok || len(history) == 0 {
+		return nil, fmt.Errorf("no rollback history recorded for %s", payload.Name)
+	}
+	generation := payload.Generation
+	if generation >= 0 {
+		if generation >= len(history) {
+			return nil, fmt.Errorf("generation %d out of range, have %d", generation, len(history))
+		}
+	} else {
+		back := -generation
+		if back == 0 {
+			back = 1
+		}
+		if back > len(history) {
+			return nil, fmt.Errorf("generation -%d out of range, have %d", back, len(history))
+		}
+		generation = len(history) - back
+	}
+	target := history[generation]
+
+	if err := h.Docker.StopContainer(ctx, current.ContainerID, nil); err != nil {
+		return nil, fmt.Errorf("stop current container: %w", err)
+	}
+	if err := h.Docker.RenameContainer(ctx, target.ContainerID, payload.Name); err != nil {
+		return nil, fmt.Errorf("rename rollback target: %w", err)
+	}
+	if err := h.Docker.StartContainer(ctx, target.ContainerID); err != nil {
+		return nil, fmt.Errorf("start rollback target: %w", err)
+	}
+	if err := h.Docker.WaitHealthy(ctx, target.ContainerID, h.Cfg.HealthTimeout); err != nil {
+		return nil, fmt.Errorf("rollback target did not become healthy: %w", err)
+	}
+
+	record := state.DeploymentRecord{Name: payload.Name, ContainerID: target.ContainerID, Mode: current.Mode, Image: target.Image, PinnedDigest: target.PinnedDigest, EnvHash: target.EnvHash, Ports: target.Ports, DeployedAt: time.Now()}
+	if err := h.State.RecordDeployment(payload.Name, record); err != nil {
+		return nil, err
+	}
+	deposed := state.DeploymentGeneration{ContainerID: current.ContainerID, Image: current.Image, PinnedDigest: current.PinnedDigest, EnvHash: current.EnvHash, Ports: current.Ports, DeployedAt: current.DeployedAt}
+	if err := h.State.PushHistory(payload.Name, deposed, h.Cfg.HistoryDepth); err != nil {
+		h.audit("rollback.history_error", map[string]interface{}{"name": payload.Name, "error": err.Error()})
+	}
+	h.audit("rollback.applied", map[string]interface{}{"name": payload.Name, "generation": generation, "container_id": target.ContainerID})
+	return map[string]string{"container_id": target.ContainerID}, nil
+}
+
+// deployBlueGreen starts the new container under a temporary name, waits
+// for it to report healthy, then swaps container names so the canonical
+// containerName only ever belongs to a healthy instance - Docker has no API
+// to mutate labels on a running container, so the "atomic flip" a reverse
+// proxy discovering backends by container name sees is this rename swap
+// rather than an in-place label update.
+func (h *Handler) deployBlueGreen(ctx context.Context, recordKey string, req deployRequest, expectedDigest string, prev state.DeploymentRecord, hasPrev bool) (interface{}, error) {
+	tempName := fmt.Sprintf("%s-green-%d", req.ContainerName, time.Now().Unix())
+	labels := copyLabels(req.Labels)
+	labels["deploybot.active"] = "false"
+	id, err := h.Docker.DeploySingle(ctx, dockerutil.DeploySingleOptions{Name: tempName, Image: req.Image, TrustPolicy: h.imageTrustPolicy(), Environment: req.Environment, Ports: req.Ports, Volumes: req.Volumes, Labels: labels, Healthcheck: req.Health, RestartPolicy: req.Restart, Network: req.Network})
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Docker.WaitHealthy(ctx, id, h.Cfg.HealthTimeout); err != nil {
+		_ = h.Docker.StopContainer(ctx, id, nil)
+		_ = h.Docker.RemoveContainer(ctx, id, true)
+		return nil, err
+	}
+	if hasPrev {
+		outgoingName := fmt.Sprintf("%s-outgoing-%d", req.ContainerName, time.Now().Unix())
+		if err := h.Docker.RenameContainer(ctx, prev.ContainerID, outgoingName); err != nil {
+			return nil, err
 		}
+	}
+	if err := h.Docker.RenameContainer(ctx, id, req.ContainerName); err != nil {
 		return nil, err
 	}
 	if hasPrev {
-		_ = h.Docker.RemoveContainer(ctx, prevRename, true)
+		// Stopped rather than removed: it becomes prev's rollback-history
+		// generation below, exactly as deployRecreate's prevRename does.
+		_ = h.Docker.StopContainer(ctx, prev.ContainerID, nil)
 	}
-	record := state.DeploymentRecord{Name: containerName, ContainerID: id}
+	record := state.DeploymentRecord{Name: req.ContainerName, ContainerID: id, Mode: string(ModeBlueGreen), Image: req.Image, PinnedDigest: expectedDigest, EnvHash: hashEnvironment(req.Environment), Ports: portList(req.Ports), DeployedAt: time.Now()}
 	_ = h.State.RecordDeployment(recordKey, record)
+	if hasPrev {
+		gen := state.DeploymentGeneration{ContainerID: prev.ContainerID, Image: prev.Image, PinnedDigest: prev.PinnedDigest, EnvHash: prev.EnvHash, Ports: prev.Ports, DeployedAt: prev.DeployedAt}
+		if err := h.State.PushHistory(recordKey, gen, h.Cfg.HistoryDepth); err != nil {
+			h.audit("rollback.history_error", map[string]interface{}{"name": recordKey, "error": err.Error()})
+		}
+		h.pruneHistory(ctx, recordKey)
+	}
 	return map[string]string{"container_id": id}, nil
 }
 
-func (h *Handler) recoverPrevious(ctx context.Context, id, desiredName string) error {
-	_ = h.Docker.RenameContainer(ctx, id, desiredName)
-	return h.Docker.StartContainer(ctx, id)
+// deployReplicaSet deploys req.Replicas copies of req side by side, named
+// "<ContainerName>-1".."<ContainerName>-N" like a Kubernetes
+// ReplicationController stamping out pods from a template with
+// GenerateName. Every replica beyond the first reserves its own host port
+// per target port (req.Ports' published ports can't be shared across
+// containers). The whole new set must report healthy before the previous
+// set (if any) is torn down; if any replica fails, every new replica is
+// stopped and removed and the previous set is left running untouched.
+func (h *Handler) deployReplicaSet(ctx context.Context, recordKey string, req deployRequest, expectedDigest string, rollout rolloutOptions, prev state.DeploymentRecord, hasPrev bool) (interface{}, error) {
+	mode := rollout.Mode
+	if mode == "" {
+		mode = ModeRecreate
+	}
+
+	var newReplicas []string
+	rollback := func(cause error) (interface{}, error) {
+		for _, id := range newReplicas {
+			_ = h.Docker.StopContainer(ctx, id, nil)
+			_ = h.Docker.RemoveContainer(ctx, id, true)
+		}
+		return nil, cause
+	}
+
+	for i := 1; i <= req.Replicas; i++ {
+		name := fmt.Sprintf("%s-%d", req.ContainerName, i)
+		ports := req.Ports
+		if i > 1 {
+			reserved, err := h.reservePortsForReplica(recordKey, req.Ports, i)
+			if err != nil {
+				return rollback(fmt.Errorf("replica %d: reserve ports: %w", i, err))
+			}
+			ports = reserved
+		}
+		labels := copyLabels(req.Labels)
+		labels["deploybot.replica"] = fmt.Sprintf("%d", i)
+		id, err := h.Docker.DeploySingle(ctx, dockerutil.DeploySingleOptions{Name: name, Image: req.Image, TrustPolicy: h.imageTrustPolicy(), Environment: req.Environment, Ports: ports, Volumes: req.Volumes, Labels: labels, Healthcheck: req.Health, RestartPolicy: req.Restart, Network: req.Network})
+		if err != nil {
+			return rollback(fmt.Errorf("replica %d: %w", i, err))
+		}
+		if err := h.Docker.WaitHealthy(ctx, id, h.Cfg.HealthTimeout); err != nil {
+			_ = h.Docker.StopContainer(ctx, id, nil)
+			_ = h.Docker.RemoveContainer(ctx, id, true)
+			return rollback(fmt.Errorf("replica %d: %w", i, err))
+		}
+		newReplicas = append(newReplicas, id)
+	}
+
+	var oldReplicas []string
+	if hasPrev {
+		oldReplicas = prev.ReplicaIDs
+		if len(oldReplicas) == 0 {
+			oldReplicas = []string{prev.ContainerID}
+		}
+		for _, id := range oldReplicas {
+			// Stopped rather than removed: it becomes prev's rollback-history
+			// generation below, exactly as deployRecreate's prevRename does.
+			_ = h.Docker.StopContainer(ctx, id, nil)
+		}
+	}
+
+	record := state.DeploymentRecord{Name: req.ContainerName, ContainerID: newReplicas[0], ReplicaIDs: newReplicas, Mode: string(mode), Weight: 100, Image: req.Image, PinnedDigest: expectedDigest, EnvHash: hashEnvironment(req.Environment), Ports: portList(req.Ports), DeployedAt: time.Now()}
+	_ = h.State.RecordDeployment(recordKey, record)
+	if hasPrev {
+		gen := state.DeploymentGeneration{ContainerID: oldReplicas[0], ReplicaIDs: oldReplicas, Image: prev.Image, PinnedDigest: prev.PinnedDigest, EnvHash: prev.EnvHash, Ports: prev.Ports, DeployedAt: prev.DeployedAt}
+		if err := h.State.PushHistory(recordKey, gen, h.Cfg.HistoryDepth); err != nil {
+			h.audit("rollback.history_error", map[string]interface{}{"name": recordKey, "error": err.Error()})
+		}
+		h.pruneHistory(ctx, recordKey)
+	}
+	return map[string]interface{}{"container_id": newReplicas[0], "replica_ids": newReplicas}, nil
+}
+
+// reservePortsForReplica builds a fresh set of published-port bindings for
+// the Nth (1-indexed, N>=2) replica in a replica set, keeping base's target
+// ports/protocols but reserving a new host port per target - replica 1 keeps
+// base unchanged, since two containers can't publish the same host port.
+func (h *Handler) reservePortsForReplica(recordKey string, base []dockerutil.PortBinding, replica int) ([]dockerutil.PortBinding, error) {
+	out := make([]dockerutil.PortBinding, 0, len(base))
+	for _, b := range base {
+		key := fmt.Sprintf("%s:replica:%d:%d", recordKey, replica, b.ContainerPort)
+		port, err := h.State.ReservePort(key, 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dockerutil.PortBinding{ContainerPort: b.ContainerPort, HostPort: port, Protocol: b.Protocol})
+	}
+	return out, nil
+}
+
+// canarySchedule is the traffic-weight ramp a canary deploy steps through.
+var canarySchedule = []int{10, 25, 50, 100}
+
+// canaryBakeDefault is used when a canary job doesn't specify a bake time
+// between ramp steps.
+const canaryBakeDefault = 30 * time.Second
+
+// deployCanary ramps req.Image in across canarySchedule, scaling up new
+// replicas and scaling down old ones to match each step's weight, bake-time
+// health-checking the new replicas between steps, and rolling the whole
+// step back to the previous replica set if any replica fails.
+func (h *Handler) deployCanary(ctx context.Context, recordKey string, req deployRequest, expectedDigest string, rollout rolloutOptions, prev state.DeploymentRecord, hasPrev bool) (interface{}, error) {
+	replicas := rollout.CanaryReplicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+	bake := time.Duration(rollout.CanaryBakeSeconds) * time.Second
+	if bake <= 0 {
+		bake = canaryBakeDefault
+	}
+
+	oldReplicas := append([]string{}, prev.ReplicaIDs...)
+	if len(oldReplicas) == 0 && hasPrev {
+		oldReplicas = []string{prev.ContainerID}
+	}
+	// allOldReplicas is the full original set, kept around for rollback: none
+	// of them are removed from Docker until the entire ramp succeeds (see
+	// below), so a failure at any step can always restart every one of them,
+	// not just whatever oldReplicas has shrunk to by that step.
+	allOldReplicas := append([]string{}, oldReplicas...)
+	var newReplicas []string
+
+	rollback := func(cause error) (interface{}, error) {
+		for _, id := range newReplicas {
+			_ = h.Docker.StopContainer(ctx, id, nil)
+			_ = h.Docker.RemoveContainer(ctx, id, true)
+		}
+		for _, id := range allOldReplicas {
+			_ = h.Docker.StartContainer(ctx, id)
+		}
+		return nil, cause
+	}
+
+	for _, weight := range canarySchedule {
+		targetNew := (replicas*weight + 99) / 100
+		if targetNew > replicas {
+			targetNew = replicas
+		}
+		for len(newReplicas) < targetNew {
+			name := fmt.Sprintf("%s-canary-%d-%d", req.ContainerName, weight, len(newReplicas))
+			labels := copyLabels(req.Labels)
+			labels["deploybot.weight"] = fmt.Sprintf("%d", weight)
+			labels["deploybot.canary"] = "true"
+			id, err := h.Docker.DeploySingle(ctx, dockerutil.DeploySingleOptions{Name: name, Image: req.Image, TrustPolicy: h.imageTrustPolicy(), Environment: req.Environment, Ports: req.Ports, Volumes: req.Volumes, Labels: labels, Healthcheck: req.Health, RestartPolicy: req.Restart, Network: req.Network})
+			if err != nil {
+				return rollback(fmt.Errorf("canary step %d%%: %w", weight, err))
+			}
+			if err := h.Docker.WaitHealthy(ctx, id, h.Cfg.HealthTimeout); err != nil {
+				_ = h.Docker.StopContainer(ctx, id, nil)
+				_ = h.Docker.RemoveContainer(ctx, id, true)
+				return rollback(fmt.Errorf("canary step %d%%: %w", weight, err))
+			}
+			newReplicas = append(newReplicas, id)
+		}
+
+		targetOld := replicas - targetNew
+		for len(oldReplicas) > targetOld {
+			id := oldReplicas[len(oldReplicas)-1]
+			oldReplicas = oldReplicas[:len(oldReplicas)-1]
+			// Stopped, not removed: removing here would permanently lose this
+			// replica if a later step's bake-time health check fails and
+			// rollback needs to restart every one of allOldReplicas.
+			_ = h.Docker.StopContainer(ctx, id, nil)
+		}
+
+		if weight < 100 {
+			select {
+			case <-time.After(bake):
+			case <-ctx.Done():
+				return rollback(ctx.Err())
+			}
+			for _, id := range newReplicas {
+				healthy, err := h.Docker.ContainerHealthy(ctx, id)
+				if err != nil || !healthy {
+					return rollback(fmt.Errorf("canary step %d%%: replica %s failed its bake-time health check", weight, id))
+				}
+			}
+		}
+	}
+
+	// The entire ramp succeeded: allOldReplicas are all already stopped (the
+	// loop above stopped each one as it was displaced), and it's now safe to
+	// let them become prev's rollback-history generation instead of
+	// restarting them, exactly as deployRecreate/deployBlueGreen do.
+	record := state.DeploymentRecord{Name: req.ContainerName, ContainerID: newReplicas[0], ReplicaIDs: newReplicas, Mode: string(ModeCanary), Weight: 100, Image: req.Image, PinnedDigest: expectedDigest, EnvHash: hashEnvironment(req.Environment), Ports: portList(req.Ports), DeployedAt: time.Now()}
+	_ = h.State.RecordDeployment(recordKey, record)
+	if hasPrev {
+		gen := state.DeploymentGeneration{ContainerID: allOldReplicas[0], ReplicaIDs: allOldReplicas, Image: prev.Image, PinnedDigest: prev.PinnedDigest, EnvHash: prev.EnvHash, Ports: prev.Ports, DeployedAt: prev.DeployedAt}
+		if err := h.State.PushHistory(recordKey, gen, h.Cfg.HistoryDepth); err != nil {
+			h.audit("rollback.history_error", map[string]interface{}{"name": recordKey, "error": err.Error()})
+		}
+		h.pruneHistory(ctx, recordKey)
+	}
+	return map[string]interface{}{"container_id": newReplicas[0], "replica_ids": newReplicas}, nil
+}
+
+func copyLabels(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// recoverPrevious restores prev after a failed rollout, rename+start for a
+// single-container deployment or a plain start for every replica of a
+// canary deployment that was never consolidated.
+func (h *Handler) recoverPrevious(ctx context.Context, prev state.DeploymentRecord, desiredName string) error {
+	if len(prev.ReplicaIDs) > 0 {
+		var firstErr error
+		for _, id := range prev.ReplicaIDs {
+			if err := h.Docker.StartContainer(ctx, id); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+	_ = h.Docker.RenameContainer(ctx, prev.ContainerID, desiredName)
+	return h.Docker.StartContainer(ctx, prev.ContainerID)
 }
 
 func (h *Handler) resolveServicePorts(jobName, serviceName string, ports []composetypes.ServicePortConfig) ([]dockerutil.PortBinding, error) {
@@ -765,7 +1860,38 @@ func (h *Handler) preparePorts(ports []PortMapping) ([]dockerutil.PortBinding, e
 	return bindings, nil
 }
 
-// compose health and restart mapping omitted for compatibility; rely on defaults/restart policy from payload
+// composeHealthToDocker converts a compose service's healthcheck block to
+// *container.HealthConfig, mirroring DeployHealth.toDocker()'s defaulting. A
+// nil hc (service declares no healthcheck: block) maps to a nil
+// *container.HealthConfig rather than a default probe, leaving the
+// container's image-baked HEALTHCHECK (if any) in effect. disable: true maps
+// to Docker's {Test: []string{"NONE"}} opt-out, since compose's own
+// semantics require it to override any inherited/image healthcheck.
+func composeHealthToDocker(hc *composetypes.HealthCheckConfig) *container.HealthConfig {
+	if hc == nil {
+		return nil
+	}
+	if hc.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}
+	}
+	interval := 10 * time.Second
+	if hc.Interval != nil {
+		interval = time.Duration(*hc.Interval)
+	}
+	timeout := 5 * time.Second
+	if hc.Timeout != nil {
+		timeout = time.Duration(*hc.Timeout)
+	}
+	var retries int
+	if hc.Retries != nil {
+		retries = int(*hc.Retries)
+	}
+	var startPeriod time.Duration
+	if hc.StartPeriod != nil {
+		startPeriod = time.Duration(*hc.StartPeriod)
+	}
+	return &container.HealthConfig{Test: hc.Test, Interval: interval, Timeout: timeout, Retries: retries, StartPeriod: startPeriod}
+}
 
 func fileExists(path string) bool { info, err := os.Stat(path); return err == nil && !info.IsDir() }
 
@@ -797,6 +1923,20 @@ type deployDescriptor struct {
 	Restart     string            `json:"restart_policy"`
 	Health      *DeployHealth     `json:"health"`
 	Labels      map[string]string `json:"labels"`
+	// Platform overrides auto-selection from a manifest list / OCI index,
+	// e.g. "linux/arm64/v8"; empty means match the agent host's own
+	// runtime.GOOS/GOARCH.
+	Platform string `json:"platform"`
+	// AllowTagDrift permits a deploy to proceed when Image resolves to a
+	// different digest than the one pinned on a previous deploy, instead
+	// of refusing the trust-on-first-use mismatch.
+	AllowTagDrift bool `json:"allow_tag_drift"`
+	// Replicas overrides DeployJobPayload.Replicas for this descriptor; 0
+	// falls back to the payload's value.
+	Replicas int `json:"replicas"`
+	// ImageSigners overrides DeployJobPayload.ImageSigners for this
+	// descriptor; empty falls back to the payload's value.
+	ImageSigners []string `json:"image_signers"`
 }
 
 type DeployHealth struct {
@@ -821,23 +1961,7 @@ func (d *DeployHealth) toDocker() *container.HealthConfig {
 	return &container.HealthConfig{Test: d.Test, Interval: interval * time.Second, Timeout: timeout * time.Second, Retries: d.Retries}
 }
 
-func (h HealthCheckSpec) toDocker() *container.HealthConfig {
-	if h.Type == "" {
-		return nil
-	}
-	switch strings.ToLower(h.Type) {
-	case "cmd", "cmd-shell":
-		return &container.HealthConfig{Test: []string{"CMD-SHELL", h.Endpoint}}
-	default:
-		return nil
-	}
-}
-
-func loadDeployDescriptor(path string) (*deployDescriptor, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
+func parseDeployDescriptor(data []byte) (*deployDescriptor, error) {
 	desc := &deployDescriptor{}
 	if err := json.Unmarshal(data, desc); err != nil {
 		return nil, err
@@ -845,11 +1969,31 @@ func loadDeployDescriptor(path string) (*deployDescriptor, error) {
 	return desc, nil
 }
 
-func (h *Handler) buildImage(ctx context.Context, contextDir, dockerfile, tag string) error {
-	tar, err := dockerutil.CreateBuildContext(contextDir, dockerfile)
-	if err != nil {
-		return err
+func (h *Handler) buildImage(ctx context.Context, jobID, contextDir, dockerfile, tag string, opts dockerutil.BuildOptions) (string, error) {
+	if h.LogPublisher == nil {
+		return h.buildWithFallback(ctx, contextDir, dockerfile, tag, opts, nil)
 	}
-	defer tar.Close()
-	return h.Docker.BuildImage(ctx, tar, dockerfile, tag)
+
+	// Framed the same way handleExec streams a command's output, so the
+	// controller can tell build progress apart from a final status frame
+	// instead of inferring completion only once the reader closes.
+	pr, pw := io.Pipe()
+	mux := newMultiplexWriter(pw)
+	publishErr := make(chan error, 1)
+	go func() {
+		publishErr <- h.LogPublisher.Publish(ctx, jobID, pr, LogStreamDockerMultiplex)
+	}()
+
+	digest, buildErr := h.buildWithFallback(ctx, contextDir, dockerfile, tag, opts, mux.Stdout())
+	status := map[string]interface{}{"digest": digest}
+	if buildErr != nil {
+		status["error"] = buildErr.Error()
+	}
+	statusJSON, _ := json.Marshal(status)
+	_ = mux.WriteStatus(statusJSON)
+	_ = pw.Close()
+	if err := <-publishErr; err != nil && buildErr == nil {
+		h.audit("build.log_publish_failed", map[string]interface{}{"job_id": jobID, "error": err.Error()})
+	}
+	return digest, buildErr
 }
@@ -0,0 +1,401 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deploybot-agent/internal/dockerutil"
+
+	"github.com/docker/docker/api/types/container"
+	"gopkg.in/yaml.v3"
+)
+
+// kube.go materializes a minimal subset of Kubernetes manifests - Pod,
+// Deployment, ConfigMap, Secret - the same way podman's `play kube` does:
+// enough to let a user point the same deployment artefact at a real
+// cluster later, without the agent depending on client-go or apimachinery.
+
+// kubeObjectMeta is the only metadata field this agent cares about.
+type kubeObjectMeta struct {
+	Name string `yaml:"name"`
+}
+
+type kubeKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type kubeEnvVar struct {
+	Name      string `yaml:"name"`
+	Value     string `yaml:"value"`
+	ValueFrom *struct {
+		ConfigMapKeyRef *kubeKeyRef `yaml:"configMapKeyRef"`
+		SecretKeyRef    *kubeKeyRef `yaml:"secretKeyRef"`
+	} `yaml:"valueFrom"`
+}
+
+type kubeEnvFromSource struct {
+	ConfigMapRef *struct {
+		Name string `yaml:"name"`
+	} `yaml:"configMapRef"`
+	SecretRef *struct {
+		Name string `yaml:"name"`
+	} `yaml:"secretRef"`
+}
+
+type kubeVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+}
+
+type kubeVolume struct {
+	Name     string `yaml:"name"`
+	HostPath *struct {
+		Path string `yaml:"path"`
+	} `yaml:"hostPath"`
+}
+
+type kubeContainerPort struct {
+	ContainerPort int    `yaml:"containerPort"`
+	HostPort      int    `yaml:"hostPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type kubeProbe struct {
+	Exec *struct {
+		Command []string `yaml:"command"`
+	} `yaml:"exec"`
+	HTTPGet *struct {
+		Path string `yaml:"path"`
+		Port int    `yaml:"port"`
+	} `yaml:"httpGet"`
+	TCPSocket *struct {
+		Port int `yaml:"port"`
+	} `yaml:"tcpSocket"`
+	PeriodSeconds    int `yaml:"periodSeconds"`
+	TimeoutSeconds   int `yaml:"timeoutSeconds"`
+	FailureThreshold int `yaml:"failureThreshold"`
+}
+
+// toDocker translates a probe into the single HealthConfig Docker supports.
+func (p *kubeProbe) toDocker() *container.HealthConfig {
+	if p == nil {
+		return nil
+	}
+	var test []string
+	switch {
+	case p.Exec != nil && len(p.Exec.Command) > 0:
+		test = append([]string{"CMD"}, p.Exec.Command...)
+	case p.HTTPGet != nil:
+		path := p.HTTPGet.Path
+		if path == "" {
+			path = "/"
+		}
+		test = []string{"CMD-SHELL", fmt.Sprintf("wget -q -O /dev/null http://localhost:%d%s || exit 1", p.HTTPGet.Port, path)}
+	case p.TCPSocket != nil:
+		test = []string{"CMD-SHELL", fmt.Sprintf("(echo > /dev/tcp/127.0.0.1/%d) || exit 1", p.TCPSocket.Port)}
+	default:
+		return nil
+	}
+	interval := time.Duration(p.PeriodSeconds) * time.Second
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	timeout := time.Duration(p.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return &container.HealthConfig{Test: test, Interval: interval, Timeout: timeout, Retries: p.FailureThreshold}
+}
+
+type kubeContainerSpec struct {
+	Name           string              `yaml:"name"`
+	Image          string              `yaml:"image"`
+	Ports          []kubeContainerPort `yaml:"ports"`
+	Env            []kubeEnvVar        `yaml:"env"`
+	EnvFrom        []kubeEnvFromSource `yaml:"envFrom"`
+	VolumeMounts   []kubeVolumeMount   `yaml:"volumeMounts"`
+	LivenessProbe  *kubeProbe          `yaml:"livenessProbe"`
+	ReadinessProbe *kubeProbe          `yaml:"readinessProbe"`
+}
+
+type kubePodSpec struct {
+	Containers []kubeContainerSpec `yaml:"containers"`
+	Volumes    []kubeVolume        `yaml:"volumes"`
+}
+
+// volumeSource resolves a volumeMounts entry against the Pod's hostPath
+// volumes; other volume types (emptyDir, configMap, secret, PVCs) have no
+// single-node-agent equivalent and are left unresolved.
+func (spec kubePodSpec) volumeSource(name string) (string, bool) {
+	for _, v := range spec.Volumes {
+		if v.Name == name && v.HostPath != nil {
+			return v.HostPath.Path, true
+		}
+	}
+	return "", false
+}
+
+type kubePodManifest struct {
+	Metadata kubeObjectMeta `yaml:"metadata"`
+	Spec     kubePodSpec    `yaml:"spec"`
+}
+
+type kubeDeploymentManifest struct {
+	Metadata kubeObjectMeta `yaml:"metadata"`
+	Spec     struct {
+		Template struct {
+			Metadata kubeObjectMeta `yaml:"metadata"`
+			Spec     kubePodSpec    `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type kubeConfigMapManifest struct {
+	Metadata kubeObjectMeta    `yaml:"metadata"`
+	Data     map[string]string `yaml:"data"`
+}
+
+type kubeSecretManifest struct {
+	Metadata   kubeObjectMeta    `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`       // base64-encoded, as in a real Secret
+	StringData map[string]string `yaml:"stringData"` // plain-text convenience field
+}
+
+// kubeBundle is every object decoded from one manifest file, keyed the way
+// envFrom/valueFrom references address them.
+type kubeBundle struct {
+	pods       []kubePodManifest
+	configMaps map[string]map[string]string
+	secrets    map[string]map[string]string
+}
+
+// parseKubeManifest decodes a multi-document YAML file, keeping only the
+// Pod/Deployment/ConfigMap/Secret kinds this agent knows how to run;
+// anything else (Service, Ingress, ...) is ignored since a single agent has
+// no cluster networking layer to honour it with.
+func parseKubeManifest(data []byte) (*kubeBundle, error) {
+	bundle := &kubeBundle{configMaps: map[string]map[string]string{}, secrets: map[string]map[string]string{}}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw map[string]interface{}
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("kube manifest: %w", err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		kind, _ := raw["kind"].(string)
+		docBytes, err := yaml.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("kube manifest: %w", err)
+		}
+		switch strings.ToLower(kind) {
+		case "pod":
+			var pod kubePodManifest
+			if err := yaml.Unmarshal(docBytes, &pod); err != nil {
+				return nil, fmt.Errorf("kube manifest: parsing Pod: %w", err)
+			}
+			bundle.pods = append(bundle.pods, pod)
+		case "deployment":
+			var dep kubeDeploymentManifest
+			if err := yaml.Unmarshal(docBytes, &dep); err != nil {
+				return nil, fmt.Errorf("kube manifest: parsing Deployment: %w", err)
+			}
+			// Treated as ReplicaSet=1 for a single-node agent: materialize
+			// exactly one Pod from the Deployment's template.
+			name := dep.Metadata.Name
+			if name == "" {
+				name = dep.Spec.Template.Metadata.Name
+			}
+			bundle.pods = append(bundle.pods, kubePodManifest{Metadata: kubeObjectMeta{Name: name}, Spec: dep.Spec.Template.Spec})
+		case "configmap":
+			var cm kubeConfigMapManifest
+			if err := yaml.Unmarshal(docBytes, &cm); err != nil {
+				return nil, fmt.Errorf("kube manifest: parsing ConfigMap: %w", err)
+			}
+			bundle.configMaps[cm.Metadata.Name] = cm.Data
+		case "secret":
+			var sec kubeSecretManifest
+			if err := yaml.Unmarshal(docBytes, &sec); err != nil {
+				return nil, fmt.Errorf("kube manifest: parsing Secret: %w", err)
+			}
+			bundle.secrets[sec.Metadata.Name] = decodeKubeSecretData(sec)
+		}
+	}
+	return bundle, nil
+}
+
+func decodeKubeSecretData(sec kubeSecretManifest) map[string]string {
+	out := make(map[string]string, len(sec.Data)+len(sec.StringData))
+	for k, v := range sec.Data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			out[k] = v
+			continue
+		}
+		out[k] = string(decoded)
+	}
+	for k, v := range sec.StringData {
+		out[k] = v
+	}
+	return out
+}
+
+// resolveEnv flattens a container's env/envFrom against the bundle's
+// ConfigMaps and Secrets, failing closed if a reference can't be resolved
+// rather than silently starting the container without it.
+func (b *kubeBundle) resolveEnv(c kubeContainerSpec) (map[string]string, error) {
+	env := map[string]string{}
+	for _, source := range c.EnvFrom {
+		switch {
+		case source.ConfigMapRef != nil:
+			data, ok := b.configMaps[source.ConfigMapRef.Name]
+			if !ok {
+				return nil, fmt.Errorf("envFrom references unknown ConfigMap %q", source.ConfigMapRef.Name)
+			}
+			for k, v := range data {
+				env[k] = v
+			}
+		case source.SecretRef != nil:
+			data, ok := b.secrets[source.SecretRef.Name]
+			if !ok {
+				return nil, fmt.Errorf("envFrom references unknown Secret %q", source.SecretRef.Name)
+			}
+			for k, v := range data {
+				env[k] = v
+			}
+		}
+	}
+	for _, e := range c.Env {
+		switch {
+		case e.ValueFrom == nil:
+			env[e.Name] = e.Value
+		case e.ValueFrom.ConfigMapKeyRef != nil:
+			ref := e.ValueFrom.ConfigMapKeyRef
+			data, ok := b.configMaps[ref.Name]
+			if !ok {
+				return nil, fmt.Errorf("valueFrom references unknown ConfigMap %q", ref.Name)
+			}
+			val, ok := data[ref.Key]
+			if !ok {
+				return nil, fmt.Errorf("ConfigMap %q has no key %q", ref.Name, ref.Key)
+			}
+			env[e.Name] = val
+		case e.ValueFrom.SecretKeyRef != nil:
+			ref := e.ValueFrom.SecretKeyRef
+			data, ok := b.secrets[ref.Name]
+			if !ok {
+				return nil, fmt.Errorf("valueFrom references unknown Secret %q", ref.Name)
+			}
+			val, ok := data[ref.Key]
+			if !ok {
+				return nil, fmt.Errorf("Secret %q has no key %q", ref.Name, ref.Key)
+			}
+			env[e.Name] = val
+		}
+	}
+	return env, nil
+}
+
+// deployKube materializes every container in every Pod/Deployment defined
+// by the manifest, the same way the other deploy* strategies materialize
+// compose services or a deploy.json descriptor.
+func (h *Handler) deployKube(ctx context.Context, workdir string, payload DeployJobPayload, selection strategySelection) (interface{}, error) {
+	path := filepath.Join(workdir, selection.manifest)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading kube manifest: %w", err)
+	}
+	bundle, err := parseKubeManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.pods) == 0 {
+		return nil, fmt.Errorf("kube manifest %s defines no Pod or Deployment", selection.manifest)
+	}
+
+	results := map[string]string{}
+	for _, pod := range bundle.pods {
+		podName := pod.Metadata.Name
+		if podName == "" {
+			podName = payload.Name
+		}
+		for _, c := range pod.Spec.Containers {
+			if c.Image == "" {
+				return nil, fmt.Errorf("container %s/%s missing image", podName, c.Name)
+			}
+			if err := h.enforceImagePolicy(ctx, c.Image); err != nil {
+				return nil, err
+			}
+			env, err := bundle.resolveEnv(c)
+			if err != nil {
+				return nil, err
+			}
+			ports := make([]dockerutil.PortBinding, 0, len(c.Ports))
+			for _, p := range c.Ports {
+				if p.ContainerPort == 0 {
+					continue
+				}
+				published := p.HostPort
+				if published == 0 {
+					key := fmt.Sprintf("%s/%s:%d", podName, c.Name, p.ContainerPort)
+					published, err = h.State.ReservePort(key, 0)
+					if err != nil {
+						return nil, err
+					}
+				}
+				ports = append(ports, dockerutil.PortBinding{ContainerPort: p.ContainerPort, HostPort: published, Protocol: p.Protocol})
+			}
+			volumes := make([]dockerutil.VolumeBinding, 0, len(c.VolumeMounts))
+			for _, vm := range c.VolumeMounts {
+				hostPath, ok := pod.Spec.volumeSource(vm.Name)
+				if !ok {
+					return nil, fmt.Errorf("container %s/%s references unresolvable volume %q", podName, c.Name, vm.Name)
+				}
+				sourceClean := filepath.Clean(hostPath)
+				if err := h.validateVolumeSource(sourceClean); err != nil {
+					return nil, err
+				}
+				volumes = append(volumes, dockerutil.VolumeBinding{Source: sourceClean, Target: vm.MountPath})
+			}
+			containerName := fmt.Sprintf("%s-%s", podName, c.Name)
+			recordKey := fmt.Sprintf("%s/%s", payload.Name, containerName)
+			labels := dockerutil.WithAgentLabels(map[string]string{
+				"deploybot.job":       payload.Name,
+				"deploybot.pod":       podName,
+				"deploybot.container": c.Name,
+			})
+			// Docker has one HealthConfig; readinessProbe - "ready for
+			// traffic" - maps most closely to what WaitHealthy gates on, so
+			// it takes priority over livenessProbe when both are set.
+			health := c.ReadinessProbe.toDocker()
+			if health == nil {
+				health = c.LivenessProbe.toDocker()
+			}
+			restart := payload.RestartPolicy
+			if restart == "" {
+				restart = "unless-stopped"
+			}
+			req := deployRequest{ContainerName: containerName, Image: c.Image, Environment: env, Ports: ports, Volumes: volumes, Labels: labels, Health: health, Restart: restart, Signatures: payload.ImageSignatures}
+			res, err := h.deployContainerWithRollback(ctx, recordKey, req, "", rolloutFromPayload(payload))
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := res.(map[string]string); ok {
+				results[containerName] = m["container_id"]
+			}
+		}
+	}
+	return results, nil
+}
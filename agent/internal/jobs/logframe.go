@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// Frame stream identifiers for multiplexWriter, matching the header
+// demuxDocker already parses (1=stdout, 2=stderr); anything else, including
+// 3 here, falls through to its "status" case.
+const (
+	frameStreamStdout = 1
+	frameStreamStderr = 2
+	frameStreamStatus = 3
+)
+
+// multiplexWriter frames writes to a single underlying io.Writer using
+// Docker's stdcopy convention - an 8-byte header ([stream(1)|0 0 0|size(4
+// BE)]) followed by the payload - so a command's separate stdout/stderr
+// pipes, which have no such framing of their own, can be shipped over one
+// LogPublisher reader as LogStreamDockerMultiplex and demultiplexed on the
+// other end the same way Docker attach/exec output is. WriteStatus uses the
+// same framing to carry a final, out-of-band status payload (such as an
+// exit code or build digest) once the command's output streams are done.
+type multiplexWriter struct {
+	mu  sync.Mutex
+	dst io.Writer
+}
+
+func newMultiplexWriter(dst io.Writer) *multiplexWriter {
+	return &multiplexWriter{dst: dst}
+}
+
+func (m *multiplexWriter) frame(stream byte, p []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:8], uint32(len(p)))
+	if _, err := m.dst.Write(header); err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	_, err := m.dst.Write(p)
+	return err
+}
+
+// Stdout returns a writer that frames every write as a stdout frame.
+func (m *multiplexWriter) Stdout() io.Writer { return multiplexStream{m, frameStreamStdout} }
+
+// Stderr returns a writer that frames every write as a stderr frame.
+func (m *multiplexWriter) Stderr() io.Writer { return multiplexStream{m, frameStreamStderr} }
+
+// WriteStatus frames payload as a status frame.
+func (m *multiplexWriter) WriteStatus(payload []byte) error {
+	return m.frame(frameStreamStatus, payload)
+}
+
+type multiplexStream struct {
+	m      *multiplexWriter
+	stream byte
+}
+
+func (s multiplexStream) Write(p []byte) (int, error) {
+	if err := s.m.frame(s.stream, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,428 @@
+// Package pool dispatches jobs.Job values to a bounded set of workers,
+// serializing jobs that target the same deployment so two deploys against
+// one service never race while unrelated jobs keep running concurrently.
+// Config.MaxPerType can additionally cap how many jobs of a given type run
+// at once, independent of the global worker count, so a handful of slow
+// JobBuild jobs can't starve workers away from cheap JobStats/JobLogs jobs.
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"deploybot-agent/internal/jobs"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultDrainTimeout = 30 * time.Second
+	backoffBase         = 500 * time.Millisecond
+	backoffMax          = 30 * time.Second
+)
+
+// HandleFunc executes a single job, matching jobs.Handler.Handle's signature.
+type HandleFunc func(ctx context.Context, job *jobs.Job) (interface{}, error)
+
+// Config tunes the pool's concurrency and retry behaviour.
+type Config struct {
+	// Workers is the number of jobs that may run at once. Defaults to 4.
+	Workers int
+	// RetryLimit caps how many times a transient failure is retried
+	// before the job is resolved as failed.
+	RetryLimit int
+	// DrainTimeout bounds how long Drain waits for in-flight jobs to
+	// finish naturally before giving up on them. Defaults to 30s.
+	DrainTimeout time.Duration
+	// MaxPerType caps how many jobs of a given type may be admitted (queued
+	// in the worker channel or running) at once, on top of the global
+	// Workers limit - e.g. capping JobBuild at 1 so a slow image build
+	// can't starve workers away from cheap JobStats/JobLogs jobs. A type
+	// absent from the map, or mapped to <=0, is unbounded (limited only by
+	// Workers).
+	MaxPerType map[jobs.JobType]int
+}
+
+// Result is delivered to a job's onComplete callback exactly once.
+// Unclaimed is set instead of Err when the pool drained before the job
+// ever got a worker, so the caller can ack it back to the controller as
+// AckUnclaimed rather than AckFailed.
+type Result struct {
+	Job       *jobs.Job
+	Output    interface{}
+	Err       error
+	Unclaimed bool
+	// QueuedFor is how long the job waited between Submit and a worker
+	// actually starting it - behind a busy serialKey, a full MaxPerType
+	// cap, or simply a full worker pool. Zero for a job that never got a
+	// worker (Unclaimed).
+	QueuedFor time.Duration
+}
+
+// Counters is a point-in-time queue-depth snapshot for metrics/status
+// reporting, keyed by job type.
+type Counters struct {
+	Running  map[jobs.JobType]int
+	Queued   map[jobs.JobType]int
+	Retrying map[jobs.JobType]int
+}
+
+type submission struct {
+	ctx         context.Context
+	job         *jobs.Job
+	serialKey   string
+	onComplete  func(Result)
+	attempt     int
+	submittedAt time.Time
+}
+
+// Pool runs jobs on a fixed worker count, fairly serializing submissions
+// that share a non-empty serialKey (derived from DeployJobPayload.Name for
+// deploy jobs; every other job type is unconstrained).
+type Pool struct {
+	handle HandleFunc
+	cfg    Config
+	queue  chan *submission
+
+	mu          sync.Mutex
+	activeKeys  map[string]bool
+	pending     map[string][]*submission
+	typeCap     map[jobs.JobType]int
+	typeActive  map[jobs.JobType]int
+	typeWaiting map[jobs.JobType][]*submission
+	running     map[jobs.JobType]int
+	queued      map[jobs.JobType]int
+	retrying    map[jobs.JobType]int
+	draining    bool
+
+	inflight sync.WaitGroup
+}
+
+// New starts cfg.Workers (default 4) goroutines pulling from an internal
+// queue and dispatching to handle.
+func New(cfg Config, handle HandleFunc) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = defaultDrainTimeout
+	}
+	p := &Pool{
+		handle:      handle,
+		cfg:         cfg,
+		queue:       make(chan *submission, 256),
+		activeKeys:  map[string]bool{},
+		pending:     map[string][]*submission{},
+		typeCap:     cfg.MaxPerType,
+		typeActive:  map[jobs.JobType]int{},
+		typeWaiting: map[jobs.JobType][]*submission{},
+		running:     map[jobs.JobType]int{},
+		queued:      map[jobs.JobType]int{},
+		retrying:    map[jobs.JobType]int{},
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Submit enqueues job for execution, invoking onComplete exactly once with
+// its outcome. Two JobDeploy jobs for the same DeployJobPayload.Name
+// serialize against each other; everything else runs as soon as a worker
+// is free.
+func (p *Pool) Submit(ctx context.Context, job *jobs.Job, onComplete func(Result)) {
+	key := serialKeyFor(job)
+	sub := &submission{ctx: ctx, job: job, serialKey: key, onComplete: onComplete, submittedAt: time.Now()}
+
+	p.mu.Lock()
+	if p.draining {
+		p.mu.Unlock()
+		onComplete(Result{Job: job, Unclaimed: true})
+		return
+	}
+	p.inflight.Add(1)
+	p.queued[job.Type]++
+	keyFree := key == "" || !p.activeKeys[key]
+	if !keyFree {
+		p.pending[key] = append(p.pending[key], sub)
+		p.mu.Unlock()
+		return
+	}
+	if key != "" {
+		p.activeKeys[key] = true
+	}
+	admit := p.admitTypeLocked(sub)
+	p.mu.Unlock()
+
+	if admit {
+		p.enqueue(sub)
+	}
+}
+
+// Counters returns a snapshot of running/queued/retrying job counts by type.
+func (p *Pool) Counters() Counters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := Counters{Running: map[jobs.JobType]int{}, Queued: map[jobs.JobType]int{}, Retrying: map[jobs.JobType]int{}}
+	for jt, n := range p.running {
+		if n > 0 {
+			out.Running[jt] = n
+		}
+	}
+	for jt, n := range p.queued {
+		if n > 0 {
+			out.Queued[jt] = n
+		}
+	}
+	for jt, n := range p.retrying {
+		if n > 0 {
+			out.Retrying[jt] = n
+		}
+	}
+	return out
+}
+
+// Drain stops accepting new work (Submit immediately resolves as
+// Unclaimed), resolves every job still waiting behind a busy serialKey or a
+// full MaxPerType cap as Unclaimed since it never got a chance to start,
+// and waits up to cfg.DrainTimeout for jobs already running to finish
+// naturally. It returns the IDs of the jobs it resolved as Unclaimed,
+// followed, if the deadline hit first, by one "<still-running:TYPE>" entry
+// per job still running. Running jobs are counted per type rather than
+// tracked by ID, so their IDs are not reported, and Drain does not resolve
+// them: each still calls its onComplete if and when it finishes.
+func (p *Pool) Drain() []string {
+	p.mu.Lock()
+	p.draining = true
+	var unclaimed []string
+	for key, subs := range p.pending {
+		for _, sub := range subs {
+			unclaimed = append(unclaimed, sub.job.ID)
+			decLocked(p.queued, sub.job.Type)
+			go p.resolve(sub, Result{Job: sub.job, Unclaimed: true})
+		}
+		delete(p.pending, key)
+	}
+	for jt, subs := range p.typeWaiting {
+		for _, sub := range subs {
+			unclaimed = append(unclaimed, sub.job.ID)
+			decLocked(p.queued, sub.job.Type)
+			go p.resolve(sub, Result{Job: sub.job, Unclaimed: true})
+		}
+		delete(p.typeWaiting, jt)
+	}
+	stillRunning := make([]string, 0, len(p.running))
+	p.mu.Unlock()
+
+	doneCh := make(chan struct{})
+	go func() { p.inflight.Wait(); close(doneCh) }()
+
+	select {
+	case <-doneCh:
+		return unclaimed
+	case <-time.After(p.cfg.DrainTimeout):
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for jt, n := range p.running {
+			for i := 0; i < n; i++ {
+				stillRunning = append(stillRunning, fmt.Sprintf("<still-running:%s>", jt))
+			}
+		}
+		return append(unclaimed, stillRunning...)
+	}
+}
+
+func (p *Pool) worker() {
+	for sub := range p.queue {
+		p.run(sub)
+	}
+}
+
+func (p *Pool) run(sub *submission) {
+	jt := sub.job.Type
+	waited := time.Since(sub.submittedAt)
+	p.mu.Lock()
+	decLocked(p.queued, jt)
+	p.running[jt]++
+	p.mu.Unlock()
+
+	var out interface{}
+	var err error
+	for {
+		out, err = p.handle(sub.ctx, sub.job)
+		if err == nil || sub.ctx.Err() != nil || !transient(err) || sub.attempt >= p.cfg.RetryLimit {
+			break
+		}
+		sub.attempt++
+		p.mu.Lock()
+		p.retrying[jt]++
+		p.mu.Unlock()
+		select {
+		case <-time.After(backoffDuration(sub.attempt)):
+		case <-sub.ctx.Done():
+		}
+		p.mu.Lock()
+		decLocked(p.retrying, jt)
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	p.running[jt]--
+	p.typeActive[jt]--
+	next := p.releaseKeyLocked(sub.serialKey)
+	typeNext := p.releaseTypeLocked(jt)
+	p.mu.Unlock()
+	if next != nil {
+		p.admitAndEnqueue(next)
+	}
+	if typeNext != nil {
+		p.enqueue(typeNext)
+	}
+
+	p.resolve(sub, Result{Job: sub.job, Output: out, Err: err, QueuedFor: waited})
+}
+
+// resolve invokes onComplete and marks the submission as finished for
+// Drain's wait group. Called both from the normal run() path and from
+// Drain for pending jobs it short-circuits.
+func (p *Pool) resolve(sub *submission, res Result) {
+	sub.onComplete(res)
+	p.inflight.Done()
+}
+
+func (p *Pool) releaseKeyLocked(key string) *submission {
+	if key == "" {
+		return nil
+	}
+	waiting, ok := p.pending[key]
+	if !ok || len(waiting) == 0 {
+		delete(p.activeKeys, key)
+		return nil
+	}
+	next := waiting[0]
+	if len(waiting) == 1 {
+		delete(p.pending, key)
+	} else {
+		p.pending[key] = waiting[1:]
+	}
+	return next
+}
+
+// admitTypeLocked checks sub's job type against Config.MaxPerType. If a slot
+// is available it reserves one (counted until the job finishes running) and
+// returns true; otherwise it parks sub on typeWaiting for releaseTypeLocked
+// to pick up once a slot frees, and returns false. Callers must hold p.mu
+// and must only call this once sub's serialKey (if any) is already clear.
+func (p *Pool) admitTypeLocked(sub *submission) bool {
+	jt := sub.job.Type
+	if limit := p.typeCap[jt]; limit > 0 && p.typeActive[jt] >= limit {
+		p.typeWaiting[jt] = append(p.typeWaiting[jt], sub)
+		return false
+	}
+	p.typeActive[jt]++
+	return true
+}
+
+// releaseTypeLocked hands jt's just-freed slot to the next submission
+// waiting purely on type capacity, if any, reserving the slot for it.
+// Called with p.mu held from run() after it has already decremented
+// typeActive[jt] for the job that just finished.
+func (p *Pool) releaseTypeLocked(jt jobs.JobType) *submission {
+	waiting := p.typeWaiting[jt]
+	if len(waiting) == 0 {
+		return nil
+	}
+	next := waiting[0]
+	if len(waiting) == 1 {
+		delete(p.typeWaiting, jt)
+	} else {
+		p.typeWaiting[jt] = waiting[1:]
+	}
+	p.typeActive[jt]++
+	return next
+}
+
+// admitAndEnqueue re-runs the type-capacity check for a submission that just
+// cleared its serialKey (releaseKeyLocked's next) and never went through
+// admitTypeLocked in Submit, enqueueing it if a slot is free or parking it on
+// typeWaiting otherwise.
+func (p *Pool) admitAndEnqueue(sub *submission) {
+	p.mu.Lock()
+	admit := p.admitTypeLocked(sub)
+	p.mu.Unlock()
+	if admit {
+		p.enqueue(sub)
+	}
+}
+
+// enqueue hands sub to a worker, falling back to a goroutine-backed send
+// if the buffered channel is momentarily full so Submit/run never block on it.
+func (p *Pool) enqueue(sub *submission) {
+	select {
+	case p.queue <- sub:
+	default:
+		go func() { p.queue <- sub }()
+	}
+}
+
+func decLocked(m map[jobs.JobType]int, jt jobs.JobType) {
+	if m[jt] <= 1 {
+		delete(m, jt)
+	} else {
+		m[jt]--
+	}
+}
+
+// serialKeyFor returns the fairness key a job must serialize behind - only
+// deploy jobs targeting the same DeployJobPayload.Name are constrained;
+// every other job type (and a deploy job whose payload fails to parse)
+// runs unconstrained.
+func serialKeyFor(job *jobs.Job) string {
+	if job.Type != jobs.JobDeploy {
+		return ""
+	}
+	var payload jobs.DeployJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.Name == "" {
+		return ""
+	}
+	return "deploy:" + payload.Name
+}
+
+// transient is a best-effort heuristic for "retrying this might succeed" -
+// timeouts and common Docker-daemon/controller connectivity errors - as
+// opposed to a permanent failure (bad payload, policy rejection) that
+// retrying would just reproduce.
+func transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var temp interface{ Temporary() bool }
+	if errors.As(err, &temp) {
+		return temp.Temporary()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	msg := err.Error()
+	for _, needle := range []string{"connection refused", "connection reset", "i/o timeout", "EOF", "context deadline exceeded", "no such host"} {
+		if strings.Contains(msg, needle) {
+			return true
+		}
+	}
+	return false
+}
+
+func backoffDuration(attempt int) time.Duration {
+	if attempt > 10 {
+		return backoffMax
+	}
+	d := backoffBase * time.Duration(uint(1)<<uint(attempt))
+	if d > backoffMax {
+		return backoffMax
+	}
+	return d
+}
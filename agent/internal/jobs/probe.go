@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	defaultProbePeriod  = 10 * time.Second
+	defaultProbeTimeout = 5 * time.Second
+)
+
+// toDocker compiles a ProbeSpec into the single HealthConfig Docker
+// supports, generating a CMD-SHELL wrapper for http/tcp probes the same way
+// kubeProbe.toDocker does for kube manifests. InitialDelaySeconds becomes
+// StartPeriod so WaitHealthy can honor it by reading it back off the
+// container's own configured healthcheck.
+func (p ProbeSpec) toDocker() *container.HealthConfig {
+	var test []string
+	switch {
+	case p.Exec != nil && len(p.Exec.Command) > 0:
+		test = append([]string{"CMD"}, p.Exec.Command...)
+	case p.HTTP != nil && p.HTTP.Port > 0:
+		test = []string{"CMD-SHELL", p.HTTP.shellCommand()}
+	case p.TCP != nil && p.TCP.Port > 0:
+		test = []string{"CMD-SHELL", fmt.Sprintf("(echo > /dev/tcp/127.0.0.1/%d) || exit 1", p.TCP.Port)}
+	default:
+		return nil
+	}
+
+	interval := time.Duration(p.PeriodSeconds) * time.Second
+	if interval == 0 {
+		interval = defaultProbePeriod
+	}
+	timeout := time.Duration(p.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	return &container.HealthConfig{
+		Test:        test,
+		Interval:    interval,
+		Timeout:     timeout,
+		Retries:     p.FailureThreshold,
+		StartPeriod: time.Duration(p.InitialDelaySeconds) * time.Second,
+	}
+}
+
+// shellCommand builds a CMD-SHELL probe that issues the HTTP request with
+// wget (already relied on elsewhere for kube httpGet probes) and checks the
+// response status falls within [ExpectedStatusMin, ExpectedStatusMax].
+func (p *HTTPProbe) shellCommand() string {
+	method := strings.ToUpper(p.Method)
+	if method == "" {
+		method = "GET"
+	}
+	path := p.Path
+	if path == "" {
+		path = "/"
+	}
+	min := p.ExpectedStatusMin
+	if min == 0 {
+		min = 200
+	}
+	max := p.ExpectedStatusMax
+	if max == 0 {
+		max = 299
+	}
+	scheme := strings.ToLower(p.Scheme)
+	if scheme == "" {
+		scheme = "http"
+	}
+	var headerFlags strings.Builder
+	for k, v := range p.Headers {
+		fmt.Fprintf(&headerFlags, " --header=%s", shellQuote(fmt.Sprintf("%s: %s", k, v)))
+	}
+	if scheme == "https" {
+		headerFlags.WriteString(" --no-check-certificate")
+	}
+	url := fmt.Sprintf("%s://127.0.0.1:%d%s", scheme, p.Port, path)
+	return fmt.Sprintf(
+		`code=$(wget -q -S --method=%s%s -O /dev/null %s 2>&1 | awk '/^ +HTTP\// {print $2}' | tail -1); [ -n "$code" ] && [ "$code" -ge %d ] && [ "$code" -le %d ]`,
+		method, headerFlags.String(), shellQuote(url), min, max,
+	)
+}
+
+// shellQuote wraps s in single quotes for safe use inside a CMD-SHELL
+// probe, escaping any embedded single quote POSIX-style.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// containerStatsSample is the simplified per-interval usage this agent
+// forwards to the controller, in place of the much larger raw Docker stats
+// payload (which also isn't directly comparable across containers without
+// the cpuPercent normalization below).
+type containerStatsSample struct {
+	Time            time.Time `json:"time"`
+	CPUPercent      float64   `json:"cpu_percent"`
+	MemUsageBytes   uint64    `json:"mem_usage_bytes"`
+	MemLimitBytes   uint64    `json:"mem_limit_bytes"`
+	NetRxBytes      uint64    `json:"net_rx_bytes"`
+	NetTxBytes      uint64    `json:"net_tx_bytes"`
+	BlockReadBytes  uint64    `json:"block_read_bytes"`
+	BlockWriteBytes uint64    `json:"block_write_bytes"`
+}
+
+// handleStats streams a container's resource usage back to the controller
+// as JSON lines, the same LogPublisher-based pattern handleLogs uses for
+// container logs, bounded by a follow window instead of running forever.
+func (h *Handler) handleStats(ctx context.Context, job *Job) (interface{}, error) {
+	if h.LogPublisher == nil {
+		return nil, errors.New("log publisher not configured")
+	}
+	var payload StatsJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, err
+	}
+	followDuration := time.Duration(payload.FollowMins)
+	if followDuration <= 0 {
+		followDuration = h.Cfg.LogsFollowDuration
+	} else {
+		followDuration *= time.Minute
+	}
+	ctxStats, cancel := context.WithTimeout(ctx, followDuration)
+	defer cancel()
+
+	reader, err := h.Docker.Stats(ctxStats, payload.Container, true)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	pr, pw := io.Pipe()
+	publishErr := make(chan error, 1)
+	go func() {
+		publishErr <- h.LogPublisher.Publish(ctxStats, job.ID, pr, LogStreamLines)
+	}()
+
+	transformErr := transformContainerStats(reader, pw)
+	_ = pw.Close()
+	if err := <-publishErr; err != nil && transformErr == nil {
+		return nil, err
+	}
+	if transformErr != nil {
+		return nil, transformErr
+	}
+	return map[string]any{"followed_minutes": followDuration.Minutes()}, nil
+}
+
+// transformContainerStats reads Docker's newline-delimited raw stats
+// samples from r and writes one simplified containerStatsSample JSON line
+// per sample to w, until r is exhausted (the follow window elapsing closes
+// the underlying connection, which ends the scan).
+func transformContainerStats(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var raw types.StatsJSON
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			continue
+		}
+		sample := containerStatsSample{
+			Time:            raw.Read,
+			CPUPercent:      cpuPercent(raw),
+			MemUsageBytes:   raw.MemoryStats.Usage,
+			MemLimitBytes:   raw.MemoryStats.Limit,
+			NetRxBytes:      sumNetworkStat(raw.Networks, func(n types.NetworkStats) uint64 { return n.RxBytes }),
+			NetTxBytes:      sumNetworkStat(raw.Networks, func(n types.NetworkStats) uint64 { return n.TxBytes }),
+			BlockReadBytes:  sumBlkioStat(raw.BlkioStats.IoServiceBytesRecursive, "Read"),
+			BlockWriteBytes: sumBlkioStat(raw.BlkioStats.IoServiceBytesRecursive, "Write"),
+		}
+		data, err := json.Marshal(sample)
+		if err != nil {
+			continue
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// cpuPercent is Docker's own normalization: delta cpu usage over delta
+// system usage, scaled by the number of online CPUs, matching what `docker
+// stats` itself reports.
+func cpuPercent(raw types.StatsJSON) float64 {
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	onlineCPUs := float64(raw.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if onlineCPUs == 0 {
+		onlineCPUs = 1
+	}
+	return (cpuDelta / systemDelta) * onlineCPUs * 100.0
+}
+
+func sumNetworkStat(networks map[string]types.NetworkStats, field func(types.NetworkStats) uint64) uint64 {
+	var total uint64
+	for _, n := range networks {
+		total += field(n)
+	}
+	return total
+}
+
+func sumBlkioStat(entries []types.BlkioStatEntry, op string) uint64 {
+	var total uint64
+	for _, e := range entries {
+		if strings.EqualFold(e.Op, op) {
+			total += e.Value
+		}
+	}
+	return total
+}
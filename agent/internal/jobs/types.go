@@ -0,0 +1,258 @@
+package jobs
+
+import "encoding/json"
+
+// JobType enumerates supported job kinds.
+type JobType string
+
+const (
+	JobDeploy   JobType = "deploy"
+	JobRestart  JobType = "restart"
+	JobStop     JobType = "stop"
+	JobRemove   JobType = "remove"
+	JobLogs     JobType = "logs"
+	JobExec     JobType = "exec"
+	JobQueryEnv JobType = "query_env"
+	JobStats    JobType = "stats"
+	JobCopy     JobType = "copy"
+	JobBuild    JobType = "build"
+	JobVerify   JobType = "verify"
+	JobRollback JobType = "rollback"
+)
+
+// Job describes a unit of work assigned by the controller.
+type Job struct {
+	ID      string          `json:"id"`
+	Type    JobType         `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// DeployJobPayload is the structure for deploy jobs.
+type DeployJobPayload struct {
+	Name                string              `json:"name"`
+	RepositoryURL       string              `json:"repository_url"`
+	Ref                 string              `json:"ref"`
+	Strategy            string              `json:"strategy"`
+	Environment         map[string]string   `json:"environment"`
+	Volumes             []VolumeMapping     `json:"volumes"`
+	Ports               []PortMapping       `json:"ports"`
+	ComposeFile         string              `json:"compose_file"`
+	ComposeProject      string              `json:"compose_project"`
+	Dockerfile          string              `json:"dockerfile"`
+	KubeManifest        string              `json:"kube_manifest"`
+	Image               string              `json:"image"`
+	ImageDigest         string              `json:"image_digest"`
+	ImageSignatures     []string            `json:"image_signatures"`
+	// ImageSigners, if set, overrides TrustedSignerKeys for this deploy's
+	// ImageSignatures check: a list of PEM-encoded public keys sent inline
+	// by the controller (not paths, since the agent has no reason to have
+	// a per-deploy key file sitting on its own filesystem), parsed with
+	// imagepolicy.ParseTrustedKeys instead of LoadTrustedKeys.
+	ImageSigners []string `json:"image_signers"`
+	HealthCheck         ProbeSpec           `json:"health_check"`
+	RestartPolicy       string              `json:"restart_policy"`
+	LogsTailLines       int                 `json:"logs_tail_lines"`
+	LogsFollowMins      int                 `json:"logs_follow_minutes"`
+	CommitSHA           string              `json:"commit_sha"`
+	BuildTarget         string              `json:"build_target"`
+	BuildArgs           map[string]string   `json:"build_args"`
+	BuildCacheFrom      []string            `json:"build_cache_from"`
+	BuildPlatform       string              `json:"build_platform"`
+	// Builder selects the build backend for strategyDockerfile: "" or
+	// "classic" (default) uses the daemon's ImageBuild API; "buildkit"
+	// dials config.BuildKitAddr for cache export, multi-platform manifest
+	// lists, build secrets and SBOM/provenance, falling back to classic if
+	// no buildkitd is reachable there.
+	Builder string `json:"builder"`
+	// BuildCacheTo exports the build cache to these registry or local-dir
+	// refs (the buildkit builder's mirror of BuildCacheFrom).
+	BuildCacheTo []string `json:"build_cache_to"`
+	// BuildPlatforms, when set with the buildkit builder, produces a
+	// single manifest list spanning all of them rather than one image for
+	// BuildPlatform; deployDockerfile then resolves the manifest matching
+	// the agent host's own platform via Docker.ResolvePlatformDigest.
+	BuildPlatforms []string `json:"build_platforms"`
+	// BuildSecrets mounts build secrets for RUN --mount=type=secret
+	// instructions, only honored by the buildkit builder; each value is
+	// read from the agent host's own environment (see BuildSecretRef).
+	BuildSecrets []BuildSecretMapping `json:"build_secrets"`
+	// BuildSBOM and BuildProvenance attach the corresponding buildx-style
+	// attestations to the resulting image, only honored by the buildkit
+	// builder.
+	BuildSBOM       bool `json:"build_sbom"`
+	BuildProvenance bool `json:"build_provenance"`
+	RequireSignedCommit bool                `json:"require_signed_commit"`
+	TrustedSigners      TrustedSignerBundle `json:"trusted_signers"`
+	DeploymentMode      string              `json:"deployment_mode"`
+	CanaryReplicas      int                 `json:"canary_replicas"`
+	CanaryBakeSeconds   int                 `json:"canary_bake_seconds"`
+	// Replicas, if greater than 1, deploys that many copies of the
+	// container side by side, named "<name>-1".."<name>-N" like a
+	// Kubernetes ReplicationController stamping out pods from a template.
+	// <=1 (the default) deploys a single container named "<name>", as
+	// before. Has no effect when DeploymentMode is "canary", which ramps
+	// its own replica count via CanaryReplicas instead.
+	Replicas int `json:"replicas"`
+}
+
+// TrustedSignerBundle carries the commit-signature trust material for a
+// single repository, as handed down by the controller per deploy job.
+type TrustedSignerBundle struct {
+	ArmoredKeyring []byte   `json:"armored_keyring,omitempty"`
+	AllowedSigners []string `json:"allowed_signers,omitempty"`
+}
+
+// ProbeSpec describes a readiness check in the Kubernetes/Podman
+// exec/http/tcp vocabulary, compiled down into Docker's single
+// HealthConfig by toDocker. Exactly one of Exec, HTTP, or TCP should be
+// set; if more than one is, Exec wins, then HTTP, then TCP.
+type ProbeSpec struct {
+	Exec                *ExecProbe `json:"exec,omitempty"`
+	HTTP                *HTTPProbe `json:"http,omitempty"`
+	TCP                 *TCPProbe  `json:"tcp,omitempty"`
+	InitialDelaySeconds int        `json:"initial_delay_seconds"`
+	PeriodSeconds       int        `json:"period_seconds"`
+	TimeoutSeconds      int        `json:"timeout_seconds"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	SuccessThreshold    int        `json:"success_threshold"`
+}
+
+// ExecProbe runs command inside the container; a zero exit code is healthy.
+type ExecProbe struct {
+	Command []string `json:"command"`
+}
+
+// HTTPProbe issues an HTTP request against the container's own loopback
+// address and considers the response healthy if its status falls in
+// [ExpectedStatusMin, ExpectedStatusMax] (default 200-299). Scheme
+// defaults to "http"; set it to "https" to probe a TLS listener (the
+// generated check skips certificate verification, since containers doing
+// their own TLS termination typically use a self-signed or internal CA
+// certificate the agent has no way to trust).
+type HTTPProbe struct {
+	Scheme            string            `json:"scheme"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path"`
+	Port              int               `json:"port"`
+	Headers           map[string]string `json:"headers"`
+	ExpectedStatusMin int               `json:"expected_status_min"`
+	ExpectedStatusMax int               `json:"expected_status_max"`
+}
+
+// TCPProbe considers the container healthy if Port accepts a connection.
+type TCPProbe struct {
+	Port int `json:"port"`
+}
+
+// VolumeMapping maps a host path to a container path.
+type VolumeMapping struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// PortMapping allows explicit or automatic port assignments.
+type PortMapping struct {
+	Key       string `json:"key"`
+	Target    int    `json:"target"`
+	Published string `json:"published"`
+	Protocol  string `json:"protocol"`
+}
+
+// ContainerJobPayload describes container selection actions.
+type ContainerJobPayload struct {
+	Name      string `json:"name"`
+	Container string `json:"container"`
+}
+
+// LogsJobPayload carries log streaming parameters.
+type LogsJobPayload struct {
+	Name       string `json:"name"`
+	Container  string `json:"container"`
+	Tail       int    `json:"tail"`
+	FollowMins int    `json:"follow_minutes"`
+}
+
+// StatsJobPayload requests a streamed resource-usage feed for a container,
+// mirroring LogsJobPayload minus Tail since stats have no backlog to replay.
+type StatsJobPayload struct {
+	Name       string `json:"name"`
+	Container  string `json:"container"`
+	FollowMins int    `json:"follow_minutes"`
+}
+
+// CopyJobPayload requests a file or directory copy between the host running
+// the agent and a container, Direction being either "to_container" or
+// "from_container".
+type CopyJobPayload struct {
+	Container   string `json:"container"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Direction   string `json:"direction"`
+}
+
+// BuildJobPayload requests a standalone image build, optionally pushed to a
+// registry, decoupled from deploying it anywhere - a CI-style "build once,
+// deploy the resulting digest to many agents" flow that the deploy-job
+// strategies (which build and deploy in one step) don't cover.
+type BuildJobPayload struct {
+	RepositoryURL string            `json:"repository_url"`
+	Ref           string            `json:"ref"`
+	Dockerfile    string            `json:"dockerfile"`
+	Context       string            `json:"context"`
+	Tag           string            `json:"tag"`
+	PushTo        string            `json:"push_to"`
+	Target        string            `json:"build_target"`
+	BuildArgs     map[string]string `json:"build_args"`
+	CacheFrom     []string          `json:"build_cache_from"`
+	Platform      string            `json:"build_platform"`
+	// Builder, CacheTo, Platforms, Secrets, SBOM and Provenance mirror
+	// DeployJobPayload's identically-named Build* fields (see there for
+	// doc comments); standalone build jobs support the same buildkit path
+	// as strategyDockerfile deploys.
+	Builder    string               `json:"builder"`
+	CacheTo    []string             `json:"build_cache_to"`
+	Platforms  []string             `json:"build_platforms"`
+	Secrets    []BuildSecretMapping `json:"build_secrets"`
+	SBOM       bool                 `json:"build_sbom"`
+	Provenance bool                 `json:"build_provenance"`
+}
+
+// BuildSecretMapping names one build secret a buildkit-backed build mounts
+// into RUN --mount=type=secret,id=ID instructions, with its value read
+// from the agent host's own EnvVar (see dockerutil.BuildSecretRef) rather
+// than a dedicated secret-store subsystem, which this repo doesn't have
+// yet.
+type BuildSecretMapping struct {
+	ID     string `json:"id"`
+	EnvVar string `json:"env_var"`
+}
+
+// ExecJobPayload describes command execution requests on the host.
+type ExecJobPayload struct {
+	Command        []string          `json:"command"`
+	Environment    map[string]string `json:"environment"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+	WorkingDir     string            `json:"working_dir"`
+}
+
+// EnvQueryPayload requests specific environment variables from the agent host.
+type EnvQueryPayload struct {
+	Keys []string `json:"keys"`
+}
+
+// VerifyJobPayload requests a digest-drift report ("henchmen verify") across
+// tracked deployments; an empty Names means check everything this agent
+// has recorded a deployment for.
+type VerifyJobPayload struct {
+	Names []string `json:"names"`
+}
+
+// RollbackJobPayload requests a DeploymentRecord be reverted to an earlier
+// generation from its History ring buffer. A negative Generation is
+// relative: -1 means "one generation back", -2 "two generations back", and
+// so on; a value >= 0 is instead an absolute index into History (0 = oldest
+// retained generation), so an unset Generation targets the oldest one.
+type RollbackJobPayload struct {
+	Name       string `json:"name"`
+	Generation int    `json:"generation"`
+}
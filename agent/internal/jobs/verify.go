@@ -0,0 +1,62 @@
+package jobs
+
+import "context"
+
+// DeploymentDrift reports whether a tracked deployment's running
+// container(s) still match the digest trust-on-first-use pinned for it at
+// deploy time.
+type DeploymentDrift struct {
+	Name          string `json:"name"`
+	Image         string `json:"image"`
+	PinnedDigest  string `json:"pinned_digest"`
+	ActualImageID string `json:"actual_image_id"`
+	Drifted       bool   `json:"drifted"`
+	Error         string `json:"error,omitempty"`
+}
+
+// handleVerify ("henchmen verify") walks every tracked deployment (or just
+// payload.Names, if given) and compares each running container's image ID
+// against the digest pinned for it at deploy time - every rollout mode
+// (recreate, blue_green, canary, replica set) and deploy strategy stamps
+// PinnedDigest onto its own DeploymentRecord, so this isn't limited to
+// deployDescriptor's TOFU resolver - giving operators a way to catch "latest
+// roulette" drift directly instead of discovering it as a production
+// incident. A deployment with no pinned digest (PinnedDigest == "") is
+// reported but never flagged as drifted, since nothing was pinned to drift
+// from.
+func (h *Handler) handleVerify(ctx context.Context, payload VerifyJobPayload) (interface{}, error) {
+	all := h.State.AllDeployments()
+	names := payload.Names
+	if len(names) == 0 {
+		for name := range all {
+			names = append(names, name)
+		}
+	}
+
+	results := make([]DeploymentDrift, 0, len(names))
+	for _, name := range names {
+		record, ok := all[name]
+		if !ok {
+			results = append(results, DeploymentDrift{Name: name, Error: "no recorded deployment"})
+			continue
+		}
+		drift := DeploymentDrift{Name: name, Image: record.Image, PinnedDigest: record.PinnedDigest}
+		containerIDs := record.ReplicaIDs
+		if len(containerIDs) == 0 {
+			containerIDs = []string{record.ContainerID}
+		}
+		for _, id := range containerIDs {
+			ins, err := h.Docker.InspectContainer(ctx, id)
+			if err != nil {
+				drift.Error = err.Error()
+				continue
+			}
+			drift.ActualImageID = ins.Image
+			if record.PinnedDigest != "" && ins.Image != record.PinnedDigest {
+				drift.Drifted = true
+			}
+		}
+		results = append(results, drift)
+	}
+	return map[string]interface{}{"deployments": results}, nil
+}
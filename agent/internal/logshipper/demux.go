@@ -0,0 +1,70 @@
+package logshipper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// emitFunc records one demultiplexed log line on the given stream
+// ("stdout", "stderr" or "status").
+type emitFunc func(stream, msg string) error
+
+// demuxDocker splits src using Docker's stdcopy framing: each frame starts
+// with an 8-byte header whose first byte is the stream ID (1=stdout,
+// 2=stderr) and whose last 4 bytes are a big-endian payload length. This is
+// the format ContainerLogs/ImageBuild attach emit whenever the container or
+// build was not given a TTY.
+func demuxDocker(src io.Reader, emit emitFunc) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		stream := "status"
+		switch header[0] {
+		case 1:
+			stream = "stdout"
+		case 2:
+			stream = "stderr"
+		}
+		size := binary.BigEndian.Uint32(header[4:8])
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(src, payload); err != nil {
+			return err
+		}
+		for _, line := range splitLines(payload) {
+			if line == "" {
+				continue
+			}
+			if err := emit(stream, line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// demuxLines treats src as plain newline-delimited text with no framing,
+// emitting every non-empty line on stream.
+func demuxLines(src io.Reader, stream string, emit emitFunc) error {
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if err := emit(stream, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func splitLines(payload []byte) []string {
+	return strings.Split(strings.TrimRight(string(payload), "\n"), "\n")
+}
@@ -0,0 +1,16 @@
+// Package logshipper demultiplexes Docker's attach stream (or plain status
+// text) into sequenced NDJSON frames, ships them to the controller over a
+// streaming POST that carries the last acknowledged sequence number as
+// ?since_seq=, and persists the unacknowledged frames in a small on-disk
+// ring buffer. A dropped connection is not re-established by this package.
+package logshipper
+
+import "time"
+
+// Frame is a single NDJSON log line shipped to the controller.
+type Frame struct {
+	Seq    uint64    `json:"seq"`
+	Ts     time.Time `json:"ts"`
+	Stream string    `json:"stream"` // "stdout", "stderr" or "status"
+	Msg    string    `json:"msg"`
+}
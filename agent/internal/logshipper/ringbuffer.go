@@ -0,0 +1,215 @@
+package logshipper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ringBuffer persists the unacknowledged tail of a job's log frames under
+// dir, so a crash or reconnect can resume shipping from the last
+// acknowledged sequence number instead of replaying from scratch.
+type ringBuffer struct {
+	mu        sync.Mutex
+	dir       string
+	maxFrames int
+	nextSeq   uint64
+	ackedSeq  uint64
+	frames    []Frame
+	file      *os.File
+}
+
+type ringState struct {
+	NextSeq  uint64 `json:"next_seq"`
+	AckedSeq uint64 `json:"acked_seq"`
+}
+
+func openRingBuffer(dir string, maxFrames int) (*ringBuffer, error) {
+	if maxFrames <= 0 {
+		maxFrames = 2000
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	rb := &ringBuffer{dir: dir, maxFrames: maxFrames}
+	if err := rb.loadState(); err != nil {
+		return nil, err
+	}
+	if err := rb.loadFrames(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(rb.framesPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	rb.file = f
+	return rb, nil
+}
+
+func (rb *ringBuffer) statePath() string  { return filepath.Join(rb.dir, "state.json") }
+func (rb *ringBuffer) framesPath() string { return filepath.Join(rb.dir, "frames.jsonl") }
+
+func (rb *ringBuffer) loadState() error {
+	data, err := os.ReadFile(rb.statePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var st ringState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	rb.nextSeq = st.NextSeq
+	rb.ackedSeq = st.AckedSeq
+	return nil
+}
+
+func (rb *ringBuffer) loadFrames() error {
+	f, err := os.Open(rb.framesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var fr Frame
+		if err := json.Unmarshal(scanner.Bytes(), &fr); err != nil {
+			continue
+		}
+		if fr.Seq <= rb.ackedSeq {
+			continue
+		}
+		rb.frames = append(rb.frames, fr)
+	}
+	return scanner.Err()
+}
+
+// Allocate returns the next frame sequence number.
+func (rb *ringBuffer) Allocate() uint64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.nextSeq++
+	return rb.nextSeq
+}
+
+// AckedSeq returns the highest sequence number the controller has
+// acknowledged, i.e. where a resumed shipment should pick up from.
+func (rb *ringBuffer) AckedSeq() uint64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.ackedSeq
+}
+
+// LastSeq returns the highest sequence number allocated so far.
+func (rb *ringBuffer) LastSeq() uint64 {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.nextSeq
+}
+
+// Append persists f, trimming the oldest buffered frames once maxFrames is
+// exceeded.
+func (rb *ringBuffer) Append(f Frame) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if _, err := rb.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	rb.frames = append(rb.frames, f)
+	if len(rb.frames) > rb.maxFrames {
+		rb.frames = append([]Frame(nil), rb.frames[len(rb.frames)-rb.maxFrames:]...)
+		if err := rb.compactLocked(); err != nil {
+			return err
+		}
+	}
+	return rb.saveStateLocked()
+}
+
+// Ack drops all buffered frames at or below seq, called once the controller
+// has confirmed it durably has them (via AckJob's log_seq or LogsAck).
+func (rb *ringBuffer) Ack(seq uint64) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if seq <= rb.ackedSeq {
+		return nil
+	}
+	rb.ackedSeq = seq
+	kept := rb.frames[:0]
+	for _, f := range rb.frames {
+		if f.Seq > seq {
+			kept = append(kept, f)
+		}
+	}
+	rb.frames = kept
+	if err := rb.compactLocked(); err != nil {
+		return err
+	}
+	return rb.saveStateLocked()
+}
+
+func (rb *ringBuffer) compactLocked() error {
+	if err := rb.file.Close(); err != nil {
+		return err
+	}
+	tmp := rb.framesPath() + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	for _, fr := range rb.frames {
+		data, err := json.Marshal(fr)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, rb.framesPath()); err != nil {
+		return err
+	}
+	newFile, err := os.OpenFile(rb.framesPath(), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	rb.file = newFile
+	return nil
+}
+
+func (rb *ringBuffer) saveStateLocked() error {
+	data, err := json.Marshal(ringState{NextSeq: rb.nextSeq, AckedSeq: rb.ackedSeq})
+	if err != nil {
+		return err
+	}
+	tmp := rb.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, rb.statePath())
+}
+
+func (rb *ringBuffer) Close() error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.file == nil {
+		return nil
+	}
+	return rb.file.Close()
+}
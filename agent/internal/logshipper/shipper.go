@@ -0,0 +1,108 @@
+package logshipper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"time"
+
+	"deploybot-agent/internal/controller"
+	"deploybot-agent/internal/jobs"
+)
+
+const defaultMaxBufferedFrames = 2000
+
+// Shipper implements jobs.LogPublisher on top of Client.ShipLogs: it frames
+// the job's log stream as sequenced NDJSON, persists a ring buffer per job
+// under DataDir/logs/<jobID>, and starts each shipment with ?since_seq= set
+// to the job's last acknowledged sequence number. Publish makes a single
+// ShipLogs request: if that connection drops, Publish returns the error
+// without reconnecting or re-sending the buffered frames.
+type Shipper struct {
+	Client  *controller.Client
+	AgentID string
+	DataDir string
+	// MaxBufferedFrames bounds the on-disk ring buffer per job; defaults to 2000.
+	MaxBufferedFrames int
+}
+
+// Publish satisfies jobs.LogPublisher. format tells it how to interpret
+// reader: a Docker multiplexed attach stream, or plain status lines.
+func (s *Shipper) Publish(ctx context.Context, jobID string, reader io.Reader, format jobs.LogStreamFormat) error {
+	buf, err := openRingBuffer(s.ringDir(jobID), s.maxFrames())
+	if err != nil {
+		return err
+	}
+	defer buf.Close()
+
+	pr, pw := io.Pipe()
+	produceErr := make(chan error, 1)
+	go func() {
+		produceErr <- produceFrames(reader, format, buf, pw)
+	}()
+
+	shipErr := s.Client.ShipLogs(ctx, s.AgentID, jobID, buf.AckedSeq(), pr)
+	if pErr := <-produceErr; pErr != nil && shipErr == nil {
+		shipErr = pErr
+	}
+	return shipErr
+}
+
+// produceFrames demultiplexes src into Frames, persists each to buf, and
+// writes it as an NDJSON line to w.
+func produceFrames(src io.Reader, format jobs.LogStreamFormat, buf *ringBuffer, w io.WriteCloser) (err error) {
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	enc := json.NewEncoder(w)
+	emit := func(stream, msg string) error {
+		f := Frame{Seq: buf.Allocate(), Ts: time.Now().UTC(), Stream: stream, Msg: msg}
+		if err := buf.Append(f); err != nil {
+			return err
+		}
+		return enc.Encode(f)
+	}
+	switch format {
+	case jobs.LogStreamDockerMultiplex:
+		return demuxDocker(src, emit)
+	default:
+		return demuxLines(src, "status", emit)
+	}
+}
+
+// LastSeq returns the highest frame sequence number shipped for jobID, for
+// inclusion in the job's AckJob call so the controller can truncate its own
+// log storage.
+func (s *Shipper) LastSeq(jobID string) uint64 {
+	buf, err := openRingBuffer(s.ringDir(jobID), s.maxFrames())
+	if err != nil {
+		return 0
+	}
+	defer buf.Close()
+	return buf.LastSeq()
+}
+
+// AckUpTo truncates jobID's local ring buffer to frames after seq, once the
+// controller has confirmed it durably has them.
+func (s *Shipper) AckUpTo(jobID string, seq uint64) error {
+	buf, err := openRingBuffer(s.ringDir(jobID), s.maxFrames())
+	if err != nil {
+		return err
+	}
+	defer buf.Close()
+	return buf.Ack(seq)
+}
+
+func (s *Shipper) ringDir(jobID string) string {
+	return filepath.Join(s.DataDir, "logs", jobID)
+}
+
+func (s *Shipper) maxFrames() int {
+	if s.MaxBufferedFrames > 0 {
+		return s.MaxBufferedFrames
+	}
+	return defaultMaxBufferedFrames
+}
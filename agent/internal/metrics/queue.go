@@ -0,0 +1,45 @@
+package metrics
+
+import "sort"
+
+// JobQueueDepth is a point-in-time running/queued/retrying count for a
+// single job type, keyed by the same string as jobs.JobType.
+type JobQueueDepth struct {
+	Type     string `json:"type"`
+	Running  int    `json:"running,omitempty"`
+	Queued   int    `json:"queued,omitempty"`
+	Retrying int    `json:"retrying,omitempty"`
+}
+
+// FlattenJobQueue merges running/queued/retrying counts keyed by job type
+// into a stable, sorted slice, so callers don't need to marshal three
+// separate maps onto the heartbeat wire format. Any of the three maps may
+// be nil.
+func FlattenJobQueue(running, queued, retrying map[string]int) []JobQueueDepth {
+	seen := map[string]bool{}
+	for t := range running {
+		seen[t] = true
+	}
+	for t := range queued {
+		seen[t] = true
+	}
+	for t := range retrying {
+		seen[t] = true
+	}
+	types := make([]string, 0, len(seen))
+	for t := range seen {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	out := make([]JobQueueDepth, 0, len(types))
+	for _, t := range types {
+		out = append(out, JobQueueDepth{
+			Type:     t,
+			Running:  running[t],
+			Queued:   queued[t],
+			Retrying: retrying[t],
+		})
+	}
+	return out
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"time"
+
+	"deploybot-agent/internal/controller"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registry owns every Prometheus collector the agent exposes on /metrics
+// and the observation methods that feed them, so the rest of the agent
+// never touches the prometheus package directly.
+type Registry struct {
+	reg *prometheus.Registry
+
+	hostCPUPercent prometheus.Gauge
+	hostMemPercent prometheus.Gauge
+	hostDiskFreeGB prometheus.Gauge
+
+	containerUp           *prometheus.GaugeVec
+	containerRestartCount *prometheus.GaugeVec
+	containerPorts        *prometheus.GaugeVec
+
+	containerCPUPercent  *prometheus.GaugeVec
+	containerMemUsage    *prometheus.GaugeVec
+	containerMemLimit    *prometheus.GaugeVec
+	containerNetworkRx   *prometheus.GaugeVec
+	containerNetworkTx   *prometheus.GaugeVec
+	containerBlkioRead   *prometheus.GaugeVec
+	containerBlkioWrite  *prometheus.GaugeVec
+
+	jobsTotal     *prometheus.CounterVec
+	jobDuration   *prometheus.HistogramVec
+	jobQueueWait  *prometheus.HistogramVec
+	jobQueueDepth *prometheus.GaugeVec
+	controllerRPC *prometheus.HistogramVec
+}
+
+// NewRegistry constructs and registers every collector.
+func NewRegistry() *Registry {
+	r := &Registry{
+		reg: prometheus.NewRegistry(),
+		hostCPUPercent: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "deploybot_host_cpu_percent",
+			Help: "Host CPU utilisation percentage.",
+		}),
+		hostMemPercent: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "deploybot_host_mem_percent",
+			Help: "Host memory utilisation percentage.",
+		}),
+		hostDiskFreeGB: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "deploybot_host_disk_free_gb",
+			Help: "Free disk space on the root partition, in GB.",
+		}),
+		containerUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_up",
+			Help: "1 if the container is reported running by the Docker daemon, 0 otherwise.",
+		}, []string{"name", "image", "status", "health"}),
+		containerRestartCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_restart_count",
+			Help: "Restart count reported by the Docker daemon for this container.",
+		}, []string{"name", "image"}),
+		containerPorts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_published_ports",
+			Help: "Published ports for a container; value is always 1, the port mapping is carried in labels.",
+		}, []string{"name", "container_port", "published_addr"}),
+		containerCPUPercent: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_cpu_percent",
+			Help: "CPU utilisation percentage for an agent-managed container, as docker stats computes it.",
+		}, []string{"name", "image"}),
+		containerMemUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_memory_usage_bytes",
+			Help: "Memory usage in bytes for an agent-managed container.",
+		}, []string{"name", "image"}),
+		containerMemLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_memory_limit_bytes",
+			Help: "Memory limit in bytes for an agent-managed container.",
+		}, []string{"name", "image"}),
+		containerNetworkRx: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_network_receive_bytes",
+			Help: "Total bytes received across all network interfaces of an agent-managed container.",
+		}, []string{"name", "image"}),
+		containerNetworkTx: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_network_transmit_bytes",
+			Help: "Total bytes transmitted across all network interfaces of an agent-managed container.",
+		}, []string{"name", "image"}),
+		containerBlkioRead: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_blkio_read_bytes",
+			Help: "Total bytes read from block devices by an agent-managed container.",
+		}, []string{"name", "image"}),
+		containerBlkioWrite: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_container_blkio_write_bytes",
+			Help: "Total bytes written to block devices by an agent-managed container.",
+		}, []string{"name", "image"}),
+		jobsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "deploybot_jobs_total",
+			Help: "Total jobs handled by this agent, by type and outcome.",
+		}, []string{"type", "outcome"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "deploybot_job_duration_seconds",
+			Help:    "Job execution duration in seconds, by type.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"type"}),
+		jobQueueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "deploybot_job_queue_wait_seconds",
+			Help:    "Time a job spent queued (behind a busy serial key, a per-type concurrency cap, or a full worker pool) before a worker started it.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"type"}),
+		jobQueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "deploybot_job_queue_depth",
+			Help: "Current job pool queue depth by type and state (running, queued, retrying).",
+		}, []string{"type", "state"}),
+		controllerRPC: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "deploybot_controller_rpc_duration_seconds",
+			Help:    "Controller RPC latency in seconds, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+	r.reg.MustRegister(
+		r.hostCPUPercent, r.hostMemPercent, r.hostDiskFreeGB,
+		r.containerUp, r.containerRestartCount, r.containerPorts,
+		r.containerCPUPercent, r.containerMemUsage, r.containerMemLimit,
+		r.containerNetworkRx, r.containerNetworkTx, r.containerBlkioRead, r.containerBlkioWrite,
+		r.jobsTotal, r.jobDuration, r.jobQueueWait, r.jobQueueDepth, r.controllerRPC,
+	)
+	return r
+}
+
+// ObserveHost updates the host resource gauges from a metrics Snapshot.
+func (r *Registry) ObserveHost(snap Snapshot) {
+	r.hostCPUPercent.Set(snap.CPUPercent)
+	r.hostMemPercent.Set(snap.MemPercent)
+	r.hostDiskFreeGB.Set(snap.DiskFreeGB)
+}
+
+// ObserveInventory rebuilds the per-container gauges from the agent's
+// latest Docker inventory snapshot, resetting stale label combinations
+// from containers that no longer exist so gauges don't accumulate forever.
+func (r *Registry) ObserveInventory(resources []controller.InventoryResource) {
+	r.containerUp.Reset()
+	r.containerRestartCount.Reset()
+	r.containerPorts.Reset()
+	for _, c := range resources {
+		r.containerUp.WithLabelValues(c.Name, c.Image, c.Status, c.Health).Set(1)
+		r.containerRestartCount.WithLabelValues(c.Name, c.Image).Set(float64(c.RestartCount))
+		for containerPort, publishedAddr := range c.Ports {
+			r.containerPorts.WithLabelValues(c.Name, containerPort, publishedAddr).Set(1)
+		}
+	}
+}
+
+// ResetContainerStats clears the per-container resource-usage gauges so a
+// container that stopped being sampled (removed, or no longer carrying
+// AgentLabelManagedKey) doesn't leave a stale series behind. Call this once
+// per sampling cycle before the ObserveContainerStats calls for that cycle.
+func (r *Registry) ResetContainerStats() {
+	r.containerCPUPercent.Reset()
+	r.containerMemUsage.Reset()
+	r.containerMemLimit.Reset()
+	r.containerNetworkRx.Reset()
+	r.containerNetworkTx.Reset()
+	r.containerBlkioRead.Reset()
+	r.containerBlkioWrite.Reset()
+}
+
+// ObserveContainerStats records one container's resource-usage sample,
+// keyed by name/image like the other per-container gauges.
+func (r *Registry) ObserveContainerStats(name, image string, cpuPercent float64, memUsageBytes, memLimitBytes, networkRxBytes, networkTxBytes, blkioReadBytes, blkioWriteBytes uint64) {
+	r.containerCPUPercent.WithLabelValues(name, image).Set(cpuPercent)
+	r.containerMemUsage.WithLabelValues(name, image).Set(float64(memUsageBytes))
+	r.containerMemLimit.WithLabelValues(name, image).Set(float64(memLimitBytes))
+	r.containerNetworkRx.WithLabelValues(name, image).Set(float64(networkRxBytes))
+	r.containerNetworkTx.WithLabelValues(name, image).Set(float64(networkTxBytes))
+	r.containerBlkioRead.WithLabelValues(name, image).Set(float64(blkioReadBytes))
+	r.containerBlkioWrite.WithLabelValues(name, image).Set(float64(blkioWriteBytes))
+}
+
+// ObserveJob records a completed job's outcome and duration.
+func (r *Registry) ObserveJob(jobType, outcome string, duration time.Duration) {
+	r.jobsTotal.WithLabelValues(jobType, outcome).Inc()
+	r.jobDuration.WithLabelValues(jobType).Observe(duration.Seconds())
+}
+
+// ObserveJobWait records how long a job spent queued before a worker
+// started it.
+func (r *Registry) ObserveJobWait(jobType string, wait time.Duration) {
+	r.jobQueueWait.WithLabelValues(jobType).Observe(wait.Seconds())
+}
+
+// ObserveJobQueue rebuilds the job-queue-depth gauge from a
+// metrics.FlattenJobQueue snapshot, resetting stale label combinations from
+// job types that are no longer queued so the gauge doesn't accumulate
+// forever.
+func (r *Registry) ObserveJobQueue(depths []JobQueueDepth) {
+	r.jobQueueDepth.Reset()
+	for _, d := range depths {
+		r.jobQueueDepth.WithLabelValues(d.Type, "running").Set(float64(d.Running))
+		r.jobQueueDepth.WithLabelValues(d.Type, "queued").Set(float64(d.Queued))
+		r.jobQueueDepth.WithLabelValues(d.Type, "retrying").Set(float64(d.Retrying))
+	}
+}
+
+// ObserveControllerRPC records a controller RPC's latency.
+func (r *Registry) ObserveControllerRPC(method string, duration time.Duration) {
+	r.controllerRPC.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// Prometheus exposes the underlying *prometheus.Registry for promhttp.
+func (r *Registry) Prometheus() *prometheus.Registry {
+	return r.reg
+}
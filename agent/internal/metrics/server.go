@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ServerConfig configures the /metrics, /healthz and /readyz HTTP server.
+// ListenAddr is the only required field; leaving it empty means the server
+// is disabled. ClientCertFile/ClientKeyFile/ClientCAFile reuse the agent's
+// own mTLS identity and trust anchor, so a scraper needs the same CA trust
+// as the controller to reach the endpoint.
+type ServerConfig struct {
+	ListenAddr     string
+	AuthToken      string
+	ClientCertFile string
+	ClientKeyFile  string
+	ClientCAFile   string
+}
+
+// ReadyFunc reports whether the agent currently considers itself able to
+// reach the controller, backing /readyz.
+type ReadyFunc func() bool
+
+// NewServer builds the /metrics, /healthz and /readyz http.Server described
+// by cfg. It does not start listening; call ListenAndServe (or
+// ListenAndServeTLS, chosen automatically based on whether cfg supplies a
+// certificate) on the result.
+func NewServer(reg *Registry, cfg ServerConfig, ready ReadyFunc) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", requireBearerToken(cfg.AuthToken, promhttp.HandlerFor(reg.Prometheus(), promhttp.HandlerOpts{})))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready == nil || ready() {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("ready"))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ready: controller unreachable"))
+	})
+
+	srv := &http.Server{Addr: cfg.ListenAddr, Handler: mux}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, fmt.Errorf("metrics server mTLS requires both a cert and a key")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load metrics server certificate: %w", err)
+		}
+		tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+		if cfg.ClientCAFile != "" {
+			pool := x509.NewCertPool()
+			pem, err := os.ReadFile(cfg.ClientCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read metrics client CA: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in metrics client CA %s", cfg.ClientCAFile)
+			}
+			tlsCfg.ClientCAs = pool
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		srv.TLSConfig = tlsCfg
+	}
+	return srv, nil
+}
+
+// Serve runs srv until ctx is cancelled, then shuts it down gracefully.
+// It chooses TLS or plaintext based on whether srv.TLSConfig was set by
+// NewServer, and never returns http.ErrServerClosed as an error.
+func Serve(ctx context.Context, srv *http.Server) error {
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errCh <- err
+			return
+		}
+		errCh <- nil
+	}()
+
+	select {
+	case <-ctx.Done():
+		return srv.Shutdown(context.Background())
+	case err := <-errCh:
+		return err
+	}
+}
+
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
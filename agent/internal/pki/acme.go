@@ -0,0 +1,187 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme"
+)
+
+// enroll requests a fresh client certificate (and the CA pool that issued
+// it) from the configured ACME directory. The account is bound to
+// step-ca's ACME provisioner via external account binding, using the
+// agent's current auto-auth token as the EAB HMAC secret - so a step-ca
+// admin only has to hand out an EAB key ID, not per-agent bootstrap certs.
+func (m *Manager) enroll(ctx context.Context) (*tls.Certificate, *x509.CertPool, []*x509.Certificate, error) {
+	eabSecret, err := m.cfg.EABSecret(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("resolve EAB secret: %w", err)
+	}
+
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	client := &acme.Client{Key: accountKey, DirectoryURL: m.cfg.DirectoryURL}
+	if _, err := client.Discover(ctx); err != nil {
+		return nil, nil, nil, fmt.Errorf("discover ACME directory: %w", err)
+	}
+
+	acct := &acme.Account{
+		ExternalAccountBinding: &acme.ExternalAccountBinding{
+			KID: m.cfg.EABKeyID,
+			Key: []byte(eabSecret),
+		},
+	}
+	if _, err := client.Register(ctx, acct, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, nil, nil, fmt.Errorf("register ACME account: %w", err)
+	}
+
+	names := dedupNames(m.cfg.AgentID, m.cfg.Hostname)
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(names...))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("create ACME order: %w", err)
+	}
+
+	if err := m.solveChallenges(ctx, client, order); err != nil {
+		return nil, nil, nil, err
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("wait for ACME order: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, certKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("build CSR: %w", err)
+	}
+
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("finalize ACME order: %w", err)
+	}
+	if len(der) == 0 {
+		return nil, nil, nil, fmt.Errorf("ACME order returned no certificates")
+	}
+
+	cert := &tls.Certificate{Certificate: der, PrivateKey: certKey}
+	issuers := parseIssuers(der)
+	return cert, certPoolOf(issuers), issuers, nil
+}
+
+// solveChallenges satisfies the http-01 challenge for every authorization
+// on order by briefly standing up a local responder. This requires the
+// step-ca server to be able to reach the agent on ChallengeListenAddr.
+func (m *Manager) solveChallenges(ctx context.Context, client *acme.Client, order *acme.Order) error {
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return fmt.Errorf("get authorization: %w", err)
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		var chal *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == "http-01" {
+				chal = c
+				break
+			}
+		}
+		if chal == nil {
+			return fmt.Errorf("no http-01 challenge offered for %s", authz.Identifier.Value)
+		}
+
+		response, err := client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return fmt.Errorf("build http-01 response: %w", err)
+		}
+
+		stop, err := serveHTTP01(m.challengeAddr(), client.HTTP01ChallengePath(chal.Token), response)
+		if err != nil {
+			return err
+		}
+
+		_, acceptErr := client.Accept(ctx, chal)
+		if acceptErr == nil {
+			_, acceptErr = client.WaitAuthorization(ctx, authzURL)
+		}
+		stop()
+		if acceptErr != nil {
+			return fmt.Errorf("complete http-01 challenge for %s: %w", authz.Identifier.Value, acceptErr)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) challengeAddr() string {
+	if m.cfg.ChallengeListenAddr != "" {
+		return m.cfg.ChallengeListenAddr
+	}
+	return ":80"
+}
+
+func serveHTTP01(addr, path, response string) (stop func(), err error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(response))
+	})
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for http-01 challenge on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: mux}
+	go func() { _ = srv.Serve(ln) }()
+	return func() { _ = srv.Close() }, nil
+}
+
+// parseIssuers parses every certificate in the ACME chain after the leaf
+// (der[0]), giving callers the same trust anchor step-ca used to issue
+// this client certificate.
+func parseIssuers(der [][]byte) []*x509.Certificate {
+	var issuers []*x509.Certificate
+	for _, raw := range der[1:] {
+		if cert, err := x509.ParseCertificate(raw); err == nil {
+			issuers = append(issuers, cert)
+		}
+	}
+	return issuers
+}
+
+func certPoolOf(certs []*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool
+}
+
+func dedupNames(values ...string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	keyFileName  = "client_key.pem"
+	certFileName = "client_cert.pem"
+)
+
+func (m *Manager) certPaths() (keyPath, certPath string) {
+	dir := filepath.Join(m.cfg.DataDir, "pki")
+	return filepath.Join(dir, keyFileName), filepath.Join(dir, certFileName)
+}
+
+// loadPersisted loads a previously enrolled cert/key pair from disk, if
+// present and readable; it does not fetch the issuing CA pool, since that
+// is only needed to validate the controller's own certificate, not to use
+// this one as a client certificate.
+func (m *Manager) loadPersisted() (*tls.Certificate, bool) {
+	keyPath, certPath := m.certPaths()
+	keyPEM, err := m.readMaybeEncrypted(keyPath)
+	if err != nil {
+		return nil, false
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, false
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, false
+	}
+	return &cert, true
+}
+
+func (m *Manager) persist(cert *tls.Certificate) error {
+	keyPath, certPath := m.certPaths()
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return err
+	}
+	keyPEM, certPEM, err := encodeCertificate(cert)
+	if err != nil {
+		return err
+	}
+	if err := m.writeMaybeEncrypted(keyPath, keyPEM); err != nil {
+		return err
+	}
+	return writeFileAtomic(certPath, certPEM, 0o644)
+}
+
+func (m *Manager) readMaybeEncrypted(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if m.cfg.Cipher == nil {
+		return data, nil
+	}
+	return m.cfg.Cipher.Decrypt(string(data))
+}
+
+func (m *Manager) writeMaybeEncrypted(path string, data []byte) error {
+	if m.cfg.Cipher == nil {
+		return writeFileAtomic(path, data, 0o600)
+	}
+	enc, err := m.cfg.Cipher.Encrypt(data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(enc), 0o600)
+}
+
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func encodeCertificate(cert *tls.Certificate) (keyPEM, certPEM []byte, err error) {
+	ecKey, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("pki: expected an ECDSA private key")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	var buf bytes.Buffer
+	for _, der := range cert.Certificate {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return keyPEM, buf.Bytes(), nil
+}
@@ -0,0 +1,190 @@
+// Package pki bootstraps and renews the agent's mTLS client certificate
+// against a step-ca / ACME server, so operators don't have to provision
+// and rotate ClientCertFile/ClientKeyFile by hand.
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"deploybot-agent/internal/state"
+)
+
+// pkiRetryBackoff is how soon Manager retries after a failed enrollment or
+// renewal attempt.
+const pkiRetryBackoff = 30 * time.Second
+
+// defaultRenewalFraction renews a certificate once this fraction of its
+// total lifetime has elapsed.
+const defaultRenewalFraction = 2.0 / 3.0
+
+// Config configures a Manager.
+type Config struct {
+	// DataDir is the agent's persistent state directory; key/cert material
+	// is stored under DataDir/pki.
+	DataDir string
+	// AgentID and Hostname become the cert's SANs; AgentID is also used as
+	// the certificate's CommonName.
+	AgentID  string
+	Hostname string
+
+	// DirectoryURL is the ACME directory endpoint, e.g. a step-ca
+	// provisioner's ".../acme/<provisioner>/directory".
+	DirectoryURL string
+	// EABKeyID is the step-ca ACME provisioner's EAB key ID.
+	EABKeyID string
+	// EABSecret resolves the HMAC secret used for external account
+	// binding. Called fresh on every enrollment/renewal so it can return
+	// the agent's current auto-auth token.
+	EABSecret func(ctx context.Context) (string, error)
+	// ChallengeListenAddr is where the http-01 challenge responder binds;
+	// defaults to ":80".
+	ChallengeListenAddr string
+	// RenewalFraction overrides defaultRenewalFraction.
+	RenewalFraction float64
+
+	// Cipher, if set, encrypts the persisted private key at rest the same
+	// way state.Store encrypts the agent token.
+	Cipher state.Cipher
+}
+
+// Manager issues and renews the agent's mTLS client certificate.
+type Manager struct {
+	cfg Config
+
+	mu          sync.RWMutex
+	cert        *tls.Certificate
+	caPool      *x509.CertPool
+	issuerCerts []*x509.Certificate
+}
+
+// New builds a Manager; call Start to perform the initial enrollment.
+func New(cfg Config) *Manager {
+	if cfg.RenewalFraction <= 0 || cfg.RenewalFraction >= 1 {
+		cfg.RenewalFraction = defaultRenewalFraction
+	}
+	return &Manager{cfg: cfg}
+}
+
+// Start loads a persisted certificate if one is present and not due for
+// renewal, otherwise enrolls a new one, then renews in the background
+// until ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) error {
+	if err := m.bootstrapOrRenew(ctx); err != nil {
+		return err
+	}
+	go m.renewLoop(ctx)
+	return nil
+}
+
+// GetClientCertificate matches tls.Config.GetClientCertificate, so
+// controller.Client can be wired directly to a live-renewing cert.
+func (m *Manager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("pki: no client certificate has been issued yet")
+	}
+	return m.cert, nil
+}
+
+// CACertPool returns the CA roots observed from the ACME issuance chain,
+// the same trust anchor used to issue the current client certificate.
+func (m *Manager) CACertPool() *x509.CertPool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.caPool
+}
+
+// IssuerCertificates returns the raw CA certificates observed from the
+// ACME issuance chain, for callers (e.g. CAPins cross-checks) that need to
+// hash them individually rather than use them through a *x509.CertPool.
+func (m *Manager) IssuerCertificates() []*x509.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.issuerCerts
+}
+
+// Sign signs data's SHA-256 digest with the current client certificate's
+// private key (audit.Signer), so records can be tied to this agent's
+// verified mTLS identity rather than to anything with filesystem access to
+// the audit log.
+func (m *Manager) Sign(data []byte) ([]byte, error) {
+	m.mu.RLock()
+	cert := m.cert
+	m.mu.RUnlock()
+	if cert == nil {
+		return nil, errors.New("pki: no client certificate has been issued yet")
+	}
+	key, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("pki: client certificate key type %T does not support signing", cert.PrivateKey)
+	}
+	digest := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+func (m *Manager) renewLoop(ctx context.Context) {
+	for {
+		wait := m.renewalDelay()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := m.enrollAndStore(ctx); err != nil {
+			log.Printf("pki: certificate renewal failed, retrying shortly: %v", err)
+			time.Sleep(pkiRetryBackoff)
+		}
+	}
+}
+
+func (m *Manager) bootstrapOrRenew(ctx context.Context) error {
+	if cert, ok := m.loadPersisted(); ok && !needsRenewal(cert, m.cfg.RenewalFraction) {
+		m.mu.Lock()
+		m.cert = cert
+		m.mu.Unlock()
+		return nil
+	}
+	return m.enrollAndStore(ctx)
+}
+
+func (m *Manager) enrollAndStore(ctx context.Context) error {
+	cert, caPool, issuerCerts, err := m.enroll(ctx)
+	if err != nil {
+		return err
+	}
+	if err := m.persist(cert); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert, m.caPool, m.issuerCerts = cert, caPool, issuerCerts
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) renewalDelay() time.Duration {
+	m.mu.RLock()
+	cert := m.cert
+	m.mu.RUnlock()
+	if cert == nil {
+		return 0
+	}
+	d := renewalDueIn(cert, m.cfg.RenewalFraction)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
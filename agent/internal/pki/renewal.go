@@ -0,0 +1,27 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// needsRenewal reports whether cert is already within its renewal window.
+func needsRenewal(cert *tls.Certificate, fraction float64) bool {
+	return renewalDueIn(cert, fraction) <= 0
+}
+
+// renewalDueIn returns how long until cert enters its renewal window
+// (fraction of its total lifetime elapsed), negative if already due.
+func renewalDueIn(cert *tls.Certificate, fraction float64) time.Duration {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return -1
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return -1
+	}
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	renewAt := leaf.NotBefore.Add(time.Duration(float64(lifetime) * fraction))
+	return time.Until(renewAt)
+}
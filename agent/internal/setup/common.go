@@ -0,0 +1,194 @@
+package setup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"deploybot-agent/internal/config"
+)
+
+const serviceUser = "deploybot"
+
+var reader = bufio.NewReader(os.Stdin)
+
+// Run performs interactive host checks before the agent starts. The
+// service-account and group-membership checks are platform specific and
+// live in setup_linux.go, setup_darwin.go and setup_windows.go behind their
+// own build tags; this file holds the checks (and prompts) shared by all of
+// them.
+func Run(cfg config.Config) error {
+	fmt.Println("== DeployBot Agent Interactive Setup ==")
+	fmt.Println("We'll verify host prerequisites before launching the agent.")
+	fmt.Println()
+
+	if err := platformSetup(cfg); err != nil {
+		return err
+	}
+	if err := ensureTLSMaterials(cfg); err != nil {
+		return err
+	}
+	if err := ensureWorkDirsWritable(cfg); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Setup checks complete. Continuing with agent startup...")
+	fmt.Println()
+	return nil
+}
+
+// ensureWorkDirsWritable verifies the agent's data and work directories
+// exist and are writable before we commit to starting.
+func ensureWorkDirsWritable(cfg config.Config) error {
+	for _, p := range []string{cfg.DataDir, cfg.WorkDir} {
+		if p == "" {
+			continue
+		}
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			return fmt.Errorf("cannot create %s: %w", p, err)
+		}
+		test := filepath.Join(p, fmt.Sprintf(".writetest-%d", os.Getpid()))
+		if err := os.WriteFile(test, []byte("ok"), 0o600); err != nil {
+			return fmt.Errorf("write test failed for %s: %w", p, err)
+		}
+		_ = os.Remove(test)
+	}
+	return nil
+}
+
+func ensureTLSMaterials(cfg config.Config) error {
+	if err := ensureTLSFile(cfg.ControllerCAFile, "controller CA bundle", 0o644); err != nil {
+		return err
+	}
+	if err := ensureTLSFile(cfg.ClientCertFile, "client certificate", 0o644); err != nil {
+		return err
+	}
+	if err := ensureTLSFile(cfg.ClientKeyFile, "client key", 0o600); err != nil {
+		return err
+	}
+	if len(cfg.ControllerCAPins) == 0 && cfg.ControllerCAFile == "" {
+		fmt.Println("ℹ TIP: Configure CONTROLLER_CA_PINS or CONTROLLER_CA_FILE to pin the controller certificate in production.")
+	}
+	return nil
+}
+
+func ensureTLSFile(path, description string, mode os.FileMode) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Printf("✔ %s found at %s.\n", description, path)
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	fmt.Printf("⚠ %s missing at %s.\n", description, path)
+	if os.Geteuid() != 0 {
+		fmt.Printf("   Please create the file and populate it with the appropriate material.\n")
+		return nil
+	}
+	if !promptYesNo(fmt.Sprintf("Create an empty placeholder for the %s now?", description), false) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte{}, mode); err != nil {
+		fmt.Printf("✖ Failed to create placeholder: %v\n", err)
+		return err
+	}
+	fmt.Printf("✔ Created placeholder %s. Populate it with real material before production use.\n", path)
+	return nil
+}
+
+// userInGroup reports whether username belongs to group. It prefers the
+// system's configured user/group resolver (covers LDAP/SSSD and other NSS
+// backends) and falls back to parsing /etc/group directly whenever that
+// lookup returns an error: the resolver is unavailable (e.g. a minimal
+// container without cgo or nsswitch), or it does not know the user or group.
+func userInGroup(username, group string) (bool, error) {
+	if ok, err := userInGroupNSS(username, group); err == nil {
+		return ok, nil
+	}
+	return userInGroupFile(username, group)
+}
+
+func userInGroupNSS(username, group string) (bool, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return false, err
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return false, err
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		if id == g.Gid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func userInGroupFile(username, group string) (bool, error) {
+	data, err := os.ReadFile("/etc/group")
+	if err != nil {
+		return false, err
+	}
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < 4 {
+			continue
+		}
+		if parts[0] != group {
+			continue
+		}
+		members := strings.Split(parts[3], ",")
+		for _, member := range members {
+			if strings.TrimSpace(member) == username {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+func promptYesNo(question string, defaultYes bool) bool {
+	indicator := "Y/n"
+	if !defaultYes {
+		indicator = "y/N"
+	}
+	for {
+		fmt.Printf("%s [%s]: ", question, indicator)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return defaultYes
+		}
+		input = strings.TrimSpace(strings.ToLower(input))
+		if input == "" {
+			return defaultYes
+		}
+		if input == "y" || input == "yes" {
+			return true
+		}
+		if input == "n" || input == "no" {
+			return false
+		}
+		fmt.Println("Please enter 'y' or 'n'.")
+	}
+}
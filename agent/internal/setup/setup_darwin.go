@@ -0,0 +1,108 @@
+//go:build darwin
+
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+
+	"deploybot-agent/internal/config"
+)
+
+// platformSetup runs the macOS service-account and docker-group checks.
+func platformSetup(cfg config.Config) error {
+	if err := ensureServiceAccount(cfg); err != nil {
+		return err
+	}
+	return ensureDockerMembership()
+}
+
+func ensureServiceAccount(cfg config.Config) error {
+	_, err := user.Lookup(serviceUser)
+	if err == nil {
+		fmt.Printf("✔ Service account '%s' is present.\n", serviceUser)
+		return nil
+	}
+	if _, ok := err.(user.UnknownUserError); !ok {
+		return err
+	}
+
+	fmt.Printf("⚠ Service account '%s' was not found.\n", serviceUser)
+	if os.Geteuid() != 0 {
+		fmt.Printf("   Run as root: dscl . -create /Users/%s\n", serviceUser)
+		return nil
+	}
+
+	if !promptYesNo(fmt.Sprintf("Create the '%s' service account now?", serviceUser), true) {
+		return nil
+	}
+
+	home := cfg.DataDir
+	if home == "" {
+		home = "/var/lib/deploybot"
+	}
+	steps := [][]string{
+		{"dscl", ".", "-create", "/Users/" + serviceUser},
+		{"dscl", ".", "-create", "/Users/" + serviceUser, "UserShell", "/usr/bin/false"},
+		{"dscl", ".", "-create", "/Users/" + serviceUser, "NFSHomeDirectory", home},
+		{"dscl", ".", "-create", "/Users/" + serviceUser, "IsHidden", "1"},
+	}
+	for _, args := range steps {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			if errors.Is(err, exec.ErrNotFound) {
+				fmt.Println("✖ 'dscl' command not found. Create the account manually using your platform's tooling.")
+				return nil
+			}
+			fmt.Printf("✖ Failed to create service account automatically: %v\n", err)
+			fmt.Printf("   Run manually: dscl . -create /Users/%s\n", serviceUser)
+			return nil
+		}
+	}
+	fmt.Println("✔ Created service account via dscl.")
+	return nil
+}
+
+func ensureDockerMembership() error {
+	if _, err := user.LookupGroup("docker"); err != nil {
+		fmt.Println("⚠ Docker group not found. Ensure Docker Desktop is installed.")
+		return nil
+	}
+
+	inGroup, err := userInGroup(serviceUser, "docker")
+	if err != nil {
+		return err
+	}
+	if inGroup {
+		fmt.Println("✔ Service account already belongs to the 'docker' group.")
+		return nil
+	}
+
+	fmt.Println("⚠ Service account is not part of the 'docker' group.")
+	if os.Geteuid() != 0 {
+		fmt.Printf("   Run: sudo dseditgroup -o edit -a %s -t user docker\n", serviceUser)
+		return nil
+	}
+	if !promptYesNo("Add deploybot to the docker group now?", true) {
+		return nil
+	}
+	cmd := exec.Command("dseditgroup", "-o", "edit", "-a", serviceUser, "-t", "user", "docker")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			fmt.Println("✖ 'dseditgroup' command not found. Add the account to the docker group manually.")
+			return nil
+		}
+		fmt.Printf("✖ Failed to add user to docker group automatically: %v\n", err)
+		fmt.Printf("   Run manually: dseditgroup -o edit -a %s -t user docker\n", serviceUser)
+		return nil
+	}
+	fmt.Println("✔ Added deploybot to the docker group.")
+	return nil
+}
@@ -0,0 +1,97 @@
+//go:build linux
+
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+
+	"deploybot-agent/internal/config"
+)
+
+// platformSetup runs the Linux service-account and docker-group checks.
+func platformSetup(cfg config.Config) error {
+	if err := ensureServiceAccount(cfg); err != nil {
+		return err
+	}
+	return ensureDockerMembership()
+}
+
+func ensureServiceAccount(cfg config.Config) error {
+	_, err := user.Lookup(serviceUser)
+	if err == nil {
+		fmt.Printf("✔ Service account '%s' is present.\n", serviceUser)
+		return nil
+	}
+	if _, ok := err.(user.UnknownUserError); !ok {
+		return err
+	}
+
+	fmt.Printf("⚠ Service account '%s' was not found.\n", serviceUser)
+	if os.Geteuid() != 0 {
+		fmt.Printf("   Run as root: useradd --system --create-home --home-dir %s --shell /usr/sbin/nologin %s\n", cfg.DataDir, serviceUser)
+		return nil
+	}
+
+	if !promptYesNo(fmt.Sprintf("Create the '%s' service account now?", serviceUser), true) {
+		return nil
+	}
+
+	args := []string{"--system", "--create-home", "--home-dir", cfg.DataDir, "--shell", "/usr/sbin/nologin", serviceUser}
+	cmd := exec.Command("useradd", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			fmt.Println("✖ 'useradd' command not found. Create the account manually using your platform's tooling.")
+			return nil
+		}
+		fmt.Printf("✖ Failed to create service account automatically: %v\n", err)
+		fmt.Printf("   Run manually: useradd --system --create-home --home-dir %s --shell /usr/sbin/nologin %s\n", cfg.DataDir, serviceUser)
+		return nil
+	}
+	fmt.Println("✔ Created service account and home directory.")
+	return nil
+}
+
+func ensureDockerMembership() error {
+	if _, err := user.LookupGroup("docker"); err != nil {
+		fmt.Println("⚠ Docker group not found. Ensure Docker is installed and the 'docker' group exists.")
+		return nil
+	}
+
+	inGroup, err := userInGroup(serviceUser, "docker")
+	if err != nil {
+		return err
+	}
+	if inGroup {
+		fmt.Println("✔ Service account already belongs to the 'docker' group.")
+		return nil
+	}
+
+	fmt.Println("⚠ Service account is not part of the 'docker' group.")
+	if os.Geteuid() != 0 {
+		fmt.Println("   Run: sudo usermod -aG docker deploybot")
+		return nil
+	}
+	if !promptYesNo("Add deploybot to the docker group now?", true) {
+		return nil
+	}
+	cmd := exec.Command("usermod", "-aG", "docker", serviceUser)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			fmt.Println("✖ 'usermod' command not found. Add the account to the docker group manually.")
+			return nil
+		}
+		fmt.Printf("✖ Failed to add user to docker group automatically: %v\n", err)
+		fmt.Println("   Run manually: usermod -aG docker deploybot")
+		return nil
+	}
+	fmt.Println("✔ Added deploybot to the docker group.")
+	return nil
+}
@@ -0,0 +1,79 @@
+//go:build windows
+
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"os/user"
+
+	"deploybot-agent/internal/config"
+)
+
+// platformSetup runs the Windows local-account and docker-users group checks.
+func platformSetup(cfg config.Config) error {
+	if err := ensureServiceAccount(cfg); err != nil {
+		return err
+	}
+	return ensureDockerMembership()
+}
+
+func ensureServiceAccount(cfg config.Config) error {
+	if _, err := user.Lookup(serviceUser); err == nil {
+		fmt.Printf("Service account '%s' is present.\n", serviceUser)
+		return nil
+	}
+
+	fmt.Printf("Service account '%s' was not found.\n", serviceUser)
+	if !promptYesNo(fmt.Sprintf("Create the '%s' local service account now?", serviceUser), true) {
+		fmt.Printf("   Run as Administrator: net user %s /add /random\n", serviceUser)
+		return nil
+	}
+
+	cmd := exec.Command("net", "user", serviceUser, "/add", "/random")
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			fmt.Println("'net' command not found. Create the account manually via Computer Management.")
+			return nil
+		}
+		fmt.Printf("Failed to create service account automatically: %v\n", err)
+		fmt.Printf("   Run manually: net user %s /add /random\n", serviceUser)
+		return nil
+	}
+	if err := grantLogOnAsService(serviceUser); err != nil {
+		fmt.Printf("Created the account but could not grant 'Log on as a service' automatically: %v\n", err)
+		fmt.Println("   Grant it manually via secpol.msc > Local Policies > User Rights Assignment.")
+	}
+	fmt.Println("Created service account.")
+	return nil
+}
+
+func ensureDockerMembership() error {
+	cmd := exec.Command("net", "localgroup", "docker-users", serviceUser, "/add")
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			fmt.Println("'net' command not found. Add the account to docker-users manually.")
+			return nil
+		}
+		fmt.Printf("Failed to add user to docker-users automatically: %v\n", err)
+		fmt.Printf("   Run manually: net localgroup docker-users %s /add\n", serviceUser)
+		return nil
+	}
+	fmt.Println("Added deploybot to the docker-users group.")
+	return nil
+}
+
+// grantLogOnAsService grants account the SeServiceLogonRight user right via
+// ntrights.exe, the standard tool for scripting Windows user-rights
+// assignment (there is no "net user" equivalent).
+func grantLogOnAsService(account string) error {
+	cmd := exec.Command("ntrights.exe", "+r", "SeServiceLogonRight", "-u", account)
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("ntrights.exe not found")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrCASConflict is returned by Backend.CAS when expectedVersion no longer
+// matches the value currently stored.
+var ErrCASConflict = errors.New("state: compare-and-swap version conflict")
+
+// WatchEvent is delivered on the channel returned by Backend.Watch whenever
+// the backend observes a new version of the state blob.
+type WatchEvent struct {
+	Value   []byte
+	Version uint64
+}
+
+// Lease represents a held leadership lock. Only the agent holding the lease
+// for a given agent_id should send heartbeats or execute jobs; standbys keep
+// state hot via Watch but stay passive until they win one.
+type Lease interface {
+	// Released yields once the lease is known to be lost (expired, revoked,
+	// or its renewal failed) or the context used to acquire it is done.
+	Released() <-chan struct{}
+	// Release voluntarily gives up the lease, e.g. on graceful shutdown so a
+	// standby can take over immediately instead of waiting out the TTL.
+	Release(ctx context.Context) error
+}
+
+// Backend is the storage abstraction underneath Store. Each Backend instance
+// is already scoped to a single logical state blob (an agent_id's state);
+// Cipher wraps values before they reach Put/CAS, so encryption stays
+// backend-agnostic.
+type Backend interface {
+	// Get returns the current value and its version. found is false if no
+	// value has ever been written.
+	Get(ctx context.Context) (value []byte, version uint64, found bool, err error)
+	// Put unconditionally writes value, returning its new version.
+	Put(ctx context.Context, value []byte) (version uint64, err error)
+	// CAS writes value only if the backend's current version equals
+	// expectedVersion (0 meaning "no value has been written yet"),
+	// returning ErrCASConflict otherwise.
+	CAS(ctx context.Context, value []byte, expectedVersion uint64) (version uint64, err error)
+	// Watch streams subsequent versions of the value until ctx is done.
+	// It is how a standby agent keeps its in-memory state hot without
+	// itself holding the leadership lease. The channel holds one event and
+	// sends never block, so a version observed while the previous event is
+	// still unread is dropped.
+	Watch(ctx context.Context) (<-chan WatchEvent, error)
+	// Lock attempts to acquire (or wait for) the leadership lease, renewing
+	// it for as long as ctx lives. ttl is advisory for backends that don't
+	// natively support TTL locks.
+	Lock(ctx context.Context, ttl time.Duration) (Lease, error)
+}
+
+// NewBackend builds the Backend selected by rawURL's scheme:
+//
+//	file://                (default when rawURL is empty or has no scheme)
+//	bolt://
+//	consul://<host:port>/<key-prefix>
+//	etcd://<host:port,...>/<key-prefix>
+//	vault://<host:port>/<mount>/<path>
+//
+// dataDir is the on-disk root for file:// and bolt://; any path in those
+// URLs is ignored. For the networked backends, a URL without a path gets
+// the key prefix "deploybot/agents/<agentID>".
+func NewBackend(rawURL, dataDir, agentID string) (Backend, error) {
+	if rawURL == "" || !strings.Contains(rawURL, "://") {
+		return NewFileBackend(dataDir)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse state backend URL: %w", err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix == "" {
+		prefix = "deploybot/agents/" + agentID
+	}
+	switch u.Scheme {
+	case "file":
+		return NewFileBackend(dataDir)
+	case "bolt":
+		return NewBoltBackend(dataDir)
+	case "consul":
+		return NewConsulBackend(u.Host, prefix)
+	case "etcd":
+		return NewEtcdBackend(strings.Split(u.Host, ","), prefix)
+	case "vault":
+		return NewVaultKVBackend(u.Host, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported state backend scheme %q", u.Scheme)
+	}
+}
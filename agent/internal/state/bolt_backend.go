@@ -0,0 +1,119 @@
+package state
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("deploybot_state")
+var boltStateKey = []byte("state")
+
+// BoltBackend persists the state blob in a local BoltDB file. Like
+// FileBackend it is single-writer local - bbolt already serialises access
+// to the file via its own flock - so Lock is granted unconditionally.
+type BoltBackend struct {
+	db *bolt.DB
+
+	mu      sync.Mutex
+	watches []chan WatchEvent
+}
+
+// NewBoltBackend opens (creating if absent) a BoltDB file at
+// dataDir/agent.bolt.
+func NewBoltBackend(dataDir string) (*BoltBackend, error) {
+	db, err := bolt.Open(filepath.Join(dataDir, "agent.bolt"), 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltBackend{db: db}, nil
+}
+
+func (b *BoltBackend) Get(ctx context.Context) ([]byte, uint64, bool, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltBucket).Get(boltStateKey); v != nil {
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if value == nil {
+		return nil, 0, false, nil
+	}
+	return value, contentVersion(value), true, nil
+}
+
+func (b *BoltBackend) Put(ctx context.Context, value []byte) (uint64, error) {
+	if err := b.writeAndNotify(value); err != nil {
+		return 0, err
+	}
+	return contentVersion(value), nil
+}
+
+func (b *BoltBackend) CAS(ctx context.Context, value []byte, expectedVersion uint64) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, current, found, err := b.Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if (found && current != expectedVersion) || (!found && expectedVersion != 0) {
+		return 0, ErrCASConflict
+	}
+	if err := b.writeAndNotifyLocked(value); err != nil {
+		return 0, err
+	}
+	return contentVersion(value), nil
+}
+
+func (b *BoltBackend) writeAndNotify(value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.writeAndNotifyLocked(value)
+}
+
+func (b *BoltBackend) writeAndNotifyLocked(value []byte) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(boltStateKey, value)
+	})
+	if err != nil {
+		return err
+	}
+	event := WatchEvent{Value: value, Version: contentVersion(value)}
+	for _, ch := range b.watches {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *BoltBackend) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	ch := make(chan WatchEvent, 1)
+	b.mu.Lock()
+	b.watches = append(b.watches, ch)
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+	}()
+	return ch, nil
+}
+
+func (b *BoltBackend) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return newStaticLease(ctx), nil
+}
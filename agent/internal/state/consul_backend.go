@@ -0,0 +1,169 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// ConsulBackend stores the state blob under a single Consul KV key and
+// layers leadership on Consul's native session/lock primitives, so
+// multiple agents sharing an agent_id (warm-standby, blue/green upgrades)
+// get a real distributed lease instead of a best-effort local one.
+type ConsulBackend struct {
+	client *consulapi.Client
+	key    string
+}
+
+// NewConsulBackend dials addr (host:port) and scopes this backend to a
+// single KV key, keyPrefix+"/state".
+func NewConsulBackend(addr, keyPrefix string) (*ConsulBackend, error) {
+	cfg := consulapi.DefaultConfig()
+	if addr != "" {
+		cfg.Address = addr
+	}
+	client, err := consulapi.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("consul client: %w", err)
+	}
+	return &ConsulBackend{client: client, key: keyPrefix + "/state"}, nil
+}
+
+func (b *ConsulBackend) Get(ctx context.Context) ([]byte, uint64, bool, error) {
+	pair, _, err := b.client.KV().Get(b.key, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if pair == nil {
+		return nil, 0, false, nil
+	}
+	return pair.Value, pair.ModifyIndex, true, nil
+}
+
+func (b *ConsulBackend) Put(ctx context.Context, value []byte) (uint64, error) {
+	pair := &consulapi.KVPair{Key: b.key, Value: value}
+	if _, err := b.client.KV().Put(pair, (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return 0, err
+	}
+	_, version, _, err := b.Get(ctx)
+	return version, err
+}
+
+// CAS maps directly onto Consul's native ModifyIndex-based CAS: an
+// expectedVersion of 0 means "key must not already exist", matching
+// ModifyIndex's own semantics for a create.
+func (b *ConsulBackend) CAS(ctx context.Context, value []byte, expectedVersion uint64) (uint64, error) {
+	pair := &consulapi.KVPair{Key: b.key, Value: value, ModifyIndex: expectedVersion}
+	ok, _, err := b.client.KV().CAS(pair, (&consulapi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrCASConflict
+	}
+	_, version, _, err := b.Get(ctx)
+	return version, err
+}
+
+// Watch long-polls Consul's blocking query API, the idiomatic way to stream
+// KV changes without a dedicated watch stream.
+func (b *ConsulBackend) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	ch := make(chan WatchEvent, 1)
+	go func() {
+		var waitIndex uint64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			pair, meta, err := b.client.KV().Get(b.key, (&consulapi.QueryOptions{
+				WaitIndex: waitIndex,
+				WaitTime:  5 * time.Minute,
+			}).WithContext(ctx))
+			if err != nil {
+				time.Sleep(time.Second)
+				continue
+			}
+			if meta != nil {
+				waitIndex = meta.LastIndex
+			}
+			if pair == nil {
+				continue
+			}
+			select {
+			case ch <- WatchEvent{Value: pair.Value, Version: pair.ModifyIndex}:
+			default:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Lock implements the classic Consul leader-election pattern: a session
+// tied to a TTL check, acquired against a sibling "<key>/leader" key.
+func (b *ConsulBackend) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	session, _, err := b.client.Session().Create(&consulapi.SessionEntry{
+		TTL:      ttl.String(),
+		Behavior: consulapi.SessionBehaviorRelease,
+	}, (&consulapi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("consul session create: %w", err)
+	}
+
+	lockKey := b.key + "/leader"
+	for {
+		acquired, _, err := b.client.KV().Acquire(&consulapi.KVPair{Key: lockKey, Session: session}, (&consulapi.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			b.client.Session().Destroy(session, nil)
+			return nil, fmt.Errorf("consul lock acquire: %w", err)
+		}
+		if acquired {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			b.client.Session().Destroy(session, nil)
+			return nil, ctx.Err()
+		case <-time.After(ttl / 3):
+		}
+	}
+
+	lease := &consulLease{client: b.client, session: session, done: make(chan struct{})}
+	go lease.renewUntilLost(ctx, ttl)
+	return lease, nil
+}
+
+type consulLease struct {
+	client  *consulapi.Client
+	session string
+	done    chan struct{}
+	doneOne sync.Once
+}
+
+func (l *consulLease) renewUntilLost(ctx context.Context, ttl time.Duration) {
+	err := l.client.Session().RenewPeriodic(ttl.String(), l.session, nil, ctx.Done())
+	if err != nil {
+		l.markLost()
+		return
+	}
+	l.markLost()
+}
+
+func (l *consulLease) markLost() {
+	l.doneOne.Do(func() { close(l.done) })
+}
+
+func (l *consulLease) Released() <-chan struct{} { return l.done }
+
+func (l *consulLease) Release(ctx context.Context) error {
+	_, err := l.client.Session().Destroy(l.session, (&consulapi.WriteOptions{}).WithContext(ctx))
+	l.markLost()
+	return err
+}
@@ -1,46 +1,232 @@
 package state
 
 import (
-    "crypto/aes"
-    "crypto/cipher"
-    "crypto/rand"
-    "crypto/sha256"
-    "encoding/base64"
-    "errors"
-    "io"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 )
 
 // Cipher defines the interface used to encrypt/decrypt sensitive state values.
 type Cipher interface {
-    Encrypt([]byte) (string, error)
-    Decrypt(string) ([]byte, error)
+	Encrypt([]byte) (string, error)
+	Decrypt(string) ([]byte, error)
 }
 
-// NewAESCipher derives an AES-GCM cipher from the provided passphrase.
+// KeyProvider wraps and unwraps a per-record data encryption key (DEK)
+// under a key-encryption key (KEK). Implementations never need to see a
+// payload's plaintext: envelopeCipher only ever asks them to wrap/unwrap
+// the random DEK it generates per record.
+type KeyProvider interface {
+	// KeyID uniquely identifies this provider's KEK. It is persisted
+	// alongside every DEK this provider wraps, so a ciphertext can always
+	// find its way back to the right provider after rotation.
+	KeyID() string
+	WrapKey(ctx context.Context, dek []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// envelopeVersion tags ciphertext produced by envelopeCipher, distinguishing
+// it from the legacy v1 format (raw base64 AES-GCM under a single
+// passphrase-derived key) that NewAESCipher used to produce.
+const envelopeVersion = "v2"
+
+// NewAESCipher derives an envelope cipher from the given passphrase, for
+// callers that don't need KMS-backed rotation. The KEK is derived with
+// Argon2id rather than a raw SHA-256 hash; see PassphraseKeyProvider.
 func NewAESCipher(passphrase string) (Cipher, error) {
-    if passphrase == "" { return nil, errors.New("passphrase required for encryption") }
-    key := sha256.Sum256([]byte(passphrase))
-    block, err := aes.NewCipher(key[:])
-    if err != nil { return nil, err }
-    gcm, err := cipher.NewGCM(block)
-    if err != nil { return nil, err }
-    return &aesCipher{gcm: gcm}, nil
-}
-
-type aesCipher struct { gcm cipher.AEAD }
-
-func (a *aesCipher) Encrypt(data []byte) (string, error) {
-    nonce := make([]byte, a.gcm.NonceSize())
-    if _, err := io.ReadFull(rand.Reader, nonce); err != nil { return "", err }
-    sealed := a.gcm.Seal(nonce, nonce, data, nil)
-    return base64.StdEncoding.EncodeToString(sealed), nil
-}
-
-func (a *aesCipher) Decrypt(encoded string) ([]byte, error) {
-    raw, err := base64.StdEncoding.DecodeString(encoded)
-    if err != nil { return nil, err }
-    if len(raw) < a.gcm.NonceSize() { return nil, errors.New("ciphertext too short") }
-    nonce := raw[:a.gcm.NonceSize()]
-    cipherText := raw[a.gcm.NonceSize():]
-    return a.gcm.Open(nil, nonce, cipherText, nil)
+	provider, err := NewPassphraseKeyProvider(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelopeCipher(NewKeyRing(provider), nil), nil
+}
+
+// NewEnvelopeCipher builds a Cipher that encrypts each record under a
+// random per-record DEK wrapped by ring's active KeyProvider. legacyKey, if
+// non-nil, is the raw AES-GCM key used to decode ciphertext written before
+// envelope encryption existed; it is never used to encrypt new records.
+func NewEnvelopeCipher(ring *KeyRing, legacyKey []byte) Cipher {
+	return &envelopeCipher{ring: ring, legacyKey: legacyKey}
+}
+
+type envelopeCipher struct {
+	ring      *KeyRing
+	legacyKey []byte
+}
+
+func (e *envelopeCipher) Encrypt(data []byte) (string, error) {
+	active := e.ring.Active()
+	if active == nil {
+		return "", errors.New("key ring has no active key provider")
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	defer zero(dek)
+
+	sealed, err := aesGCMSeal(dek, data)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := active.WrapKey(context.Background(), dek)
+	if err != nil {
+		return "", fmt.Errorf("wrap DEK: %w", err)
+	}
+
+	return fmt.Sprintf("%s:%s:%s:%s", envelopeVersion, active.KeyID(),
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+func (e *envelopeCipher) Decrypt(encoded string) ([]byte, error) {
+	if !strings.HasPrefix(encoded, envelopeVersion+":") {
+		return e.decryptLegacy(encoded)
+	}
+
+	keyID, wrappedB64, sealedB64, err := splitEnvelope(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, ok := e.ring.Provider(keyID)
+	if !ok {
+		return nil, fmt.Errorf("no key provider registered for key id %q", keyID)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedB64)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := provider.UnwrapKey(context.Background(), wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap DEK: %w", err)
+	}
+	defer zero(dek)
+
+	sealed, err := base64.StdEncoding.DecodeString(sealedB64)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMOpen(dek, sealed)
+}
+
+func (e *envelopeCipher) decryptLegacy(encoded string) ([]byte, error) {
+	if e.legacyKey == nil {
+		return nil, errors.New("ciphertext uses the legacy v1 format but no legacy key is configured")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCMOpen(e.legacyKey, raw)
+}
+
+// RewrapTo re-wraps encoded's DEK under the KEK identified by newKeyID,
+// which must already be registered in the ring, without touching the
+// encrypted payload. This is what makes KEK rotation cheap: the (possibly
+// large) AES-GCM ciphertext is copied verbatim.
+func (e *envelopeCipher) RewrapTo(ctx context.Context, encoded, newKeyID string) (string, error) {
+	if !strings.HasPrefix(encoded, envelopeVersion+":") {
+		return "", errors.New("cannot rewrap legacy v1 ciphertext; re-encrypt it instead")
+	}
+	newActive, ok := e.ring.Provider(newKeyID)
+	if !ok {
+		return "", fmt.Errorf("key id %q is not registered in the key ring", newKeyID)
+	}
+
+	keyID, wrappedB64, sealedB64, err := splitEnvelope(encoded)
+	if err != nil {
+		return "", err
+	}
+	provider, ok := e.ring.Provider(keyID)
+	if !ok {
+		return "", fmt.Errorf("no key provider registered for key id %q", keyID)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedB64)
+	if err != nil {
+		return "", err
+	}
+	dek, err := provider.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("unwrap DEK: %w", err)
+	}
+	defer zero(dek)
+
+	newWrapped, err := newActive.WrapKey(ctx, dek)
+	if err != nil {
+		return "", fmt.Errorf("wrap DEK under %q: %w", newKeyID, err)
+	}
+
+	return fmt.Sprintf("%s:%s:%s:%s", envelopeVersion, newActive.KeyID(),
+		base64.StdEncoding.EncodeToString(newWrapped), sealedB64), nil
+}
+
+// splitEnvelope parses "v2:<kek_id>:<wrapped_dek_b64>:<sealed_b64>". It
+// splits from the right because kek_id can itself contain colons (an AWS
+// KMS key ARN, for instance), while the two base64 fields never do.
+func splitEnvelope(encoded string) (keyID, wrappedB64, sealedB64 string, err error) {
+	rest := strings.TrimPrefix(encoded, envelopeVersion+":")
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return "", "", "", errors.New("malformed envelope ciphertext")
+	}
+	sealedB64, rest = rest[i+1:], rest[:i]
+
+	i = strings.LastIndex(rest, ":")
+	if i < 0 {
+		return "", "", "", errors.New("malformed envelope ciphertext")
+	}
+	wrappedB64, keyID = rest[i+1:], rest[:i]
+	if keyID == "" {
+		return "", "", "", errors.New("malformed envelope ciphertext")
+	}
+	return keyID, wrappedB64, sealedB64, nil
+}
+
+func aesGCMSeal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ct := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, nil)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
 }
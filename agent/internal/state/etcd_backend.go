@@ -0,0 +1,139 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// EtcdBackend stores the state blob under a single etcd key and layers
+// leadership on etcd's native session/mutex primitives (package
+// concurrency), giving every agent sharing an agent_id a real distributed
+// lease backed by etcd's lease-keepalive mechanism.
+type EtcdBackend struct {
+	client *clientv3.Client
+	key    string
+}
+
+// NewEtcdBackend dials endpoints and scopes this backend to a single key,
+// keyPrefix+"/state".
+func NewEtcdBackend(endpoints []string, keyPrefix string) (*EtcdBackend, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("etcd client: %w", err)
+	}
+	return &EtcdBackend{client: client, key: keyPrefix + "/state"}, nil
+}
+
+func (b *EtcdBackend) Get(ctx context.Context) ([]byte, uint64, bool, error) {
+	resp, err := b.client.Get(ctx, b.key)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, false, nil
+	}
+	kv := resp.Kvs[0]
+	return kv.Value, uint64(kv.ModRevision), true, nil
+}
+
+func (b *EtcdBackend) Put(ctx context.Context, value []byte) (uint64, error) {
+	resp, err := b.client.Put(ctx, b.key, string(value))
+	if err != nil {
+		return 0, err
+	}
+	return uint64(resp.Header.Revision), nil
+}
+
+// CAS maps onto an etcd transaction comparing ModRevision: expectedVersion
+// of 0 means "key must not already exist" (mod_revision compares equal to
+// 0 for an absent key).
+func (b *EtcdBackend) CAS(ctx context.Context, value []byte, expectedVersion uint64) (uint64, error) {
+	txn := b.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(b.key), "=", int64(expectedVersion))).
+		Then(clientv3.OpPut(b.key, string(value))).
+		Else(clientv3.OpGet(b.key))
+	resp, err := txn.Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrCASConflict
+	}
+	return uint64(resp.Header.Revision), nil
+}
+
+// Watch streams subsequent revisions of the key via etcd's native watch
+// stream; a revision that arrives while the previous event is still unread
+// is dropped.
+func (b *EtcdBackend) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	ch := make(chan WatchEvent, 1)
+	watchCh := b.client.Watch(ctx, b.key)
+	go func() {
+		for resp := range watchCh {
+			for _, ev := range resp.Events {
+				if ev.Kv == nil {
+					continue
+				}
+				select {
+				case ch <- WatchEvent{Value: ev.Kv.Value, Version: uint64(ev.Kv.ModRevision)}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Lock acquires etcd's standard session+mutex leader-election pattern
+// against a sibling "<key>/leader" key.
+func (b *EtcdBackend) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	session, err := concurrency.NewSession(b.client, concurrency.WithTTL(int(ttl.Seconds())), concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("etcd session: %w", err)
+	}
+	mutex := concurrency.NewMutex(session, b.key+"/leader")
+	if err := mutex.Lock(ctx); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("etcd lock acquire: %w", err)
+	}
+	lease := &etcdLease{session: session, mutex: mutex, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-session.Done():
+		case <-ctx.Done():
+		}
+		lease.markLost()
+	}()
+	return lease, nil
+}
+
+type etcdLease struct {
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (l *etcdLease) Released() <-chan struct{} { return l.done }
+
+func (l *etcdLease) Release(ctx context.Context) error {
+	err := l.mutex.Unlock(ctx)
+	l.session.Close()
+	l.markLost()
+	return err
+}
+
+func (l *etcdLease) markLost() {
+	l.once.Do(func() { close(l.done) })
+}
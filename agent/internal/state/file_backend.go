@@ -0,0 +1,156 @@
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileBackend persists the state blob as a single JSON file, the agent's
+// original storage model. It is single-writer local: CAS only guards against
+// concurrent writers on the same host (e.g. a crash-looping old process),
+// not a real distributed lock, so Lock is granted unconditionally.
+type FileBackend struct {
+	path string
+
+	mu      sync.Mutex
+	watches []chan WatchEvent
+}
+
+// NewFileBackend opens a FileBackend rooted at dataDir/agent.json.
+func NewFileBackend(dataDir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileBackend{path: filepath.Join(dataDir, "agent.json")}, nil
+}
+
+func (b *FileBackend) Get(ctx context.Context) ([]byte, uint64, bool, error) {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return data, contentVersion(data), true, nil
+}
+
+func (b *FileBackend) Put(ctx context.Context, value []byte) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.writeLocked(value); err != nil {
+		return 0, err
+	}
+	return contentVersion(value), nil
+}
+
+func (b *FileBackend) CAS(ctx context.Context, value []byte, expectedVersion uint64) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, current, found, err := b.Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if (found && current != expectedVersion) || (!found && expectedVersion != 0) {
+		return 0, ErrCASConflict
+	}
+	if err := b.writeLocked(value); err != nil {
+		return 0, err
+	}
+	return contentVersion(value), nil
+}
+
+func (b *FileBackend) writeLocked(value []byte) error {
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, value, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return err
+	}
+	b.notify(value)
+	return nil
+}
+
+func (b *FileBackend) notify(value []byte) {
+	event := WatchEvent{Value: value, Version: contentVersion(value)}
+	for _, ch := range b.watches {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Watch polls the file for content changes, since the local filesystem has
+// no native change-notification primitive we can rely on portably.
+func (b *FileBackend) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	ch := make(chan WatchEvent, 1)
+	b.mu.Lock()
+	b.watches = append(b.watches, ch)
+	b.mu.Unlock()
+
+	go func() {
+		const pollInterval = 2 * time.Second
+		var lastVersion uint64
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				data, version, found, err := b.Get(ctx)
+				if err != nil || !found || version == lastVersion {
+					continue
+				}
+				lastVersion = version
+				select {
+				case ch <- WatchEvent{Value: data, Version: version}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Lock is granted immediately: a local file has no cross-host contenders.
+// FileBackend takes no OS-level lock on the file, so two processes sharing
+// the same dataDir both receive a lease.
+func (b *FileBackend) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return newStaticLease(ctx), nil
+}
+
+// contentVersion derives a stable, non-cryptographic version token from a
+// value's content so Get/CAS can detect changes without a separate counter
+// file. Collisions are immaterial here: a false "unchanged" read just means
+// a wasted no-op write is retried at the next poll.
+func contentVersion(data []byte) uint64 {
+	sum := sha256.Sum256(data)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// staticLease is always held for the lifetime of ctx; used by backends
+// (file, bolt) where leadership can't meaningfully be contested.
+type staticLease struct {
+	done chan struct{}
+}
+
+func newStaticLease(ctx context.Context) *staticLease {
+	l := &staticLease{done: make(chan struct{})}
+	go func() {
+		<-ctx.Done()
+		close(l.done)
+	}()
+	return l
+}
+
+func (l *staticLease) Released() <-chan struct{} { return l.done }
+func (l *staticLease) Release(ctx context.Context) error { return nil }
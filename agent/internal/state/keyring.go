@@ -0,0 +1,58 @@
+package state
+
+import "sync"
+
+// KeyRing holds the KeyProvider used to encrypt new records (Active) plus
+// any retired providers kept around purely so ciphertext wrapped under an
+// older KEK can still be decrypted.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active KeyProvider
+	byID   map[string]KeyProvider
+}
+
+// NewKeyRing builds a ring with active as the provider used for new
+// encryptions; retired providers are registered for decrypt-only use.
+func NewKeyRing(active KeyProvider, retired ...KeyProvider) *KeyRing {
+	r := &KeyRing{byID: map[string]KeyProvider{}}
+	for _, p := range retired {
+		r.byID[p.KeyID()] = p
+	}
+	r.active = active
+	r.byID[active.KeyID()] = active
+	return r
+}
+
+// Active returns the provider currently used to encrypt new records.
+func (r *KeyRing) Active() KeyProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active
+}
+
+// Provider looks up a registered provider (active or retired) by KeyID.
+func (r *KeyRing) Provider(keyID string) (KeyProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.byID[keyID]
+	return p, ok
+}
+
+// Rotate registers newActive (if not already present) and makes it the
+// provider used for new encryptions. The previous active provider remains
+// registered, so ciphertext it already wrapped keeps decrypting until
+// something re-wraps it (see envelopeCipher.RewrapTo / Store.Rotate).
+func (r *KeyRing) Rotate(newActive KeyProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byID[newActive.KeyID()] = newActive
+	r.active = newActive
+}
+
+// Add registers a provider for decrypt/rewrap use without making it
+// active, e.g. to stage a KMS-backed KEK before switching over to it.
+func (r *KeyRing) Add(p KeyProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byID[p.KeyID()] = p
+}
@@ -0,0 +1,33 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// AWSKMSKeyProvider wraps/unwraps DEKs via AWS KMS Encrypt/Decrypt, so the
+// KEK material itself never leaves KMS.
+type AWSKMSKeyProvider struct {
+	Client *kms.Client
+	KeyARN string
+}
+
+func (p *AWSKMSKeyProvider) KeyID() string { return p.KeyARN }
+
+func (p *AWSKMSKeyProvider) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	out, err := p.Client.Encrypt(ctx, &kms.EncryptInput{KeyId: &p.KeyARN, Plaintext: dek})
+	if err != nil {
+		return nil, fmt.Errorf("kms encrypt: %w", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+func (p *AWSKMSKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	out, err := p.Client.Decrypt(ctx, &kms.DecryptInput{KeyId: &p.KeyARN, CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt: %w", err)
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+)
+
+// AzureKeyVaultKeyProvider wraps/unwraps DEKs via Key Vault's WrapKey/
+// UnwrapKey operations on an RSA or EC key, identified by the key's name
+// within VaultURL.
+type AzureKeyVaultKeyProvider struct {
+	Client    *azkeys.Client
+	VaultURL  string
+	KeyName   string
+	KeyVer    string
+	Algorithm azkeys.JSONWebKeyEncryptionAlgorithm
+}
+
+func (p *AzureKeyVaultKeyProvider) KeyID() string {
+	return fmt.Sprintf("%s/keys/%s/%s", p.VaultURL, p.KeyName, p.KeyVer)
+}
+
+func (p *AzureKeyVaultKeyProvider) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	resp, err := p.Client.WrapKey(ctx, p.KeyName, p.KeyVer, azkeys.KeyOperationParameters{
+		Algorithm: &p.Algorithm,
+		Value:     dek,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("key vault wrap: %w", err)
+	}
+	return resp.Result, nil
+}
+
+func (p *AzureKeyVaultKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	resp, err := p.Client.UnwrapKey(ctx, p.KeyName, p.KeyVer, azkeys.KeyOperationParameters{
+		Algorithm: &p.Algorithm,
+		Value:     wrapped,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("key vault unwrap: %w", err)
+	}
+	return resp.Result, nil
+}
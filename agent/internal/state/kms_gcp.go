@@ -0,0 +1,36 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	kmspb "cloud.google.com/go/kms/apiv1/kmspb"
+
+	kms "cloud.google.com/go/kms/apiv1"
+)
+
+// GCPKMSKeyProvider wraps/unwraps DEKs via Cloud KMS Encrypt/Decrypt on a
+// symmetric CryptoKey, identified by its full resource name
+// (projects/*/locations/*/keyRings/*/cryptoKeys/*).
+type GCPKMSKeyProvider struct {
+	Client       *kms.KeyManagementClient
+	CryptoKeyRef string
+}
+
+func (p *GCPKMSKeyProvider) KeyID() string { return p.CryptoKeyRef }
+
+func (p *GCPKMSKeyProvider) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	resp, err := p.Client.Encrypt(ctx, &kmspb.EncryptRequest{Name: p.CryptoKeyRef, Plaintext: dek})
+	if err != nil {
+		return nil, fmt.Errorf("cloud kms encrypt: %w", err)
+	}
+	return resp.Ciphertext, nil
+}
+
+func (p *GCPKMSKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	resp, err := p.Client.Decrypt(ctx, &kmspb.DecryptRequest{Name: p.CryptoKeyRef, Ciphertext: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("cloud kms decrypt: %w", err)
+	}
+	return resp.Plaintext, nil
+}
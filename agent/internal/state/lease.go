@@ -0,0 +1,173 @@
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// casLocker is the subset of Backend a generic compare-and-swap leader
+// election needs; satisfied directly by Backend itself, but kept narrow so
+// it can be pointed at a dedicated "<key>/leader" sibling key rather than
+// the backend's own state key.
+type casLocker interface {
+	Get(ctx context.Context) (value []byte, version uint64, found bool, err error)
+	CAS(ctx context.Context, value []byte, expectedVersion uint64) (version uint64, err error)
+}
+
+// leaseRecord is the payload written to the leader key by casLeaderElect.
+type leaseRecord struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// casLeaderElect implements a TTL-based leadership lease on top of any
+// backend that only gives us optimistic compare-and-swap, not a native
+// session/lock primitive (e.g. Vault KV). It polls-and-retries rather than
+// blocking on a server-side primitive, so it is coarser than
+// ConsulBackend/EtcdBackend's native locks, but gives every Backend
+// implementation the same Lock semantics.
+func casLeaderElect(ctx context.Context, locker casLocker, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	holder, err := randomHolderID()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		acquired, err := tryAcquire(ctx, locker, holder, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ttl / 3):
+		}
+	}
+
+	lease := &casLease{locker: locker, holder: holder, done: make(chan struct{})}
+	go lease.renewUntilLost(ctx, ttl)
+	return lease, nil
+}
+
+func tryAcquire(ctx context.Context, locker casLocker, holder string, ttl time.Duration) (bool, error) {
+	current, version, found, err := locker.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		var rec leaseRecord
+		if err := json.Unmarshal(current, &rec); err == nil && time.Now().Before(rec.ExpiresAt) && rec.Holder != holder {
+			return false, nil
+		}
+	}
+	payload, err := json.Marshal(leaseRecord{Holder: holder, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return false, err
+	}
+	expected := uint64(0)
+	if found {
+		expected = version
+	}
+	if _, err := locker.CAS(ctx, payload, expected); err != nil {
+		if err == ErrCASConflict {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type casLease struct {
+	locker casLocker
+	holder string
+
+	renewMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (l *casLease) renewUntilLost(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.markLost()
+			return
+		case <-ticker.C:
+			if err := l.renew(ctx, ttl); err != nil {
+				l.markLost()
+				return
+			}
+		}
+	}
+}
+
+func (l *casLease) renew(ctx context.Context, ttl time.Duration) error {
+	l.renewMu.Lock()
+	defer l.renewMu.Unlock()
+	current, version, found, err := l.locker.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("state: leadership lease disappeared before renewal")
+	}
+	var rec leaseRecord
+	if err := json.Unmarshal(current, &rec); err != nil || rec.Holder != l.holder {
+		return fmt.Errorf("state: leadership lease was taken over by another holder")
+	}
+	payload, err := json.Marshal(leaseRecord{Holder: l.holder, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	_, err = l.locker.CAS(ctx, payload, version)
+	return err
+}
+
+func (l *casLease) Released() <-chan struct{} { return l.done }
+
+func (l *casLease) Release(ctx context.Context) error {
+	defer l.markLost()
+	l.renewMu.Lock()
+	defer l.renewMu.Unlock()
+	current, version, found, err := l.locker.Get(ctx)
+	if err != nil || !found {
+		return err
+	}
+	var rec leaseRecord
+	if err := json.Unmarshal(current, &rec); err != nil || rec.Holder != l.holder {
+		return nil
+	}
+	// An expired record with no holder lets a standby acquire at once, and
+	// makes this lease's own next renewal fail so its renew loop stops.
+	payload, err := json.Marshal(leaseRecord{ExpiresAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = l.locker.CAS(ctx, payload, version)
+	return err
+}
+
+func (l *casLease) markLost() {
+	l.once.Do(func() { close(l.done) })
+}
+
+func randomHolderID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters for deriving a KEK from a passphrase. These follow
+// the OWASP-recommended baseline for interactive derivation: one pass,
+// 64 MiB, four lanes.
+const (
+	argon2Time    = 1
+	argon2MemKiB  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+)
+
+// PassphraseKeyProvider derives a KEK from an operator-supplied passphrase
+// with Argon2id, rather than the raw SHA-256 hash the cipher used before
+// envelope encryption existed. The derivation is bound to a random
+// per-provider salt, so KeyID (and the KEK itself) differ even for agents
+// sharing the same passphrase.
+type PassphraseKeyProvider struct {
+	keyID string
+	kek   []byte
+	salt  []byte
+}
+
+// NewPassphraseKeyProvider derives a KEK from passphrase using a freshly
+// generated salt.
+func NewPassphraseKeyProvider(passphrase string) (*PassphraseKeyProvider, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return LoadPassphraseKeyProvider(passphrase, salt)
+}
+
+// LoadPassphraseKeyProvider re-derives a KEK from a passphrase and a salt
+// persisted from an earlier NewPassphraseKeyProvider call (see Salt).
+func LoadPassphraseKeyProvider(passphrase string, salt []byte) (*PassphraseKeyProvider, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase required for encryption")
+	}
+	if len(salt) == 0 {
+		return nil, errors.New("salt required for passphrase key derivation")
+	}
+	kek := argon2.IDKey([]byte(passphrase), salt, argon2Time, argon2MemKiB, argon2Threads, argon2KeyLen)
+	id := sha256.Sum256(append([]byte("argon2id:"), salt...))
+	return &PassphraseKeyProvider{
+		keyID: "passphrase-" + hex.EncodeToString(id[:8]),
+		kek:   kek,
+		salt:  salt,
+	}, nil
+}
+
+// Salt returns the salt this provider was derived with, so the caller can
+// persist it (e.g. in agent.json) and reconstruct the same KEK next run.
+func (p *PassphraseKeyProvider) Salt() []byte { return p.salt }
+
+func (p *PassphraseKeyProvider) KeyID() string { return p.keyID }
+
+func (p *PassphraseKeyProvider) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	return aesGCMSeal(p.kek, dek)
+}
+
+func (p *PassphraseKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return aesGCMOpen(p.kek, wrapped)
+}
@@ -1,39 +1,82 @@
 package state
 
 import (
-    "encoding/json"
-    "errors"
-    "fmt"
-    "net"
-    "os"
-    "path/filepath"
-    "sync"
-    "time"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
 )
 
 // AgentState holds persistent agent metadata and runtime allocations.
 type AgentState struct {
-    AgentID             string                      `json:"agent_id"`
-    AgentToken          string                      `json:"agent_token,omitempty"`
-    AgentTokenEncrypted string                      `json:"agent_token_encrypted,omitempty"`
-    TokenUpdatedAt      time.Time                   `json:"token_updated_at,omitempty"`
-    Ports               map[string]int              `json:"ports"`
-    Deployments         map[string]DeploymentRecord `json:"deployments"`
+	AgentID             string                      `json:"agent_id"`
+	AgentToken          string                      `json:"agent_token,omitempty"`
+	AgentTokenEncrypted string                      `json:"agent_token_encrypted,omitempty"`
+	EncryptionSalt      string                      `json:"encryption_salt,omitempty"`
+	TokenUpdatedAt      time.Time                   `json:"token_updated_at,omitempty"`
+	Ports               map[string]int              `json:"ports"`
+	Deployments         map[string]DeploymentRecord `json:"deployments"`
 }
 
 // DeploymentRecord tracks the last known deployment for rollback purposes.
-type DeploymentRecord struct { Name string `json:"name"`; ContainerID string `json:"container_id"`; Compose bool `json:"compose"` }
+// Mode and ReplicaIDs let a rollback restore a blue/green or canary
+// deployment correctly instead of assuming a single rename+start container.
+// Image and PinnedDigest record the trust-on-first-use digest pin: the
+// first deploy of Image resolves and stores its digest here, and later
+// deploys of the same Image refuse to proceed on a different digest unless
+// the caller explicitly accepts the drift.
+// EnvHash, Ports and DeployedAt describe this current generation itself so
+// that, once a later deploy deposes it, those fields can be copied verbatim
+// into a DeploymentGeneration on History. History holds up to HistoryDepth
+// past generations (oldest first) for the "rollback" job to target.
+type DeploymentRecord struct {
+	Name         string                 `json:"name"`
+	ContainerID  string                 `json:"container_id"`
+	Compose      bool                   `json:"compose"`
+	Mode         string                 `json:"mode,omitempty"`
+	ReplicaIDs   []string               `json:"replica_ids,omitempty"`
+	Weight       int                    `json:"weight,omitempty"`
+	Image        string                 `json:"image,omitempty"`
+	PinnedDigest string                 `json:"pinned_digest,omitempty"`
+	EnvHash      string                 `json:"env_hash,omitempty"`
+	Ports        []int                  `json:"ports,omitempty"`
+	DeployedAt   time.Time              `json:"deployed_at,omitempty"`
+	History      []DeploymentGeneration `json:"history,omitempty"`
+}
+
+// DeploymentGeneration snapshots one deposed DeploymentRecord generation,
+// enough for a rollback job to reverse the swap - stop the current
+// container, rename generation N's ContainerID back to the canonical name,
+// start it, wait healthy - without needing the original deploy job's
+// payload. ReplicaIDs mirrors DeploymentRecord's field of the same name, for
+// a deposed generation that was itself a replica set or canary rollout.
+type DeploymentGeneration struct {
+	ContainerID  string    `json:"container_id"`
+	ReplicaIDs   []string  `json:"replica_ids,omitempty"`
+	Image        string    `json:"image,omitempty"`
+	PinnedDigest string    `json:"pinned_digest,omitempty"`
+	EnvHash      string    `json:"env_hash,omitempty"`
+	Ports        []int     `json:"ports,omitempty"`
+	DeployedAt   time.Time `json:"deployed_at,omitempty"`
+}
 
 // Store wraps AgentState with persistence helpers.
 type Store struct {
-    path          string
-    state         AgentState
-    mu            sync.RWMutex
-    cipher        Cipher
-    encryptTokens bool
+	backend       Backend
+	state         AgentState
+	version       uint64
+	mu            sync.RWMutex
+	cipher        Cipher
+	encryptTokens bool
 }
 
-type storeOptions struct { cipher Cipher; encryptTokens bool }
+type storeOptions struct {
+	cipher        Cipher
+	encryptTokens bool
+}
 
 // Option configures Store behaviour at creation time.
 type Option func(*storeOptions)
@@ -42,124 +85,372 @@ type Option func(*storeOptions)
 func WithCipher(c Cipher) Option { return func(o *storeOptions) { o.cipher = c } }
 
 // WithTokenEncryption toggles encryption when persisting sensitive fields.
-func WithTokenEncryption(enabled bool) Option { return func(o *storeOptions) { o.encryptTokens = enabled } }
-
-// Open loads state from path, creating an empty state if the file is absent.
-func Open(path string, opts ...Option) (*Store, error) {
-    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return nil, err }
-    config := storeOptions{}
-    for _, opt := range opts { opt(&config) }
-    s := &Store{path: path, cipher: config.cipher, encryptTokens: config.encryptTokens && config.cipher != nil}
-
-    data, err := os.ReadFile(path)
-    if errors.Is(err, os.ErrNotExist) {
-        s.state = AgentState{Ports: map[string]int{}, Deployments: map[string]DeploymentRecord{}}
-        return s, nil
-    }
-    if err != nil { return nil, err }
-    if err := json.Unmarshal(data, &s.state); err != nil { return nil, err }
-    if s.state.Ports == nil { s.state.Ports = map[string]int{} }
-    if s.state.Deployments == nil { s.state.Deployments = map[string]DeploymentRecord{} }
-    if s.encryptTokens && s.cipher != nil {
-        if s.state.AgentToken != "" { if err := s.migratePlaintextToken(); err != nil { return nil, err } } else if s.state.AgentTokenEncrypted != "" { if err := s.rotateEncryptedToken(); err != nil { return nil, err } }
-    }
-    return s, nil
+func WithTokenEncryption(enabled bool) Option {
+	return func(o *storeOptions) { o.encryptTokens = enabled }
+}
+
+// ReadEncryptionSalt peeks at the persisted passphrase-derivation salt via
+// backend without fully opening the store, so callers can build a
+// PassphraseKeyProvider before they have a Cipher to pass to Open.
+func ReadEncryptionSalt(backend Backend) (string, error) {
+	data, _, found, err := backend.Get(context.Background())
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", nil
+	}
+	var partial struct {
+		EncryptionSalt string `json:"encryption_salt"`
+	}
+	if err := json.Unmarshal(data, &partial); err != nil {
+		return "", err
+	}
+	return partial.EncryptionSalt, nil
+}
+
+// Open loads state through backend, creating an empty state if none has
+// been written yet.
+func Open(backend Backend, opts ...Option) (*Store, error) {
+	config := storeOptions{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	s := &Store{backend: backend, cipher: config.cipher, encryptTokens: config.encryptTokens && config.cipher != nil}
+
+	data, version, found, err := backend.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		s.state = AgentState{Ports: map[string]int{}, Deployments: map[string]DeploymentRecord{}}
+		return s, nil
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, err
+	}
+	s.version = version
+	if s.state.Ports == nil {
+		s.state.Ports = map[string]int{}
+	}
+	if s.state.Deployments == nil {
+		s.state.Deployments = map[string]DeploymentRecord{}
+	}
+	if s.encryptTokens && s.cipher != nil {
+		if s.state.AgentToken != "" {
+			if err := s.migratePlaintextToken(); err != nil {
+				return nil, err
+			}
+		} else if s.state.AgentTokenEncrypted != "" {
+			if err := s.rotateEncryptedToken(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
 }
 
 // Save persists current state atomically.
-func (s *Store) Save() error {
-    s.mu.RLock(); defer s.mu.RUnlock()
-    tmpPath := s.path + ".tmp"
-    data, err := json.MarshalIndent(&s.state, "", "  ")
-    if err != nil { return err }
-    if err := os.WriteFile(tmpPath, data, 0o600); err != nil { return err }
-    return os.Rename(tmpPath, s.path)
+func (s *Store) Save() error { s.mu.Lock(); defer s.mu.Unlock(); return s.saveLocked() }
+
+// AcquireLease attempts to become the active agent for this state's
+// agent_id. Only the lease holder should send heartbeats or execute jobs;
+// a standby agent should keep calling Watch to stay hot while it waits.
+func (s *Store) AcquireLease(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return s.backend.Lock(ctx, ttl)
+}
+
+// Watch streams subsequent versions of the state blob written by
+// whichever agent currently holds the lease, so a standby can keep its
+// in-memory copy hot without itself being active. Versions that arrive
+// while an earlier event is still unread are dropped (see Backend.Watch).
+func (s *Store) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	return s.backend.Watch(ctx)
+}
+
+// Reload replaces in-memory state with a version observed via Watch, e.g.
+// after the active agent persisted a change. The caller is responsible for
+// not calling this while this Store itself holds the write lease.
+func (s *Store) Reload(data []byte, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next AgentState
+	if err := json.Unmarshal(data, &next); err != nil {
+		return err
+	}
+	if next.Ports == nil {
+		next.Ports = map[string]int{}
+	}
+	if next.Deployments == nil {
+		next.Deployments = map[string]DeploymentRecord{}
+	}
+	s.state = next
+	s.version = version
+	return nil
 }
 
 // SetAgent records the agentID/token pair and persists immediately.
 func (s *Store) SetAgent(id, token string) error {
-    s.mu.Lock(); defer s.mu.Unlock()
-    s.state.AgentID = id
-    if s.encryptTokens && s.cipher != nil { if err := s.encryptTokenLocked(token); err != nil { return err } } else { s.state.AgentToken = token; s.state.AgentTokenEncrypted = ""; s.state.TokenUpdatedAt = time.Now().UTC() }
-    return s.saveLocked()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.AgentID = id
+	if err := s.setTokenLocked(token); err != nil {
+		return err
+	}
+	return s.saveLocked()
+}
+
+// SetAgentToken updates only the agent token, preserving AgentID, for
+// auto-auth renewals that refresh credentials without changing identity.
+func (s *Store) SetAgentToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.setTokenLocked(token); err != nil {
+		return err
+	}
+	return s.saveLocked()
+}
+
+func (s *Store) setTokenLocked(token string) error {
+	if s.encryptTokens && s.cipher != nil {
+		return s.encryptTokenLocked(token)
+	}
+	s.state.AgentToken = token
+	s.state.AgentTokenEncrypted = ""
+	s.state.TokenUpdatedAt = time.Now().UTC()
+	return nil
 }
 
 // AgentCredentials returns the stored ID/token if present.
 func (s *Store) AgentCredentials() (string, string, error) {
-    s.mu.RLock(); defer s.mu.RUnlock()
-    token := s.state.AgentToken
-    if token == "" && s.state.AgentTokenEncrypted != "" {
-        if s.cipher == nil { return "", "", errors.New("state contains encrypted agent token but cipher is not configured") }
-        plaintext, err := s.cipher.Decrypt(s.state.AgentTokenEncrypted)
-        if err != nil { return "", "", err }
-        token = string(plaintext)
-    }
-    return s.state.AgentID, token, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token := s.state.AgentToken
+	if token == "" && s.state.AgentTokenEncrypted != "" {
+		if s.cipher == nil {
+			return "", "", errors.New("state contains encrypted agent token but cipher is not configured")
+		}
+		plaintext, err := s.cipher.Decrypt(s.state.AgentTokenEncrypted)
+		if err != nil {
+			return "", "", err
+		}
+		token = string(plaintext)
+	}
+	return s.state.AgentID, token, nil
+}
+
+// EncryptionSalt returns the persisted passphrase-derivation salt, base64
+// encoded, or "" if none has been generated yet.
+func (s *Store) EncryptionSalt() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.EncryptionSalt
+}
+
+// SetEncryptionSalt persists the passphrase-derivation salt so the same
+// KEK can be re-derived from the passphrase on the next start.
+func (s *Store) SetEncryptionSalt(saltB64 string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.EncryptionSalt = saltB64
+	return s.saveLocked()
 }
 
 // ReservePort reserves a TCP port with the given key. If preferred > 0 we try to use it, otherwise scan.
 func (s *Store) ReservePort(key string, preferred int) (int, error) {
-    s.mu.Lock(); defer s.mu.Unlock()
-    if port, ok := s.state.Ports[key]; ok { return port, nil }
-    var port int; var err error
-    if preferred > 0 { if err = ensureAvailable(preferred); err == nil { port = preferred } }
-    if port == 0 { port, err = scanPortRange(20000, 65000); if err != nil { return 0, err } }
-    s.state.Ports[key] = port
-    if err := s.saveLocked(); err != nil { return 0, err }
-    return port, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if port, ok := s.state.Ports[key]; ok {
+		return port, nil
+	}
+	var port int
+	var err error
+	if preferred > 0 {
+		if err = ensureAvailable(preferred); err == nil {
+			port = preferred
+		}
+	}
+	if port == 0 {
+		port, err = scanPortRange(20000, 65000)
+		if err != nil {
+			return 0, err
+		}
+	}
+	s.state.Ports[key] = port
+	if err := s.saveLocked(); err != nil {
+		return 0, err
+	}
+	return port, nil
 }
 
 // ReleasePort frees a previously reserved port.
-func (s *Store) ReleasePort(key string) error { s.mu.Lock(); defer s.mu.Unlock(); delete(s.state.Ports, key); return s.saveLocked() }
+func (s *Store) ReleasePort(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state.Ports, key)
+	return s.saveLocked()
+}
 
 // RecordDeployment stores deployment metadata.
-func (s *Store) RecordDeployment(name string, record DeploymentRecord) error { s.mu.Lock(); defer s.mu.Unlock(); s.state.Deployments[name] = record; return s.saveLocked() }
+func (s *Store) RecordDeployment(name string, record DeploymentRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Deployments[name] = record
+	return s.saveLocked()
+}
+
+// Rotate re-wraps the persisted agent token's DEK under the KEK identified
+// by newKEKID, without re-encrypting the token itself. newKEKID must
+// already be registered (active or retired) in the cipher's KeyRing - e.g.
+// the caller adds the new KMS-backed provider to the ring before calling
+// Rotate, letting operators migrate from a passphrase KEK to a KMS KEK
+// without downtime or re-authenticating the agent.
+func (s *Store) Rotate(ctx context.Context, newKEKID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.AgentTokenEncrypted == "" {
+		return nil
+	}
+	rewrapper, ok := s.cipher.(interface {
+		RewrapTo(ctx context.Context, encoded, newKeyID string) (string, error)
+	})
+	if !ok {
+		return errors.New("configured cipher does not support key rotation")
+	}
+	rewrapped, err := rewrapper.RewrapTo(ctx, s.state.AgentTokenEncrypted, newKEKID)
+	if err != nil {
+		return err
+	}
+	s.state.AgentTokenEncrypted = rewrapped
+	return s.saveLocked()
+}
 
 // LastDeployment fetches the last deployment for a given name.
-func (s *Store) LastDeployment(name string) (DeploymentRecord, bool) { s.mu.RLock(); defer s.mu.RUnlock(); rec, ok := s.state.Deployments[name]; return rec, ok }
+func (s *Store) LastDeployment(name string) (DeploymentRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.state.Deployments[name]
+	return rec, ok
+}
+
+// PushHistory appends gen to name's rollback-history ring buffer, dropping
+// the oldest entries so History keeps only the newest depth generations a
+// "rollback" job can target (the configured HistoryDepth). depth<=0
+// falls back to 3. It is a no-op if name has no existing record.
+func (s *Store) PushHistory(name string, gen DeploymentGeneration, depth int) error {
+	if depth <= 0 {
+		depth = 3
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.state.Deployments[name]
+	if !ok {
+		return nil
+	}
+	rec.History = append(rec.History, gen)
+	if len(rec.History) > depth {
+		rec.History = rec.History[len(rec.History)-depth:]
+	}
+	s.state.Deployments[name] = rec
+	return s.saveLocked()
+}
+
+// ListDeploymentHistory returns name's rollback history, oldest generation
+// first, for the agent's HTTP API to surface available rollback targets.
+func (s *Store) ListDeploymentHistory(name string) ([]DeploymentGeneration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.state.Deployments[name]
+	if !ok {
+		return nil, false
+	}
+	out := make([]DeploymentGeneration, len(rec.History))
+	copy(out, rec.History)
+	return out, true
+}
+
+// AllDeployments returns a snapshot copy of every recorded deployment,
+// keyed by record name, for callers (like the verify job) that need to
+// walk the whole fleet rather than look one up by name.
+func (s *Store) AllDeployments() map[string]DeploymentRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]DeploymentRecord, len(s.state.Deployments))
+	for k, v := range s.state.Deployments {
+		out[k] = v
+	}
+	return out
+}
 
 func (s *Store) saveLocked() error {
-    tmpPath := s.path + ".tmp"
-    data, err := json.MarshalIndent(&s.state, "", "  ")
-    if err != nil { return err }
-    if err := os.WriteFile(tmpPath, data, 0o600); err != nil { return err }
-    return os.Rename(tmpPath, s.path)
+	data, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	version, err := s.backend.CAS(context.Background(), data, s.version)
+	if err != nil {
+		return err
+	}
+	s.version = version
+	return nil
 }
 
 func ensureAvailable(port int) error {
-    ln, err := net.Listen("tcp", fmt.Sprintf(":"+"%d", port))
-    if err != nil { return err }
-    return ln.Close()
+	ln, err := net.Listen("tcp", fmt.Sprintf(":"+"%d", port))
+	if err != nil {
+		return err
+	}
+	return ln.Close()
 }
 
 func (s *Store) encryptTokenLocked(token string) error {
-    if s.cipher == nil { return errors.New("encryption cipher not configured") }
-    enc, err := s.cipher.Encrypt([]byte(token))
-    if err != nil { return err }
-    s.state.AgentToken = ""
-    s.state.AgentTokenEncrypted = enc
-    s.state.TokenUpdatedAt = time.Now().UTC()
-    return nil
+	if s.cipher == nil {
+		return errors.New("encryption cipher not configured")
+	}
+	enc, err := s.cipher.Encrypt([]byte(token))
+	if err != nil {
+		return err
+	}
+	s.state.AgentToken = ""
+	s.state.AgentTokenEncrypted = enc
+	s.state.TokenUpdatedAt = time.Now().UTC()
+	return nil
 }
 
 func (s *Store) migratePlaintextToken() error {
-    s.mu.Lock(); defer s.mu.Unlock()
-    token := s.state.AgentToken
-    if token == "" { return nil }
-    if err := s.encryptTokenLocked(token); err != nil { return err }
-    return s.saveLocked()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token := s.state.AgentToken
+	if token == "" {
+		return nil
+	}
+	if err := s.encryptTokenLocked(token); err != nil {
+		return err
+	}
+	return s.saveLocked()
 }
 
 func (s *Store) rotateEncryptedToken() error {
-    s.mu.Lock(); defer s.mu.Unlock()
-    if s.state.AgentTokenEncrypted == "" { return nil }
-    plaintext, err := s.cipher.Decrypt(s.state.AgentTokenEncrypted)
-    if err != nil { return err }
-    if err := s.encryptTokenLocked(string(plaintext)); err != nil { return err }
-    return s.saveLocked()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state.AgentTokenEncrypted == "" {
+		return nil
+	}
+	plaintext, err := s.cipher.Decrypt(s.state.AgentTokenEncrypted)
+	if err != nil {
+		return err
+	}
+	if err := s.encryptTokenLocked(string(plaintext)); err != nil {
+		return err
+	}
+	return s.saveLocked()
 }
 
 func scanPortRange(start, end int) (int, error) {
-    for p := start; p <= end; p++ { if err := ensureAvailable(p); err == nil { return p, nil } }
-    return 0, errors.New("no free ports found in range")
+	for p := start; p <= end; p++ {
+		if err := ensureAvailable(p); err == nil {
+			return p, nil
+		}
+	}
+	return 0, errors.New("no free ports found in range")
 }
@@ -0,0 +1,179 @@
+package state
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// VaultKVBackend stores the state blob in Vault's versioned KV (v2) secrets
+// engine, keyed at "<mount>/data/<path>". Values are base64-encoded so
+// arbitrary (already-encrypted) JSON bytes survive Vault's string-map
+// payload.
+type VaultKVBackend struct {
+	client *vaultapi.Client
+	mount  string
+	path   string
+}
+
+// NewVaultKVBackend dials addr and scopes this backend to keyPrefix, whose
+// first path segment is treated as the KV mount (defaulting to "secret")
+// and the remainder as the secret path.
+func NewVaultKVBackend(addr, keyPrefix string) (*VaultKVBackend, error) {
+	cfg := vaultapi.DefaultConfig()
+	if addr != "" {
+		cfg.Address = "https://" + addr
+	}
+	client, err := vaultapi.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("vault client: %w", err)
+	}
+	mount, path := splitVaultPrefix(keyPrefix)
+	return &VaultKVBackend{client: client, mount: mount, path: path}, nil
+}
+
+func splitVaultPrefix(prefix string) (mount, path string) {
+	for i := 0; i < len(prefix); i++ {
+		if prefix[i] == '/' {
+			return prefix[:i], prefix[i+1:]
+		}
+	}
+	return "secret", prefix
+}
+
+func (b *VaultKVBackend) dataPath(path string) string {
+	return fmt.Sprintf("%s/data/%s", b.mount, path)
+}
+
+func (b *VaultKVBackend) Get(ctx context.Context) ([]byte, uint64, bool, error) {
+	return b.getAt(ctx, b.path)
+}
+
+func (b *VaultKVBackend) getAt(ctx context.Context, path string) ([]byte, uint64, bool, error) {
+	secret, err := b.client.Logical().ReadWithContext(ctx, b.dataPath(path))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, false, nil
+	}
+	inner, _ := secret.Data["data"].(map[string]interface{})
+	meta, _ := secret.Data["metadata"].(map[string]interface{})
+	encoded, _ := inner["value"].(string)
+	if encoded == "" {
+		return nil, 0, false, nil
+	}
+	value, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	var version uint64
+	if v, ok := meta["version"].(float64); ok {
+		version = uint64(v)
+	}
+	return value, version, true, nil
+}
+
+func (b *VaultKVBackend) Put(ctx context.Context, value []byte) (uint64, error) {
+	return b.putAt(ctx, b.path, value, nil)
+}
+
+func (b *VaultKVBackend) CAS(ctx context.Context, value []byte, expectedVersion uint64) (uint64, error) {
+	return b.putAt(ctx, b.path, value, &expectedVersion)
+}
+
+func (b *VaultKVBackend) putAt(ctx context.Context, path string, value []byte, expectedVersion *uint64) (uint64, error) {
+	payload := map[string]interface{}{
+		"data": map[string]interface{}{
+			"value": base64.StdEncoding.EncodeToString(value),
+		},
+	}
+	if expectedVersion != nil {
+		payload["options"] = map[string]interface{}{"cas": *expectedVersion}
+	}
+	secret, err := b.client.Logical().WriteWithContext(ctx, b.dataPath(path), payload)
+	if err != nil {
+		if expectedVersion != nil && isVaultCASConflict(err) {
+			return 0, ErrCASConflict
+		}
+		return 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, nil
+	}
+	if v, ok := secret.Data["version"].(float64); ok {
+		return uint64(v), nil
+	}
+	return 0, nil
+}
+
+// isVaultCASConflict recognises Vault's "did not match the current version"
+// response to a failed KV v2 CAS write. Vault surfaces this as a generic
+// 400 *vaultapi.ResponseError, so we fall back to a message match rather
+// than a typed sentinel.
+func isVaultCASConflict(err error) bool {
+	respErr, ok := err.(*vaultapi.ResponseError)
+	if !ok {
+		return false
+	}
+	for _, msg := range respErr.Errors {
+		lower := strings.ToLower(msg)
+		if strings.Contains(lower, "check-and-set") || strings.Contains(lower, "did not match") {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls Vault's KV metadata, since the engine has no native change
+// stream; 5s keeps a standby reasonably hot without hammering Vault.
+func (b *VaultKVBackend) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	ch := make(chan WatchEvent, 1)
+	go func() {
+		const pollInterval = 5 * time.Second
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		var lastVersion uint64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				value, version, found, err := b.Get(ctx)
+				if err != nil || !found || version == lastVersion {
+					continue
+				}
+				lastVersion = version
+				select {
+				case ch <- WatchEvent{Value: value, Version: version}:
+				default:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Lock has no native Vault counterpart, so leadership is arbitrated with
+// the generic CAS-based election against a sibling "<path>/leader" secret.
+func (b *VaultKVBackend) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return casLeaderElect(ctx, &vaultLeaderKey{backend: b}, ttl)
+}
+
+// vaultLeaderKey adapts VaultKVBackend to casLocker, pointed at a sibling
+// secret path rather than the backend's own state key.
+type vaultLeaderKey struct {
+	backend *VaultKVBackend
+}
+
+func (k *vaultLeaderKey) Get(ctx context.Context) ([]byte, uint64, bool, error) {
+	return k.backend.getAt(ctx, k.backend.path+"/leader")
+}
+
+func (k *vaultLeaderKey) CAS(ctx context.Context, value []byte, expectedVersion uint64) (uint64, error) {
+	return k.backend.putAt(ctx, k.backend.path+"/leader", value, &expectedVersion)
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// VaultTransitKeyProvider wraps/unwraps DEKs via HashiCorp Vault's Transit
+// secrets engine (transit/encrypt/<key>, transit/decrypt/<key>), so the KEK
+// never leaves Vault and its ciphertext carries Vault's own "vault:v<n>:"
+// versioning.
+type VaultTransitKeyProvider struct {
+	Client  *vaultapi.Client
+	Mount   string // defaults to "transit" if empty
+	KeyName string
+}
+
+func (p *VaultTransitKeyProvider) mount() string {
+	if p.Mount == "" {
+		return "transit"
+	}
+	return p.Mount
+}
+
+func (p *VaultTransitKeyProvider) KeyID() string {
+	return fmt.Sprintf("vault-transit:%s/%s", p.mount(), p.KeyName)
+}
+
+func (p *VaultTransitKeyProvider) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	secret, err := p.Client.Logical().WriteWithContext(ctx, fmt.Sprintf("%s/encrypt/%s", p.mount(), p.KeyName), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("vault transit encrypt: %w", err)
+	}
+	ct, ok := secret.Data["ciphertext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault transit encrypt: missing ciphertext in response")
+	}
+	return []byte(ct), nil
+}
+
+func (p *VaultTransitKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	secret, err := p.Client.Logical().WriteWithContext(ctx, fmt.Sprintf("%s/decrypt/%s", p.mount(), p.KeyName), map[string]interface{}{
+		"ciphertext": string(wrapped),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("vault transit decrypt: %w", err)
+	}
+	ptB64, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault transit decrypt: missing plaintext in response")
+	}
+	return base64.StdEncoding.DecodeString(ptB64)
+}